@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"github.com/sonjoonho/bgw/pkg/transport"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	caCertFile = "ca.pem"
+	caKeyFile  = "ca-key.pem"
+)
+
+// partyCertFiles returns the names of the certificate and private key files for the party with the specified id.
+func partyCertFiles(id int) (string, string) {
+	name := transport.PartyName(id)
+	return name + ".pem", name + "-key.pem"
+}
+
+// runCerts generates a CA and a certificate for each party for testing, and writes them to a directory. args are the
+// command line arguments following "certs".
+func runCerts(args []string) {
+	fs := flag.NewFlagSet("certs", flag.ExitOnError)
+	nParties := fs.Int("n", 0, "Number of parties to generate certificates for.")
+	dir := fs.String("dir", "certs", "Directory to write certificates and private keys to.")
+	fs.Parse(args)
+
+	if *nParties <= 0 {
+		logger.Fatalf("n=%d must be positive", *nParties)
+	}
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		logger.Fatalf("Failed to create %s: %v", *dir, err)
+	}
+
+	caCert, caKey, err := transport.GenerateCA()
+	if err != nil {
+		logger.Fatalf("Failed to generate CA: %v", err)
+	}
+	writeCertificate(*dir, caCertFile, caKeyFile, caCert, caKey)
+
+	for id := 0; id < *nParties; id++ {
+		cert, key, err := transport.GenerateCertificate(id, caCert, caKey)
+		if err != nil {
+			logger.Fatalf("Failed to generate certificate for party %d: %v", id, err)
+		}
+		certFile, keyFile := partyCertFiles(id)
+		writeCertificate(*dir, certFile, keyFile, cert, key)
+	}
+
+	logger.Printf("Wrote CA and certificates for %d parties to %s", *nParties, *dir)
+}
+
+// writeCertificate writes a PEM-encoded certificate and private key to files in dir. The private key is only readable
+// by the current user.
+func writeCertificate(dir, certFile, keyFile string, cert, key []byte) {
+	if err := ioutil.WriteFile(filepath.Join(dir, certFile), cert, 0644); err != nil {
+		logger.Fatalf("Failed to write %s: %v", certFile, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, keyFile), key, 0600); err != nil {
+		logger.Fatalf("Failed to write %s: %v", keyFile, err)
+	}
+}
+
+// loadTLSConfig loads the TLS configuration for the party with the specified id from files in dir, as written by
+// runCerts.
+func loadTLSConfig(dir string, id int) (*tls.Config, error) {
+	certFile, keyFile := partyCertFiles(id)
+	var pems [3][]byte
+	for i, file := range []string{caCertFile, certFile, keyFile} {
+		var err error
+		if pems[i], err = ioutil.ReadFile(filepath.Join(dir, file)); err != nil {
+			return nil, err
+		}
+	}
+	return transport.TLSConfig(pems[0], pems[1], pems[2])
+}
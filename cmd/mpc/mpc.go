@@ -2,110 +2,302 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/circuit/optimize"
 	"github.com/sonjoonho/bgw/pkg/config"
 	"github.com/sonjoonho/bgw/pkg/party"
+	"github.com/sonjoonho/bgw/pkg/transport"
 	"log"
+	"math/big"
 	"os"
 	"sync"
+	"time"
 )
 
 var logger = log.New(os.Stdout, "MPC: ", log.Lmicroseconds)
 
 const (
 	defaultCircuitNumber = 1
-	defaultPrime         = 101
+	defaultPrime         = "101"
 	defaultSeed          = 0
 	defaultDegree        = -1
 )
 
 var (
-	circuitNumber int
-	degree        int
-	prime         int
-	seed          int64
+	beaver          bool
+	circuitFile     string
+	circuitNumber   int
+	configFile      string
+	dealer          bool
+	degree          int
+	errorCorrection bool
+	exprSrc         string
+	optimizeCircuit bool
+	prime           string
+	seed            int64
+	timeout         time.Duration
+	writeConfig     string
 )
 
 func init() {
-	flag.IntVar(&circuitNumber, "circuit", defaultCircuitNumber, "Circuit to run.")
-	flag.IntVar(&degree, "degree", defaultDegree, "Degree of polynomial. If unset, it is set to N-1/2")
-	flag.IntVar(&prime, "prime", defaultPrime, "Prime number to use for modular arithmetic.")
-	flag.Int64Var(&seed, "seed", defaultSeed, "Seed for pseudorandom number generation. If unset, the current time is used.")
+	registerFlags(flag.CommandLine)
+}
+
+// registerFlags registers the flags which configure the protocol on fs.
+func registerFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&beaver, "beaver", false, "Multiply using Beaver triples generated in an offline phase, rather than re-sharing every product.")
+	fs.IntVar(&circuitNumber, "circuit", defaultCircuitNumber, "Circuit to run.")
+	fs.StringVar(&circuitFile, "circuit-file", "", "Bristol Fashion file containing the circuit to run, with random secrets. If set, -circuit is ignored.")
+	fs.StringVar(&configFile, "config-file", "", "JSON or YAML file containing the configuration to run, including the circuit and secrets. If set, -circuit, -circuit-file, -expr, -degree and -prime are ignored.")
+	fs.BoolVar(&dealer, "dealer", false, "Generate Beaver triples using a trusted dealer, rather than by the parties themselves. Requires -beaver, and is not supported in party mode.")
+	fs.IntVar(&degree, "degree", defaultDegree, "Degree of polynomial. If unset, it is set to N-1/2")
+	fs.StringVar(&exprSrc, "expr", "", "Program in the expression language defining the circuit to run, e.g. 'out = x0*x1 + x2*x3 - 5', with random secrets. If set, -circuit and -circuit-file are ignored.")
+	fs.BoolVar(&errorCorrection, "error-correction", false, "Reconstruct the output using Reed-Solomon error correction, identifying parties that send incorrect output shares.")
+	fs.BoolVar(&optimizeCircuit, "optimize", false, "Optimize the circuit before running it, removing redundant gates and reducing its multiplicative depth.")
+	fs.StringVar(&prime, "prime", defaultPrime, "Prime number to use for modular arithmetic, in decimal or hexadecimal with a 0x prefix. It may be arbitrarily large.")
+	fs.Int64Var(&seed, "seed", defaultSeed, "Seed for pseudorandom number generation. If unset, the current time is used.")
+	fs.DurationVar(&timeout, "timeout", 0, "Maximum time to run the protocol for, e.g. 10s. If unset, there is no limit.")
+	fs.StringVar(&writeConfig, "write-config", "", "Write the configuration to this JSON or YAML file, which can be run using -config-file, instead of running the protocol.")
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "party":
+			// In party mode, this process runs a single party which communicates with the others over the network.
+			runParty(os.Args[2:])
+			return
+		case "certs":
+			runCerts(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Parse()
 	logger.Println("Starting BGW protocol...")
 
-	cfg, err := config.New(prime, seed, defaultSeed, degree, defaultDegree, circuitNumber)
+	cfg := newConfig()
+	if writeConfig != "" {
+		if err := config.Save(writeConfig, cfg); err != nil {
+			logger.Fatalf("Writing configuration failed: %v", err)
+		}
+		logger.Printf("Wrote configuration to %s", writeConfig)
+		return
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	start := time.Now()
+	actual, err := RunProtocol(ctx, cfg)
 	if err != nil {
-		logger.Fatalf("Configuration failed: %v", err)
+		logger.Fatalf("Protocol failed: %v", err)
 	}
+	logger.Printf("Protocol took %v", time.Since(start))
 
-	nParties := cfg.Circuit.NParties
+	checkOutput(cfg, actual)
+}
+
+// newConfig creates the configuration specified by the flags, and logs it.
+func newConfig() *config.Config {
+	var cfg *config.Config
+	var err error
+	switch {
+	case configFile != "":
+		cfg, err = config.Load(configFile, seed, defaultSeed)
+	case exprSrc != "":
+		cfg, err = config.NewFromExpr(prime, seed, defaultSeed, degree, defaultDegree, exprSrc)
+	case circuitFile != "":
+		cfg, err = config.NewFromFile(prime, seed, defaultSeed, degree, defaultDegree, circuitFile)
+	default:
+		cfg, err = config.New(prime, seed, defaultSeed, degree, defaultDegree, circuitNumber)
+	}
+	if err != nil {
+		logger.Fatalf("Configuration failed: %v", err)
+	}
+	// The options in a configuration file can also be enabled using flags.
+	cfg.ErrorCorrection = cfg.ErrorCorrection || errorCorrection
+	cfg.Beaver = cfg.Beaver || beaver
+	cfg.Dealer = cfg.Dealer || dealer
+	if cfg.Dealer && !cfg.Beaver {
+		logger.Fatal("Configuration failed: -dealer requires -beaver")
+	}
+	original := cfg.Circuit
+	if optimizeCircuit {
+		cfg.Circuit = optimize.Optimize(cfg.Circuit)
+	}
 
 	logger.Println("")
 	logger.Printf("Circuit Configuration")
 	logger.Println("===================================")
-	logger.Printf("  Circuit number:    %d", circuitNumber)
-	logger.Printf("  Number of parties: %d", nParties)
+	switch {
+	case configFile != "":
+		logger.Printf("  Config file:       %s", configFile)
+	case exprSrc != "":
+		logger.Printf("  Expression:        %s", exprSrc)
+	case circuitFile != "":
+		logger.Printf("  Circuit file:      %s", circuitFile)
+	default:
+		logger.Printf("  Circuit number:    %d", circuitNumber)
+	}
+	logger.Printf("  Number of parties: %d", cfg.Circuit.NParties)
 	logger.Printf("  Secrets:           %v", cfg.Secrets)
 	logger.Printf("  Polynomial degree: %d", cfg.Degree)
+	logger.Printf("  Multiplication:    %s", multiplication(cfg))
+	if optimizeCircuit {
+		logger.Printf("  Optimization:      %s -> %s", describe(original), describe(cfg.Circuit))
+	}
 	logger.Println("")
 
-	actual, err := RunProtocol(cfg)
-	if err != nil {
-		logger.Fatalf("Protocol failed: %v", err)
+	return cfg
+}
+
+// describe describes the size of c.
+func describe(c *circuit.Circuit) string {
+	return fmt.Sprintf("%d gates with multiplicative depth %d", len(c.Traverse()), len(c.Layers())-1)
+}
+
+// multiplication describes the multiplication protocol used by cfg.
+func multiplication(cfg *config.Config) string {
+	switch {
+	case cfg.Beaver && cfg.Dealer:
+		return "Beaver triples from a trusted dealer"
+	case cfg.Beaver:
+		return "Beaver triples generated by the parties"
+	default:
+		return "GRR re-sharing"
 	}
+}
 
-	expected := cfg.Field.Mod(cfg.Circuit.ComputeExpected(cfg.Secrets))
-	logger.Printf("Expected output: %d", expected)
-	logger.Printf("Actual output:   %d", actual)
+// newContext returns a context for running the protocol, which is done after the timeout specified by the flags.
+func newContext() (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
 
-	if expected == actual {
+// checkOutput compares each output of the protocol to the expected output of the circuit.
+func checkOutput(cfg *config.Config, actual []*big.Int) {
+	expected, err := cfg.Circuit.ComputeExpected(cfg.Secrets, cfg.Field)
+	if err != nil {
+		logger.Fatalf("Failed to compute expected output: %v", err)
+	}
+	succeeded := len(expected) == len(actual)
+	for i, out := range cfg.Circuit.OutputGates() {
+		if expected[i] == nil {
+			logger.Printf("Expected %s: random", out.Name)
+		} else {
+			logger.Printf("Expected %s: %d", out.Name, expected[i])
+		}
+		if i >= len(actual) {
+			continue
+		}
+		if actual[i] == nil {
+			// In party mode, this party may not be a recipient of the output.
+			logger.Printf("Actual %s:   not received (recipients are parties %v)", out.Name, out.Recipients)
+			continue
+		}
+		logger.Printf("Actual %s:   %d", out.Name, actual[i])
+		// Random outputs cannot be checked, since no party knows their value in advance.
+		succeeded = succeeded && (expected[i] == nil || expected[i].Cmp(actual[i]) == 0)
+	}
+
+	if succeeded {
 		logger.Println("Protocol succeeded (:")
 	} else {
 		logger.Fatal("Protocol failed ):")
 	}
 }
 
-// RunProtocol runs the BGW protocol using the provided configuration.
-func RunProtocol(cfg *config.Config) (int, error) {
+// RunProtocol runs the BGW protocol using the provided configuration, and returns the value of each output of the
+// circuit, as learnt by its recipients. If any party fails, every other party is stopped and the error from the party
+// which failed first is returned.
+func RunProtocol(ctx context.Context, cfg *config.Config) ([]*big.Int, error) {
 	nParties := cfg.Circuit.NParties
 
-	// Initialise each party.
+	// Initialise each party. Parties run in the same process, so they communicate using channels.
+	transports := transport.NewChannels(nParties)
+	// dealer deals Beaver triples to every party if there is a trusted dealer.
+	var dealer *party.Dealer
+	if cfg.Beaver && cfg.Dealer {
+		dealer = party.NewDealer(nParties, cfg.Degree, cfg.Field)
+	}
 	parties := make([]*party.Party, nParties, nParties)
 	for i := 0; i < nParties; i++ {
 		// Note that cfg.Circuit is copied, and the rest of the parameters are values so parties do not share memory.
-		p := party.New(i, cfg.Secrets[i], cfg.Circuit.Copy(), cfg.Field, cfg.Degree)
+		p := party.New(i, cfg.Secrets[i], cfg.Circuit.Copy(), cfg.Field, cfg.Degree, transports[i])
+		if cfg.ErrorCorrection {
+			p.EnableErrorCorrection()
+		}
+		switch {
+		case dealer != nil:
+			p.UseDealer(dealer)
+		case cfg.Beaver:
+			p.UseBeaverTriples(nil)
+		}
 		parties[i] = p
 	}
 
 	// results stores the final output values of each party. These are then checked for consistency.
-	results := make([]int, nParties, nParties)
+	results := make([][]*big.Int, nParties, nParties)
+	errs := make([]error, nParties, nParties)
+	// Cancelling ctx stops every party, which we do as soon as any party fails since the others may never finish.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	// Go!
 	var wg sync.WaitGroup
 	for i, p := range parties {
-		p.SubscribeAll(parties)
 		wg.Add(1)
 		// These parameters are important!
 		// Reference: https://github.com/golang/go/wiki/CommonMistakes#using-goroutines-on-loop-iterator-variables.
 		go func(i int, p *party.Party) {
 			defer wg.Done()
-			results[i] = p.Run()
+			results[i], errs[i] = p.Run(ctx)
+			if errs[i] != nil {
+				cancel()
+			}
 		}(i, p)
 	}
 
 	// Block until all parties have finished.
 	wg.Wait()
 
-	// Check results for consistency.
+	// Parties which were stopped because another party failed report context.Canceled, so we prefer the root cause.
+	var firstErr error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	// Check results for consistency. Each output is only returned by its recipients, and they must all agree.
+	outputs := make([]*big.Int, len(results[0]), len(results[0]))
 	for _, r := range results {
-		if r != results[0] {
-			return 0, fmt.Errorf("protocol failed: return values do not match")
+		for i, v := range r {
+			if v == nil {
+				continue
+			}
+			if outputs[i] == nil {
+				outputs[i] = v
+			} else if v.Cmp(outputs[i]) != 0 {
+				return nil, fmt.Errorf("protocol failed: return values do not match")
+			}
 		}
 	}
 
-	return results[0], nil
+	return outputs, nil
 }
@@ -1,23 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/circuit/optimize"
 	"github.com/sonjoonho/bgw/pkg/config"
 	"github.com/sonjoonho/bgw/pkg/field"
 	"github.com/sonjoonho/bgw/pkg/gate"
+	"math/big"
+	"path/filepath"
 	"testing"
 )
 
 func TestRunProtocol(t *testing.T) {
-	fld := field.New(101)
+	fld := field.New(field.Int(101))
+	// 2^127 - 1 is a Mersenne prime.
+	bigFld, err := field.Parse("0x7fffffffffffffffffffffffffffffff")
+	if err != nil {
+		t.Fatalf("field.Parse() failed with %v", err)
+	}
 	tests := []struct {
 		name string
 		cfg  *config.Config
-		want int
+		want []*big.Int
 	}{{
 		name: "Textbook example",
 		cfg: &config.Config{
-			Secrets: []int{20, 40, 21, 31, 1, 71},
+			Secrets: config.OneEach(field.Ints(20, 40, 21, 31, 1, 71)),
 			Field:   fld,
 			Degree:  2,
 			Circuit: &circuit.Circuit{
@@ -37,12 +48,12 @@ func TestRunProtocol(t *testing.T) {
 				),
 			},
 		},
-		want: 7,
+		want: field.Ints(7),
 	}, {
 		name: "Many adds",
-		want: 21,
+		want: field.Ints(21),
 		cfg: &config.Config{
-			Secrets: []int{1, 2, 3, 4, 5, 6},
+			Secrets: config.OneEach(field.Ints(1, 2, 3, 4, 5, 6)),
 			Field:   fld,
 			Circuit: &circuit.Circuit{
 				NParties: 6,
@@ -63,9 +74,9 @@ func TestRunProtocol(t *testing.T) {
 		},
 	}, {
 		name: "Multiple inputs for one party",
-		want: 6,
+		want: field.Ints(6),
 		cfg: &config.Config{
-			Secrets: []int{1, 2},
+			Secrets: config.OneEach(field.Ints(1, 2)),
 			Field:   fld,
 			Circuit: &circuit.Circuit{
 				NParties: 2,
@@ -80,16 +91,323 @@ func TestRunProtocol(t *testing.T) {
 				), gate.NewMul(&gate.Input{Party: 0}, &gate.Input{Party: 0})),
 			},
 		},
+	}, {
+		name: "Several inputs for one party",
+		// (1 + 4) * 2 * 3
+		want: field.Ints(30),
+		cfg: &config.Config{
+			Secrets: [][]*big.Int{field.Ints(1, 3, 4), field.Ints(2)},
+			Field:   fld,
+			Circuit: &circuit.Circuit{
+				NParties: 2,
+				Root: gate.NewMul(
+					gate.NewMul(
+						gate.NewAdd(&gate.Input{Party: 0}, &gate.Input{Party: 0, Index: 2}),
+						&gate.Input{Party: 1}),
+					&gate.Input{Party: 0, Index: 1}),
+			},
+		},
+	}, {
+		name: "Large prime",
+		want: field.Ints(1522),
+		cfg: &config.Config{
+			Secrets: config.OneEach(field.Ints(20, 40, 21, 31, 1, 71)),
+			Field:   bigFld,
+			Degree:  2,
+			Circuit: &circuit.Circuit{
+				NParties: 6,
+				Root: gate.NewAdd(
+					gate.NewAdd(
+						gate.NewMul(
+							&gate.Input{Party: 0},
+							&gate.Input{Party: 1},
+						),
+						gate.NewMul(
+							&gate.Input{Party: 2},
+							&gate.Input{Party: 3}),
+					), gate.NewMul(
+						&gate.Input{Party: 4},
+						&gate.Input{Party: 5}),
+				),
+			},
+		},
+	}, {
+		name: "Multiple outputs",
+		want: field.Ints(6, 3, 92),
+		cfg: &config.Config{
+			Secrets: config.OneEach(field.Ints(2, 3, 1)),
+			Field:   fld,
+			Degree:  1,
+			Circuit: func() *circuit.Circuit {
+				x, y, z := &gate.Input{Party: 0}, &gate.Input{Party: 1}, &gate.Input{Party: 2}
+				xy := gate.NewMul(x, y)
+				sum := gate.NewAdd(xy, z)
+				return &circuit.Circuit{
+					NParties: 3,
+					Outputs: []circuit.Output{
+						{Name: "xy", Gate: xy},
+						{Name: "y", Gate: y},
+						// Outputs may depend on each other.
+						{Name: "xy(xy+z)^2", Gate: gate.NewMul(xy, gate.NewMul(sum, sum))},
+					},
+				}
+			}(),
+		},
 	}}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := RunProtocol(tc.cfg)
+			got, err := RunProtocol(context.Background(), tc.cfg)
 			if err != nil {
 				t.Errorf("RunProtocol(%v) failed with %v", tc.cfg, err)
-			} else if got != tc.want {
+			} else if fmt.Sprint(got) != fmt.Sprint(tc.want) {
 				t.Errorf("RunProtocol(%v) = %d, want %d", tc.cfg, got, tc.want)
 			}
 		})
 	}
 }
+
+func TestRunProtocol_ManyParties(t *testing.T) {
+	fld := field.New(field.Int(1000003))
+
+	for _, nParties := range []int{20, 50} {
+		t.Run(fmt.Sprintf("nParties=%d", nParties), func(t *testing.T) {
+			// The circuit computes x_0 * (x_0 + x_1 + ... + x_{n-1}).
+			var sum gate.Gate = &gate.Input{Party: 0}
+			secrets := [][]*big.Int{field.Ints(1)}
+			for i := 1; i < nParties; i++ {
+				sum = gate.NewAdd(sum, &gate.Input{Party: i})
+				secrets = append(secrets, field.Ints(i+1))
+			}
+			cfg := &config.Config{
+				Secrets: secrets,
+				Field:   fld,
+				Degree:  (nParties - 1) / 2,
+				Circuit: &circuit.Circuit{
+					NParties: nParties,
+					Root:     gate.NewMul(&gate.Input{Party: 0}, sum),
+				},
+			}
+
+			want := field.Ints(nParties * (nParties + 1) / 2)
+			got, err := RunProtocol(context.Background(), cfg)
+			if err != nil {
+				t.Errorf("RunProtocol(%v) failed with %v", cfg, err)
+			} else if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("RunProtocol(%v) = %d, want %d", cfg, got, want)
+			}
+		})
+	}
+}
+
+func TestRunProtocol_Cancelled(t *testing.T) {
+	cfg := &config.Config{
+		Secrets: config.OneEach(field.Ints(1, 2, 3)),
+		Field:   field.New(field.Int(101)),
+		Degree:  1,
+		Circuit: &circuit.Circuit{
+			NParties: 3,
+			Root: gate.NewMul(
+				gate.NewMul(
+					&gate.Input{Party: 0},
+					&gate.Input{Party: 1},
+				),
+				&gate.Input{Party: 2}),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Every party should stop, rather than waiting forever for shares that will never arrive.
+	if got, err := RunProtocol(ctx, cfg); !errors.Is(err, context.Canceled) {
+		t.Errorf("RunProtocol(%v) = %v, %v, want error %v", cfg, got, err, context.Canceled)
+	}
+}
+
+func TestRunProtocol_Beaver(t *testing.T) {
+	for _, dealer := range []bool{true, false} {
+		for circuitNumber := 1; circuitNumber <= 17; circuitNumber++ {
+			t.Run(fmt.Sprintf("dealer=%t/circuit=%d", dealer, circuitNumber), func(t *testing.T) {
+				cfg, err := config.New(defaultPrime, 1, defaultSeed, defaultDegree, defaultDegree, circuitNumber)
+				if err != nil {
+					t.Fatalf("config.New() failed with %v", err)
+				}
+				cfg.Beaver = true
+				cfg.Dealer = dealer
+
+				want, err := cfg.Circuit.ComputeExpected(cfg.Secrets, cfg.Field)
+				if err != nil {
+					t.Fatalf("ComputeExpected() failed with %v", err)
+				}
+				got, err := RunProtocol(context.Background(), cfg)
+				if err != nil {
+					t.Fatalf("RunProtocol(%v) failed with %v", cfg, err)
+				}
+				for i := range want {
+					// Outputs which depend on random gates cannot be predicted.
+					if want[i] != nil && got[i].Cmp(want[i]) != 0 {
+						t.Errorf("RunProtocol(%v) = %d, want %d", cfg, got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestRunProtocol_Optimize(t *testing.T) {
+	for circuitNumber := 1; circuitNumber <= 17; circuitNumber++ {
+		t.Run(fmt.Sprintf("circuit=%d", circuitNumber), func(t *testing.T) {
+			cfg, err := config.New(defaultPrime, 1, defaultSeed, defaultDegree, defaultDegree, circuitNumber)
+			if err != nil {
+				t.Fatalf("config.New() failed with %v", err)
+			}
+			want, err := cfg.Circuit.ComputeExpected(cfg.Secrets, cfg.Field)
+			if err != nil {
+				t.Fatalf("ComputeExpected() failed with %v", err)
+			}
+
+			cfg.Circuit = optimize.Optimize(cfg.Circuit)
+			got, err := RunProtocol(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("RunProtocol(%v) failed with %v", cfg, err)
+			}
+			for i := range want {
+				// Outputs which depend on random gates cannot be predicted.
+				if want[i] != nil && got[i].Cmp(want[i]) != 0 {
+					t.Errorf("RunProtocol(%v) = %d, want %d", cfg, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunProtocol_CircuitFile(t *testing.T) {
+	// bits returns the n bits of v, least significant first, which are the wires of a boolean value.
+	bits := func(v, n int) []*big.Int {
+		res := make([]*big.Int, n, n)
+		for i := range res {
+			res[i] = big.NewInt(int64(v >> i & 1))
+		}
+		return res
+	}
+
+	tests := []struct {
+		path    string
+		secrets [][]*big.Int
+		want    []*big.Int
+	}{{
+		// 200 + 100 = 44 mod 2^8.
+		path:    "../../circuits/adder8.txt",
+		secrets: [][]*big.Int{bits(200, 8), bits(100, 8)},
+		want:    bits(44, 8),
+	}, {
+		path:    "../../circuits/lessthan8.txt",
+		secrets: [][]*big.Int{bits(100, 8), bits(200, 8)},
+		want:    field.Ints(1),
+	}, {
+		path:    "../../circuits/lessthan8.txt",
+		secrets: [][]*big.Int{bits(200, 8), bits(200, 8)},
+		want:    field.Ints(0),
+	}, {
+		// 1*5 + 2*6 + 3*7 + 4*8.
+		path:    "../../circuits/innerproduct4.txt",
+		secrets: [][]*big.Int{field.Ints(1, 2, 3, 4), field.Ints(5, 6, 7, 8)},
+		want:    field.Ints(70),
+	}}
+
+	for _, beaver := range []bool{false, true} {
+		for _, tc := range tests {
+			t.Run(fmt.Sprintf("%s/beaver=%t", tc.path, beaver), func(t *testing.T) {
+				cfg, err := config.NewFromFile(defaultPrime, 1, defaultSeed, defaultDegree, defaultDegree, tc.path)
+				if err != nil {
+					t.Fatalf("config.NewFromFile(%q) failed with %v", tc.path, err)
+				}
+				// The random secrets should be valid inputs to the circuit.
+				if _, err := cfg.Circuit.ComputeExpected(cfg.Secrets, cfg.Field); err != nil {
+					t.Errorf("ComputeExpected() with random secrets failed with %v", err)
+				}
+				cfg.Secrets = tc.secrets
+				cfg.Beaver = beaver
+
+				if got, err := cfg.Circuit.ComputeExpected(cfg.Secrets, cfg.Field); err != nil || fmt.Sprint(got) != fmt.Sprint(tc.want) {
+					t.Errorf("ComputeExpected() = %d, %v, want %d", got, err, tc.want)
+				}
+				got, err := RunProtocol(context.Background(), cfg)
+				if err != nil {
+					t.Fatalf("RunProtocol(%v) failed with %v", cfg, err)
+				}
+				if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+					t.Errorf("RunProtocol(%v) = %d, want %d", cfg, got, tc.want)
+				}
+			})
+		}
+	}
+
+	if _, err := config.NewFromFile(defaultPrime, 1, defaultSeed, defaultDegree, defaultDegree, "missing.txt"); err == nil {
+		t.Errorf("config.NewFromFile(%q) succeeded, want error", "missing.txt")
+	}
+}
+
+func TestRunProtocol_CircuitFiles(t *testing.T) {
+	paths, err := filepath.Glob("../../circuits/*.txt")
+	if err != nil {
+		t.Fatalf("filepath.Glob() failed with %v", err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("filepath.Glob() found no circuit files")
+	}
+
+	// Every circuit file should be evaluated correctly with random secrets.
+	for _, beaver := range []bool{false, true} {
+		for _, path := range paths {
+			t.Run(fmt.Sprintf("%s/beaver=%t", filepath.Base(path), beaver), func(t *testing.T) {
+				cfg, err := config.NewFromFile(defaultPrime, 1, defaultSeed, defaultDegree, defaultDegree, path)
+				if err != nil {
+					t.Fatalf("config.NewFromFile(%q) failed with %v", path, err)
+				}
+				cfg.Beaver = beaver
+
+				want, err := cfg.Circuit.ComputeExpected(cfg.Secrets, cfg.Field)
+				if err != nil {
+					t.Fatalf("ComputeExpected() failed with %v", err)
+				}
+				got, err := RunProtocol(context.Background(), cfg)
+				if err != nil {
+					t.Fatalf("RunProtocol(%v) failed with %v", cfg, err)
+				}
+				if fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Errorf("RunProtocol(%v) = %d, want %d", cfg, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestRunProtocol_Expr(t *testing.T) {
+	src := `input salary @ 0
+input bonus @ 0
+let total = salary + bonus + x1 + x2
+out total = total
+out mean = total / 3
+out product = x1 * x2 - 5`
+	cfg, err := config.NewFromExpr(defaultPrime, 1, defaultSeed, defaultDegree, defaultDegree, src)
+	if err != nil {
+		t.Fatalf("config.NewFromExpr(%q) failed with %v", src, err)
+	}
+	cfg.Secrets = [][]*big.Int{field.Ints(10, 5), field.Ints(20), field.Ints(25)}
+	// 20 * 25 - 5 = 495, which is 91 mod 101.
+	want := field.Ints(60, 20, 91)
+
+	got, err := RunProtocol(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("RunProtocol(%v) failed with %v", cfg, err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("RunProtocol(%v) = %d, want %d", cfg, got, want)
+	}
+
+	if _, err := config.NewFromExpr(defaultPrime, 1, defaultSeed, defaultDegree, defaultDegree, "out = x0 +"); err == nil {
+		t.Errorf("config.NewFromExpr(%q) succeeded, want error", "out = x0 +")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"github.com/sonjoonho/bgw/pkg/party"
+	"github.com/sonjoonho/bgw/pkg/transport"
+	"net"
+	"strings"
+)
+
+var (
+	partyId int
+	peers   string
+	tlsDir  string
+)
+
+// runParty runs a single party in this process, which communicates with the other parties over TCP. args are the
+// command line arguments following "party".
+func runParty(args []string) {
+	fs := flag.NewFlagSet("party", flag.ExitOnError)
+	registerFlags(fs)
+	fs.IntVar(&partyId, "id", 0, "Id of the party run by this process, starting from 0.")
+	fs.StringVar(&peers, "peers", "", "Comma-separated host:port addresses of every party, ordered by id. This party listens on the address at index id.")
+	fs.StringVar(&tlsDir, "tls-dir", "", "Directory containing certificates generated by the certs command. If set, connections between parties use mutually authenticated TLS.")
+	fs.Parse(args)
+
+	cfg := newConfig()
+	if cfg.Dealer {
+		// There is no trusted party to deal triples when every party runs in its own process.
+		logger.Fatal("-dealer is not supported in party mode")
+	}
+
+	addrs := strings.Split(peers, ",")
+	if nAddrs, nParties := len(addrs), cfg.Circuit.NParties; nAddrs != nParties {
+		logger.Fatalf("Number of peers (%d) does not match number of parties (%d)", nAddrs, nParties)
+	}
+	if partyId < 0 || partyId >= len(addrs) {
+		logger.Fatalf("id=%d is out of range for %d parties", partyId, len(addrs))
+	}
+
+	listener, err := net.Listen("tcp", addrs[partyId])
+	if err != nil {
+		logger.Fatalf("Failed to listen on %s: %v", addrs[partyId], err)
+	}
+
+	logger.Printf("Connecting to peers %v...", addrs)
+	var t *transport.TCP
+	if tlsDir != "" {
+		tlsConfig, err := loadTLSConfig(tlsDir, partyId)
+		if err != nil {
+			logger.Fatalf("Failed to load TLS configuration: %v", err)
+		}
+		t, err = transport.NewTLS(partyId, listener, addrs, tlsConfig)
+	} else {
+		t, err = transport.NewTCP(partyId, listener, addrs)
+	}
+	if err != nil {
+		logger.Fatalf("Failed to connect: %v", err)
+	}
+
+	p := party.New(partyId, cfg.Secrets[partyId], cfg.Circuit, cfg.Field, cfg.Degree, t)
+	if cfg.ErrorCorrection {
+		p.EnableErrorCorrection()
+	}
+	if cfg.Beaver {
+		p.UseBeaverTriples(nil)
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	actual, err := p.Run(ctx)
+	if err != nil {
+		logger.Fatalf("Protocol failed: %v", err)
+	}
+	if err := t.Close(); err != nil {
+		logger.Printf("Failed to close connections: %v", err)
+	}
+
+	checkOutput(cfg, actual)
+}
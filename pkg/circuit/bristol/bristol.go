@@ -0,0 +1,305 @@
+// Package bristol parses circuits in Bristol Fashion, the format of the standard MPC benchmark circuits.
+// See https://homes.esat.kuleuven.be/~nsmart/MPC/.
+//
+// A file starts with a header giving the number of gates and wires, then the number of input values followed by the
+// number of wires in each, then the same for the output values. Each following line is a gate, given as the number of
+// input and output wires, the input wires, the output wires and the operation, e.g. "2 1 0 1 2 XOR". The input values
+// are the first wires, in order, and the output values are the last wires.
+//
+// Boolean circuits use the XOR, AND, INV and MAND gates. Arithmetic circuits are written in the same format using the
+// ADD, SUB, MUL and NEG gates. EQ assigns a constant to a wire and EQW copies a wire in either kind of circuit, but a
+// circuit cannot mix boolean and arithmetic gates.
+package bristol
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MaxInputWires is the largest number of input wires that a circuit can have, in all of its input values. Each is an
+// input gate, so this limits the gates which are allocated for a file before its gates are built. The standard
+// benchmark circuits have a few thousand at most.
+const MaxInputWires = 1 << 16
+
+// instruction is a gate of a Bristol Fashion file.
+type instruction struct {
+	// line is the line number of the gate, for error messages.
+	line int
+	op   string
+	ins  []int
+	outs []int
+}
+
+// ParseFile parses the Bristol Fashion circuit in the file at path.
+func ParseFile(path string) (*circuit.Circuit, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses a Bristol Fashion circuit. Input value i is the input of party i, and wire j of it is its input with
+// index j. In a boolean circuit, these are converted to the binary field using gate.ToBinary, so each must be a bit.
+// Each output wire is an output of the circuit, named after its output value, and output wire j of value i is named
+// "output i[j]" if the value has more than one wire.
+func Parse(r io.Reader) (*circuit.Circuit, error) {
+	scanner := bufio.NewScanner(r)
+	// lines are the fields of every non-empty line, and lineNumbers are their line numbers.
+	var lines [][]string
+	var lineNumbers []int
+	for n := 1; scanner.Scan(); n++ {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			lines = append(lines, fields)
+			lineNumbers = append(lineNumbers, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) < 3 {
+		return nil, fmt.Errorf("missing header, want the number of gates and wires, inputs and outputs")
+	}
+
+	// 1. Parse the header.
+	header, err := parseInts(lines[0])
+	if err != nil || len(header) != 2 {
+		return nil, fmt.Errorf("line %d: want the number of gates and the number of wires", lineNumbers[0])
+	}
+	nGates, nWires := header[0], header[1]
+	inputs, err := parseCounts(lines[1])
+	if err != nil {
+		return nil, fmt.Errorf("line %d: inputs: %v", lineNumbers[1], err)
+	}
+	outputs, err := parseCounts(lines[2])
+	if err != nil {
+		return nil, fmt.Errorf("line %d: outputs: %v", lineNumbers[2], err)
+	}
+	if got := len(lines) - 3; got != nGates {
+		return nil, fmt.Errorf("found %d gates, but the header gives %d", got, nGates)
+	}
+	// The input and output values are checked against the number of wires before any wires are allocated.
+	nInputWires := 0
+	for _, n := range inputs {
+		if n > MaxInputWires-nInputWires {
+			return nil, fmt.Errorf("the inputs have more than %d wires", MaxInputWires)
+		}
+		nInputWires += n
+	}
+	if nInputWires > nWires {
+		return nil, fmt.Errorf("the inputs need more than %d wires", nWires)
+	}
+	nOutputWires := 0
+	for _, n := range outputs {
+		if n > nWires-nInputWires-nOutputWires {
+			return nil, fmt.Errorf("the inputs and outputs need more than %d wires", nWires)
+		}
+		nOutputWires += n
+	}
+
+	// 2. Parse each gate, and find out whether the circuit is boolean.
+	instructions := make([]instruction, nGates, nGates)
+	var boolean, arithmetic *instruction
+	for i, fields := range lines[3:] {
+		inst, err := parseInstruction(fields, nWires)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumbers[i+3], err)
+		}
+		inst.line = lineNumbers[i+3]
+		instructions[i] = inst
+		switch inst.op {
+		case "XOR", "AND", "INV", "MAND":
+			boolean = &instructions[i]
+		case "ADD", "SUB", "MUL", "NEG":
+			arithmetic = &instructions[i]
+		}
+	}
+	if boolean != nil && arithmetic != nil {
+		return nil, fmt.Errorf("line %d: %s gate in a boolean circuit, since there is a %s gate on line %d", arithmetic.line, arithmetic.op, boolean.op, boolean.line)
+	}
+	isBoolean := boolean != nil
+
+	// 3. Assign the input wires. Every wire is either an input wire or an output of a gate, so the number of wires is at
+	//    most the number that the file assigns.
+	assigned := nInputWires
+	for _, inst := range instructions {
+		assigned += len(inst.outs)
+	}
+	if assigned < nWires {
+		return nil, fmt.Errorf("the header gives %d wires, but the inputs and gates only assign %d", nWires, assigned)
+	}
+	wires := make([]gate.Gate, nWires, nWires)
+	w := 0
+	for party, n := range inputs {
+		for index := 0; index < n; index++ {
+			var in gate.Gate = &gate.Input{Party: party, Index: index}
+			if isBoolean {
+				in = gate.NewToBinary(in)
+			}
+			wires[w] = in
+			w++
+		}
+	}
+
+	// 4. Build each gate from wires which have already been assigned.
+	for _, inst := range instructions {
+		ins := make([]gate.Gate, len(inst.ins), len(inst.ins))
+		for k, wire := range inst.ins {
+			if inst.op == "EQ" {
+				// The input of EQ is a constant rather than a wire.
+				break
+			}
+			if wires[wire] == nil {
+				return nil, fmt.Errorf("line %d: wire %d is used before it is assigned", inst.line, wire)
+			}
+			ins[k] = wires[wire]
+		}
+
+		var outs []gate.Gate
+		switch inst.op {
+		case "XOR":
+			outs = []gate.Gate{gate.NewXor(ins[0], ins[1])}
+		case "AND":
+			outs = []gate.Gate{gate.NewAnd(ins[0], ins[1])}
+		case "INV":
+			outs = []gate.Gate{gate.NewNot(ins[0])}
+		case "MAND":
+			// The first half of the inputs are ANDed with the second half.
+			half := len(ins) / 2
+			for k := 0; k < half; k++ {
+				outs = append(outs, gate.NewAnd(ins[k], ins[half+k]))
+			}
+		case "ADD":
+			outs = []gate.Gate{gate.NewAdd(ins[0], ins[1])}
+		case "SUB":
+			outs = []gate.Gate{gate.NewSub(ins[0], ins[1])}
+		case "MUL":
+			outs = []gate.Gate{gate.NewMul(ins[0], ins[1])}
+		case "NEG":
+			outs = []gate.Gate{gate.NewNeg(ins[0])}
+		case "EQ":
+			out := gate.NewConst(big.NewInt(int64(inst.ins[0])))
+			if isBoolean {
+				if inst.ins[0] > 1 {
+					return nil, fmt.Errorf("line %d: constant %d is not a bit", inst.line, inst.ins[0])
+				}
+				out = gate.NewToBinary(out)
+			}
+			outs = []gate.Gate{out}
+		case "EQW":
+			outs = []gate.Gate{ins[0]}
+		}
+
+		for k, wire := range inst.outs {
+			if wires[wire] != nil {
+				return nil, fmt.Errorf("line %d: wire %d is assigned more than once", inst.line, wire)
+			}
+			wires[wire] = outs[k]
+		}
+	}
+
+	// 5. The output values are the last wires.
+	c := &circuit.Circuit{NParties: len(inputs)}
+	w = nWires - nOutputWires
+	for i, n := range outputs {
+		for j := 0; j < n; j++ {
+			if wires[w] == nil {
+				return nil, fmt.Errorf("output wire %d is never assigned", w)
+			}
+			name := fmt.Sprintf("output %d", i)
+			if n > 1 {
+				name = fmt.Sprintf("output %d[%d]", i, j)
+			}
+			c.Outputs = append(c.Outputs, circuit.Output{Name: name, Gate: wires[w]})
+			w++
+		}
+	}
+
+	return c, nil
+}
+
+// parseInstruction parses the fields of a gate, checking that its wires are less than nWires. The input of an EQ gate
+// is the constant which it assigns.
+func parseInstruction(fields []string, nWires int) (instruction, error) {
+	if len(fields) < 3 {
+		return instruction{}, fmt.Errorf("want the number of inputs and outputs, the wires and the operation")
+	}
+	op := fields[len(fields)-1]
+	counts, err := parseInts(fields[:2])
+	if err != nil {
+		return instruction{}, err
+	}
+	nIn, nOut := counts[0], counts[1]
+	wires, err := parseInts(fields[2 : len(fields)-1])
+	if err != nil {
+		return instruction{}, err
+	}
+	if len(wires) != nIn+nOut {
+		return instruction{}, fmt.Errorf("%s gate has %d wires, want %d inputs and %d outputs", op, len(wires), nIn, nOut)
+	}
+
+	var wantIn, wantOut int
+	switch op {
+	case "XOR", "AND", "ADD", "SUB", "MUL":
+		wantIn, wantOut = 2, 1
+	case "INV", "NEG", "EQ", "EQW":
+		wantIn, wantOut = 1, 1
+	case "MAND":
+		wantIn, wantOut = 2*nOut, nOut
+	default:
+		return instruction{}, fmt.Errorf("unsupported gate %q", op)
+	}
+	if nIn != wantIn || nOut != wantOut {
+		return instruction{}, fmt.Errorf("%s gate has %d inputs and %d outputs, want %d and %d", op, nIn, nOut, wantIn, wantOut)
+	}
+
+	for k, wire := range wires {
+		// The input of EQ is a constant, so it is not a wire.
+		if op == "EQ" && k == 0 {
+			continue
+		}
+		if wire >= nWires {
+			return instruction{}, fmt.Errorf("wire %d is out of range, since there are %d wires", wire, nWires)
+		}
+	}
+
+	return instruction{op: op, ins: wires[:nIn], outs: wires[nIn:]}, nil
+}
+
+// parseCounts parses a line which gives a number of values followed by the number of wires in each.
+func parseCounts(fields []string) ([]int, error) {
+	ns, err := parseInts(fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(ns) == 0 || ns[0] != len(ns)-1 {
+		return nil, fmt.Errorf("want the number of values followed by the number of wires in each")
+	}
+	return ns[1:], nil
+}
+
+// parseInts parses each of fields as a non-negative integer.
+func parseInts(fields []string) ([]int, error) {
+	ns := make([]int, len(fields), len(fields))
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%q is not a non-negative integer", f)
+		}
+		ns[i] = n
+	}
+	return ns, nil
+}
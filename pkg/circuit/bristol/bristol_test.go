@@ -0,0 +1,168 @@
+package bristol
+
+import (
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/field"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	fld := field.New(field.Int(101))
+
+	tests := []struct {
+		name     string
+		src      string
+		secrets  [][]*big.Int
+		wantName []string
+		want     []*big.Int
+	}{{
+		// A full adder, with the sum and carry as one output value.
+		name: "Boolean",
+		src: `5 8
+3 1 1 1
+1 2
+
+2 1 0 1 3 XOR
+2 1 3 2 6 XOR
+2 1 0 1 4 AND
+2 1 3 2 5 AND
+2 1 4 5 7 XOR
+`,
+		secrets:  [][]*big.Int{field.Ints(1), field.Ints(0), field.Ints(1)},
+		wantName: []string{"output 0[0]", "output 0[1]"},
+		want:     field.Ints(0, 1),
+	}, {
+		name: "MAND, INV, EQ and EQW",
+		src: `4 8
+2 2 1
+2 2 1
+
+1 1 1 3 EQ
+1 1 2 4 INV
+4 2 0 1 3 2 5 6 MAND
+1 1 4 7 EQW
+`,
+		secrets:  [][]*big.Int{field.Ints(1, 1), field.Ints(1)},
+		wantName: []string{"output 0[0]", "output 0[1]", "output 1"},
+		want:     field.Ints(1, 1, 0),
+	}, {
+		name: "Arithmetic",
+		src: `4 7
+2 2 1
+1 1
+
+2 1 0 1 3 MUL
+1 1 2 4 NEG
+2 1 3 4 5 ADD
+2 1 5 0 6 SUB
+`,
+		// 7 * 5 - 3 - 7.
+		secrets:  [][]*big.Int{field.Ints(7, 5), field.Ints(3)},
+		wantName: []string{"output 0"},
+		want:     field.Ints(25),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Parse(strings.NewReader(tc.src))
+			if err != nil {
+				t.Fatalf("Parse() failed with %v", err)
+			}
+			if got, want := c.NParties, len(tc.secrets); got != want {
+				t.Errorf("Parse().NParties = %d, want %d", got, want)
+			}
+			for i, out := range c.OutputGates() {
+				if i < len(tc.wantName) && out.Name != tc.wantName[i] {
+					t.Errorf("Parse().OutputGates()[%d].Name = %q, want %q", i, out.Name, tc.wantName[i])
+				}
+			}
+			if got, err := c.ComputeExpected(tc.secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("Parse().ComputeExpected(%v) = %d, %v, want %d", tc.secrets, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{{
+		name:    "Missing header",
+		src:     "1 3\n2 1 1\n",
+		wantErr: "missing header",
+	}, {
+		name:    "Wrong number of gates",
+		src:     "2 3\n2 1 1\n1 1\n2 1 0 1 2 XOR\n",
+		wantErr: "found 1 gates",
+	}, {
+		name:    "Wrong number of input values",
+		src:     "1 3\n3 1 1\n1 1\n2 1 0 1 2 XOR\n",
+		wantErr: "line 2",
+	}, {
+		name:    "Unsupported gate",
+		src:     "1 3\n2 1 1\n1 1\n2 1 0 1 2 OR\n",
+		wantErr: `line 4: unsupported gate "OR"`,
+	}, {
+		name:    "Wrong number of wires",
+		src:     "1 3\n2 1 1\n1 1\n2 1 0 2 XOR\n",
+		wantErr: "line 4",
+	}, {
+		name:    "Wire out of range",
+		src:     "1 3\n2 1 1\n1 1\n2 1 0 1 3 XOR\n",
+		wantErr: "wire 3 is out of range",
+	}, {
+		name:    "Wire used before it is assigned",
+		src:     "2 4\n2 1 1\n1 1\n2 1 0 2 3 XOR\n2 1 0 1 2 AND\n",
+		wantErr: "line 4: wire 2 is used before it is assigned",
+	}, {
+		name:    "Wire assigned twice",
+		src:     "2 3\n2 1 1\n1 1\n2 1 0 1 2 XOR\n2 1 0 1 2 AND\n",
+		wantErr: "line 5: wire 2 is assigned more than once",
+	}, {
+		name:    "Boolean and arithmetic gates",
+		src:     "2 4\n2 1 1\n1 1\n2 1 0 1 2 XOR\n2 1 0 1 3 ADD\n",
+		wantErr: "line 5: ADD gate in a boolean circuit",
+	}, {
+		name:    "Constant which is not a bit",
+		src:     "2 4\n2 1 1\n1 1\n1 1 2 2 EQ\n2 1 0 2 3 XOR\n",
+		wantErr: "constant 2 is not a bit",
+	}, {
+		name:    "Unassigned wire",
+		src:     "1 4\n2 1 1\n1 1\n2 1 0 1 2 XOR\n",
+		wantErr: "the header gives 4 wires, but the inputs and gates only assign 3",
+	}, {
+		// The wires are checked before they are allocated.
+		name:    "Too many wires",
+		src:     "1 1000000000000\n2 1 1\n1 1\n2 1 0 1 2 XOR\n",
+		wantErr: "the header gives 1000000000000 wires, but the inputs and gates only assign 3",
+	}, {
+		name:    "Too many input wires",
+		src:     "1 3\n2 2 2\n1 1\n2 1 0 1 2 XOR\n",
+		wantErr: "the inputs need more than 3 wires",
+	}, {
+		name:    "Too many input wires in a value",
+		src:     "0 20000000\n1 20000000\n1 1\n",
+		wantErr: "the inputs have more than 65536 wires",
+	}, {
+		// The outputs are checked before the input wires are allocated.
+		name:    "Too many output wires",
+		src:     "0 60000\n1 60000\n1 1\n",
+		wantErr: "the inputs and outputs need more than 60000 wires",
+	}, {
+		name:    "No output values",
+		src:     "0 2\n1 3\n0\n",
+		wantErr: "the inputs need more than 2 wires",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tc.src)); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Parse() = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
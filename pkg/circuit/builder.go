@@ -0,0 +1,217 @@
+package circuit
+
+import (
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"math/big"
+)
+
+// Wire is a handle to the output of a gate in a circuit being built by a Builder. The zero Wire is not valid.
+type Wire struct {
+	b *Builder
+	g gate.Gate
+}
+
+// Builder builds a circuit one gate at a time, e.g.
+//
+//	b := circuit.NewBuilder(3)
+//	x, y, z := b.Input(0), b.Input(1), b.Input(2)
+//	b.Output(b.Add(b.Mul(x, y), z))
+//	c, err := b.Build()
+//
+// It validates each call as it goes. The first error is recorded, every later call has no effect, and the error is
+// returned by Build. This means that a circuit can be built without checking for errors after each call.
+type Builder struct {
+	nParties int
+	// nInputs are the number of inputs of each party which have been created.
+	nInputs []int
+	// gates are the gates which have been created, in order.
+	gates   []gate.Gate
+	outputs []Output
+	err     error
+}
+
+// NewBuilder returns a Builder for a circuit with nParties parties.
+func NewBuilder(nParties int) *Builder {
+	b := &Builder{nParties: nParties}
+	if nParties < 1 {
+		b.err = fmt.Errorf("NewBuilder(%d): number of parties must be positive", nParties)
+		return b
+	}
+	b.nInputs = make([]int, nParties, nParties)
+	return b
+}
+
+// fail records an error for the call op, unless one has already been recorded.
+func (b *Builder) fail(op string, format string, a ...interface{}) {
+	if b.err == nil {
+		b.err = fmt.Errorf("%s: %s", op, fmt.Sprintf(format, a...))
+	}
+}
+
+// check records an error for the call op if any of wires was not created by b, and returns whether they were all valid.
+func (b *Builder) check(op string, wires ...Wire) bool {
+	if b.err != nil {
+		return false
+	}
+	for i, w := range wires {
+		if w.g == nil {
+			b.fail(op, "wire %d is not valid", i)
+			return false
+		}
+		if w.b != b {
+			b.fail(op, "wire %d was created by a different Builder", i)
+			return false
+		}
+	}
+	return true
+}
+
+// add records g as a new gate, and returns its wire.
+func (b *Builder) add(g gate.Gate) Wire {
+	b.gates = append(b.gates, g)
+	return Wire{b: b, g: g}
+}
+
+// Input returns the next input of party, whose index is the number of inputs of party created before it.
+func (b *Builder) Input(party int) Wire {
+	if !b.check("Input") {
+		return Wire{}
+	}
+	if party < 0 || party >= b.nParties {
+		b.fail("Input", "party %d is out of range, since there are %d parties", party, b.nParties)
+		return Wire{}
+	}
+	index := b.nInputs[party]
+	b.nInputs[party]++
+	return b.add(&gate.Input{Party: party, Index: index})
+}
+
+// Const returns a public constant.
+func (b *Builder) Const(value *big.Int) Wire {
+	if !b.check("Const") {
+		return Wire{}
+	}
+	return b.add(gate.NewConst(value))
+}
+
+// Add returns the sum of x and y.
+func (b *Builder) Add(x, y Wire) Wire {
+	if !b.check("Add", x, y) {
+		return Wire{}
+	}
+	return b.add(gate.NewAdd(x.g, y.g))
+}
+
+// Sub returns the difference of x and y.
+func (b *Builder) Sub(x, y Wire) Wire {
+	if !b.check("Sub", x, y) {
+		return Wire{}
+	}
+	return b.add(gate.NewSub(x.g, y.g))
+}
+
+// Mul returns the product of x and y.
+func (b *Builder) Mul(x, y Wire) Wire {
+	if !b.check("Mul", x, y) {
+		return Wire{}
+	}
+	return b.add(gate.NewMul(x.g, y.g))
+}
+
+// Neg returns the negation of x.
+func (b *Builder) Neg(x Wire) Wire {
+	if !b.check("Neg", x) {
+		return Wire{}
+	}
+	return b.add(gate.NewNeg(x.g))
+}
+
+// Sum returns the sum of wires, which must not be empty.
+func (b *Builder) Sum(wires ...Wire) Wire {
+	return b.tree("Sum", wires, b.Add)
+}
+
+// Product returns the product of wires, which must not be empty. The multiplications form a balanced tree, so the
+// multiplicative depth is logarithmic in the number of wires.
+func (b *Builder) Product(wires ...Wire) Wire {
+	return b.tree("Product", wires, b.Mul)
+}
+
+// tree combines wires pairwise using combine, level by level, so that they form a balanced tree.
+func (b *Builder) tree(op string, wires []Wire, combine func(x, y Wire) Wire) Wire {
+	if !b.check(op, wires...) {
+		return Wire{}
+	}
+	if len(wires) == 0 {
+		b.fail(op, "no wires")
+		return Wire{}
+	}
+	for len(wires) > 1 {
+		var next []Wire
+		for i := 0; i+1 < len(wires); i += 2 {
+			next = append(next, combine(wires[i], wires[i+1]))
+		}
+		// An odd wire out is carried over to the next level.
+		if len(wires)%2 == 1 {
+			next = append(next, wires[len(wires)-1])
+		}
+		wires = next
+	}
+	return wires[0]
+}
+
+// Output reveals w to every party, as an output named DefaultOutputName.
+func (b *Builder) Output(w Wire) {
+	b.NamedOutput(DefaultOutputName, w)
+}
+
+// NamedOutput reveals w as an output named name. If recipients are given, only those parties learn it.
+func (b *Builder) NamedOutput(name string, w Wire, recipients ...int) {
+	if !b.check("Output", w) {
+		return
+	}
+	for _, o := range b.outputs {
+		if o.Name == name {
+			b.fail("Output", "output %q already exists", name)
+			return
+		}
+	}
+	for _, r := range recipients {
+		if r < 0 || r >= b.nParties {
+			b.fail("Output", "recipient %d is out of range, since there are %d parties", r, b.nParties)
+			return
+		}
+	}
+	b.outputs = append(b.outputs, Output{Name: name, Gate: w.g, Recipients: recipients})
+}
+
+// Build returns the circuit, or the first error recorded by the Builder. It is also an error if there are no outputs,
+// or if any wire is dangling, that is, not used by any output.
+func (b *Builder) Build() (*Circuit, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.outputs) == 0 {
+		return nil, fmt.Errorf("Build: circuit has no outputs")
+	}
+
+	c := &Circuit{NParties: b.nParties}
+	if len(b.outputs) == 1 && b.outputs[0].Name == DefaultOutputName && len(b.outputs[0].Recipients) == 0 {
+		c.Root = b.outputs[0].Gate
+	} else {
+		c.Outputs = b.outputs
+	}
+
+	used := make(map[gate.Gate]bool)
+	for _, g := range c.Traverse() {
+		used[g] = true
+	}
+	for i, g := range b.gates {
+		if !used[g] {
+			return nil, fmt.Errorf("Build: wire %d (%s) is dangling, since it is not used by any output", i, g.Type())
+		}
+	}
+
+	return c, nil
+}
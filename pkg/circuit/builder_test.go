@@ -0,0 +1,129 @@
+package circuit
+
+import (
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/field"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	fld := field.New(field.Int(101))
+	secrets := [][]*big.Int{field.Ints(2, 10), field.Ints(3), field.Ints(4), field.Ints(5), field.Ints(6)}
+
+	b := NewBuilder(5)
+	in := []Wire{b.Input(0), b.Input(1), b.Input(2), b.Input(3), b.Input(4)}
+	// The second input of party 0 has index 1.
+	extra := b.Input(0)
+	product := b.Product(in...)
+	sum := b.Sum(in...)
+	b.NamedOutput("product", product)
+	b.NamedOutput("sum", sum, 0)
+	b.NamedOutput("difference", b.Sub(b.Neg(sum), b.Mul(extra, b.Const(field.Int(2)))))
+
+	c, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() failed with %v", err)
+	}
+	// 2 * 3 * 4 * 5 * 6 = 720, which is 13 mod 101, and -20 - 20 = -40, which is 61.
+	want := field.Ints(13, 20, 61)
+	if got, err := c.ComputeExpected(secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Build().ComputeExpected(%v) = %d, %v, want %d", secrets, got, err, want)
+	}
+	if got, want := c.NInputs(), []int{2, 1, 1, 1, 1}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Build().NInputs() = %v, want %v", got, want)
+	}
+	if got := c.Outputs[1].Recipients; fmt.Sprint(got) != "[0]" {
+		t.Errorf("Build().Outputs[1].Recipients = %v, want [0]", got)
+	}
+	// The product of 5 wires is a balanced tree, with a multiplicative depth of 3.
+	if got, want := len(c.Layers())-1, 3; got != want {
+		t.Errorf("Build() has multiplicative depth %d, want %d", got, want)
+	}
+}
+
+func TestBuilder_Root(t *testing.T) {
+	b := NewBuilder(2)
+	b.Output(b.Add(b.Input(0), b.Input(1)))
+	c, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() failed with %v", err)
+	}
+	if c.Root == nil || c.Outputs != nil {
+		t.Errorf("Build() = %+v, want a circuit with only a Root", c)
+	}
+}
+
+func TestBuilder_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(b *Builder)
+		wantErr string
+	}{{
+		name:    "Party out of range",
+		build:   func(b *Builder) { b.Output(b.Add(b.Input(0), b.Input(2))) },
+		wantErr: "Input: party 2 is out of range, since there are 2 parties",
+	}, {
+		name:    "Invalid wire",
+		build:   func(b *Builder) { b.Output(b.Add(b.Input(0), Wire{})) },
+		wantErr: "Add: wire 1 is not valid",
+	}, {
+		name: "Wire from a different builder",
+		build: func(b *Builder) {
+			other := NewBuilder(2)
+			b.Output(b.Mul(b.Input(0), other.Input(1)))
+		},
+		wantErr: "Mul: wire 1 was created by a different Builder",
+	}, {
+		name:    "Empty product",
+		build:   func(b *Builder) { b.Output(b.Product()) },
+		wantErr: "Product: no wires",
+	}, {
+		name: "Duplicate output",
+		build: func(b *Builder) {
+			x := b.Input(0)
+			b.NamedOutput("x", x)
+			b.NamedOutput("x", x)
+		},
+		wantErr: `Output: output "x" already exists`,
+	}, {
+		name:    "Recipient out of range",
+		build:   func(b *Builder) { b.NamedOutput("x", b.Input(0), 1, 2) },
+		wantErr: "Output: recipient 2 is out of range",
+	}, {
+		name: "Dangling wire",
+		build: func(b *Builder) {
+			x, y := b.Input(0), b.Input(1)
+			b.Mul(x, y)
+			b.Output(b.Add(x, y))
+		},
+		wantErr: "Build: wire 2 (MUL) is dangling",
+	}, {
+		name:    "No outputs",
+		build:   func(b *Builder) { b.Input(0) },
+		wantErr: "Build: circuit has no outputs",
+	}, {
+		// Only the first error is reported.
+		name: "Several errors",
+		build: func(b *Builder) {
+			b.Input(-1)
+			b.Output(b.Sum())
+		},
+		wantErr: "Input: party -1 is out of range",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewBuilder(2)
+			tc.build(b)
+			if c, err := b.Build(); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Build() = %v, %v, want error containing %q", c, err, tc.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewBuilder(0).Build(); err == nil {
+		t.Errorf("NewBuilder(0).Build() succeeded, want error")
+	}
+}
@@ -2,74 +2,345 @@
 package circuit
 
 import (
+	"errors"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/field"
 	"github.com/sonjoonho/bgw/pkg/gate"
+	"math/big"
 )
 
-// Circuit represents an arithmetic circuit to be computed by parties. It is not thread safe -- each Goroutine should be
-// given a copy.
+// Circuit represents an arithmetic circuit to be computed by parties. The gates form a directed acyclic graph, so the
+// output of a gate may be the input to several other gates. Its methods only read the circuit, so it can be copied by
+// several Goroutines at once, but evaluating it sets the outputs of its gates -- each Goroutine should be given a copy.
 type Circuit struct {
-	// Root is the output gate of the circuit.
+	// Root is the output gate of a circuit with a single output. It is ignored if Outputs is set.
 	Root gate.Gate
+	// Outputs are the named output gates of a circuit with several outputs.
+	Outputs []Output
 	// NParties is the number of parties that have inputs in this circuit.
 	NParties int
-	// gates are the gates of this circuit, ordered linearly in the order which they should be processed. It is lazily
-	// initialised.
-	gates []gate.Gate
 }
 
-// Copy makes a deep copy of this Circuit.
+// Output is a named output of a circuit.
+type Output struct {
+	// Name identifies the output, e.g. in logs.
+	Name string
+	// Gate is the gate whose output is revealed.
+	Gate gate.Gate
+	// Recipients are the ids of the parties which learn the output. If it is empty, every party learns the output.
+	Recipients []int
+}
+
+// ReceivedBy returns whether the party with the specified id learns this output.
+func (o Output) ReceivedBy(party int) bool {
+	if len(o.Recipients) == 0 {
+		return true
+	}
+	for _, r := range o.Recipients {
+		if r == party {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultOutputName is the name of the output of a circuit which only specifies a Root.
+const DefaultOutputName = "output"
+
+// OutputGates returns the outputs of the circuit, in order. If Outputs is not set, this is Root with the name
+// DefaultOutputName.
+func (c *Circuit) OutputGates() []Output {
+	if len(c.Outputs) > 0 {
+		return c.Outputs
+	}
+	return []Output{{Name: DefaultOutputName, Gate: c.Root}}
+}
+
+// Copy makes a deep copy of this Circuit. Gates which are shared by several other gates are copied once, so the copy
+// has the same structure as this Circuit.
 func (c *Circuit) Copy() *Circuit {
+	copies := make(map[gate.Gate]gate.Gate)
+	for _, g := range c.Traverse() {
+		// Traverse orders each gate after its inputs, so they have already been copied.
+		var first, second gate.Gate
+		if g.First() != nil {
+			first = copies[g.First()]
+		}
+		if g.Second() != nil {
+			second = copies[g.Second()]
+		}
+		copies[g] = g.Copy(first, second)
+	}
+
+	var outputs []Output
+	for _, out := range c.Outputs {
+		recipients := append([]int(nil), out.Recipients...)
+		outputs = append(outputs, Output{Name: out.Name, Gate: copies[out.Gate], Recipients: recipients})
+	}
+
 	return &Circuit{
-		Root:     c.Root.Copy(),
+		Root:     copies[c.Root],
+		Outputs:  outputs,
 		NParties: c.NParties,
 	}
 }
 
-// Traverse traverses the circuit and returns the gates in order. This must be deterministic so that each party receives
-//gates with matching indexes.
+// Traverse traverses the circuit from each of its outputs in turn, and returns the gates in order. Every gate appears
+// exactly once, after the gates that it depends on, even if it is the input to several other gates or outputs. This
+// must be deterministic so that each party receives gates with matching indexes. The order is computed on each call,
+// rather than cached, so that Traverse does not modify the circuit.
 func (c *Circuit) Traverse() []gate.Gate {
-	if c.gates != nil {
-		return c.gates
+	// This is an iterative post-order depth-first search, so that deep circuits do not overflow the call stack. A
+	// gate is added to the result once both of its inputs have been.
+	visited := make(map[gate.Gate]bool)
+	// Push the outputs in reverse, so that the first output is visited first.
+	outputs := c.OutputGates()
+	stack := make([]gate.Gate, len(outputs), len(outputs))
+	for i, out := range outputs {
+		stack[len(outputs)-1-i] = out.Gate
 	}
-
-	stack := []gate.Gate{c.Root}
 	var res []gate.Gate
 
 	for len(stack) > 0 {
-		var next gate.Gate
-		stack, next = pop(stack)
-		res = append([]gate.Gate{next}, res...)
-		if next.First() != nil {
-			stack = append(stack, next.First())
+		next := peek(stack)
+		if visited[next] {
+			stack, _ = pop(stack)
+			continue
 		}
-		if next.Second() != nil {
-			stack = append(stack, next.Second())
+
+		// Push the second input first, so that the first input is visited first.
+		pending := false
+		for _, in := range []gate.Gate{next.Second(), next.First()} {
+			if in != nil && !visited[in] {
+				stack = append(stack, in)
+				pending = true
+			}
+		}
+		if pending {
+			continue
 		}
-	}
 
-	c.gates = res
+		stack, _ = pop(stack)
+		visited[next] = true
+		res = append(res, next)
+	}
 
 	return res
 }
 
-// ComputeExpected recursively evaluates the circuit using secrets as input and returns the expected value.
-func (c *Circuit) ComputeExpected(secrets []int) int {
-	return eval(c.Root, secrets)
+// Layers groups the gates of the circuit by their multiplicative depth, which is the largest number of multiplication
+// gates on any path from an input to the gate (including the gate itself). Layer d starts with the multiplication gates
+// of depth d, none of which depend on each other so they can be evaluated together, followed by the other gates of
+// depth d. Within each of these groups, gates are in the order returned by Traverse, so every gate comes after the
+// gates that it depends on.
+func (c *Circuit) Layers() [][]gate.Gate {
+	depths := make(map[gate.Gate]int)
+	var muls, others [][]gate.Gate
+	for _, g := range c.Traverse() {
+		depth := 0
+		if fst := g.First(); fst != nil {
+			depth = depths[fst]
+		}
+		if snd := g.Second(); snd != nil && depths[snd] > depth {
+			depth = depths[snd]
+		}
+		if isMul(g) {
+			depth++
+		}
+		depths[g] = depth
+
+		for len(muls) <= depth {
+			muls = append(muls, nil)
+			others = append(others, nil)
+		}
+		if isMul(g) {
+			muls[depth] = append(muls[depth], g)
+		} else {
+			others[depth] = append(others[depth], g)
+		}
+	}
+
+	layers := make([][]gate.Gate, len(muls), len(muls))
+	for depth := range layers {
+		layers[depth] = append(muls[depth], others[depth]...)
+	}
+	return layers
+}
+
+// isMul returns whether g is a multiplication in either the prime or the binary field, which is batched with the other
+// multiplications in its layer.
+func isMul(g gate.Gate) bool {
+	switch g.(type) {
+	case *gate.Mul, *gate.And:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsBinary returns whether the output of g is a bit shared over a binary field, rather than an element of the prime
+// field.
+func IsBinary(g gate.Gate) bool {
+	switch g.(type) {
+	case *gate.Xor, *gate.And, *gate.Not, *gate.ToBinary:
+		return true
+	default:
+		return false
+	}
+}
+
+// CheckDomain returns an error if an input of g is in the wrong field: boolean gates and ToArithmetic take bits shared
+// over a binary field, and every other gate takes elements of the prime field.
+func CheckDomain(g gate.Gate) error {
+	wantBinary := IsBinary(g)
+	switch g.(type) {
+	case *gate.ToBinary:
+		wantBinary = false
+	case *gate.ToArithmetic:
+		wantBinary = true
+	}
+
+	for _, in := range []gate.Gate{g.First(), g.Second()} {
+		if in == nil || IsBinary(in) == wantBinary {
+			continue
+		}
+		if wantBinary {
+			return fmt.Errorf("input %s is not binary, so it must be converted using ToBinary", in.Type())
+		}
+		return fmt.Errorf("input %s is binary, so it must be converted using ToArithmetic", in.Type())
+	}
+	return nil
+}
+
+// NInputs returns the number of inputs of each party, indexed by party id, which is one more than the largest index of
+// its input gates.
+func (c *Circuit) NInputs() []int {
+	n := make([]int, c.NParties, c.NParties)
+	for _, g := range c.Traverse() {
+		if in, ok := g.(*gate.Input); ok && in.Party >= 0 && in.Party < c.NParties && in.Index >= n[in.Party] {
+			n[in.Party] = in.Index + 1
+		}
+	}
+	return n
+}
+
+// CheckInputs returns an error if secrets, which are indexed by party id then input index, do not match the inputs of
+// the circuit.
+func (c *Circuit) CheckInputs(secrets [][]*big.Int) error {
+	if nSecrets := len(secrets); nSecrets != c.NParties {
+		return fmt.Errorf("length mismatch between number of secrets (%d) and number of parties (%d)", nSecrets, c.NParties)
+	}
+	for _, g := range c.Traverse() {
+		if in, ok := g.(*gate.Input); ok && (in.Party < 0 || in.Party >= c.NParties || in.Index < 0) {
+			return fmt.Errorf("input %s does not belong to one of the %d parties", in.Type(), c.NParties)
+		}
+	}
+	for party, n := range c.NInputs() {
+		if got := len(secrets[party]); got != n {
+			return fmt.Errorf("party %d has %d secrets, but the circuit has %d inputs for it", party, got, n)
+		}
+	}
+	return nil
+}
+
+// ErrDivisionByZero is returned by ComputeExpected when the circuit divides by zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// ComputeExpected evaluates the circuit in fld using secrets, indexed by party id then input index, as input and
+// returns the expected value of each output, in the order of OutputGates. Each gate is evaluated once. The expected
+// value of an output which depends on a random gate is nil, since it cannot be predicted. Binary gates are evaluated
+// on bits, which must be converted from 0 or 1 in fld. It returns an error wrapping ErrDivisionByZero if the circuit
+// divides by zero.
+func (c *Circuit) ComputeExpected(secrets [][]*big.Int, fld field.Field) ([]*big.Int, error) {
+	values := make(map[gate.Gate]*big.Int)
+	for gIdx, g := range c.Traverse() {
+		if err := CheckDomain(g); err != nil {
+			return nil, fmt.Errorf("gate %d (%s): %v", gIdx, g.Type(), err)
+		}
+		v, err := eval(g, values, secrets, fld)
+		if err != nil {
+			return nil, fmt.Errorf("gate %d (%s): %w", gIdx, g.Type(), err)
+		}
+		values[g] = v
+	}
+
+	outputs := c.OutputGates()
+	res := make([]*big.Int, len(outputs), len(outputs))
+	for i, out := range outputs {
+		res[i] = values[out.Gate]
+	}
+	return res, nil
 }
 
-func eval(root gate.Gate, s []int) int {
-	fst := root.First()
-	snd := root.Second()
+// eval evaluates g in fld, given the values of the gates that it depends on.
+func eval(g gate.Gate, values map[gate.Gate]*big.Int, s [][]*big.Int, fld field.Field) (*big.Int, error) {
+	fst := values[g.First()]
+	snd := values[g.Second()]
+	if (g.First() != nil && fst == nil) || (g.Second() != nil && snd == nil) {
+		// An input depends on a random gate.
+		return nil, nil
+	}
 
-	switch v := root.(type) {
+	switch v := g.(type) {
 	case *gate.Input:
-		return s[v.Party]
+		return fld.Mod(s[v.Party][v.Index]), nil
 	case *gate.Add:
-		return eval(fst, s) + eval(snd, s)
+		return fld.Add(fst, snd), nil
+	case *gate.Sub:
+		return fld.Sub(fst, snd), nil
+	case *gate.Neg:
+		return fld.Sub(new(big.Int), fst), nil
 	case *gate.Mul:
-		return eval(fst, s) * eval(snd, s)
+		return fld.Mul(fst, snd), nil
+	case *gate.Const:
+		return fld.Mod(v.Value), nil
+	case *gate.AddConst:
+		return fld.Add(fst, v.Value), nil
+	case *gate.MulConst:
+		return fld.Mul(fst, v.Value), nil
+	case *gate.Inv:
+		if fst.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return fld.Inv(fst), nil
+	case *gate.Div:
+		if snd.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return fld.Div(fst, snd), nil
+	case *gate.Equal:
+		if fst.Cmp(snd) == 0 {
+			return big.NewInt(1), nil
+		}
+		return new(big.Int), nil
+	case *gate.LessThan:
+		// Values are compared as their representatives in [0, p).
+		if fst.Cmp(snd) < 0 {
+			return big.NewInt(1), nil
+		}
+		return new(big.Int), nil
+	case *gate.BitDecompose:
+		if v.Bit < 0 {
+			return nil, fmt.Errorf("bit %d cannot be negative", v.Bit)
+		}
+		return big.NewInt(int64(fst.Bit(v.Bit))), nil
+	case *gate.Xor:
+		return new(big.Int).Xor(fst, snd), nil
+	case *gate.And:
+		return new(big.Int).And(fst, snd), nil
+	case *gate.Not:
+		return new(big.Int).Xor(fst, big.NewInt(1)), nil
+	case *gate.ToBinary:
+		if fst.Cmp(big.NewInt(1)) > 0 {
+			return nil, fmt.Errorf("%d is not a bit", fst)
+		}
+		return new(big.Int).Set(fst), nil
+	case *gate.ToArithmetic:
+		return new(big.Int).Set(fst), nil
+	case *gate.Random, *gate.RandomBit:
+		return nil, nil
 	default:
-		panic("Unrecognised gate type in circuit")
+		return nil, fmt.Errorf("unrecognised gate type %s", g.Type())
 	}
 }
 
@@ -1,13 +1,20 @@
 package circuit
 
 import (
+	"errors"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/field"
 	"github.com/sonjoonho/bgw/pkg/gate"
+	"math/big"
+	"reflect"
+	"sync"
 	"testing"
 )
 
 func TestCircuit_ComputeExpected(t *testing.T) {
-	secrets := []int{5, 28, 6}
-	// fld is not important for this function.
+	secrets := [][]*big.Int{field.Ints(5), field.Ints(28), field.Ints(6)}
+	// fld is large enough that the result is not reduced.
+	fld := field.New(field.Int(101))
 	circuit := &Circuit{
 		Root: gate.NewAdd(&gate.Input{Party: 0}, gate.NewAdd(
 			&gate.Input{Party: 1},
@@ -15,7 +22,328 @@ func TestCircuit_ComputeExpected(t *testing.T) {
 		)),
 	}
 
-	if got, want := circuit.ComputeExpected(secrets), 39; got != want {
-		t.Errorf("circuit.ComputeExpected(%v) = %d, want %d", secrets, got, want)
+	if got, err := circuit.ComputeExpected(secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(field.Ints(39)) {
+		t.Errorf("circuit.ComputeExpected(%v) = %d, %v, want %d", secrets, got, err, field.Ints(39))
+	}
+}
+
+func TestCircuit_ComputeExpected_Reduced(t *testing.T) {
+	// Inverses and quotients are only defined in the field, so every value is reduced modulo the prime, including
+	// negative values and values which only overflow partway through the circuit.
+	secrets := [][]*big.Int{field.Ints(5), field.Ints(28), field.Ints(6)}
+	fld := field.New(field.Int(101))
+	x, y, z := &gate.Input{Party: 0}, &gate.Input{Party: 1}, &gate.Input{Party: 2}
+	circuit := &Circuit{
+		Outputs: []Output{
+			// (5 + 28) * 6 = 198, which is 97.
+			{Name: "product", Gate: gate.NewMul(gate.NewAdd(x, y), z)},
+			// 5 - 28 = -23, which is 78.
+			{Name: "difference", Gate: gate.NewSub(x, y)},
+			// 198 / 6 = 33, even though 198 is reduced before dividing.
+			{Name: "quotient", Gate: gate.NewDiv(gate.NewMul(gate.NewAdd(x, y), z), z)},
+		},
+		NParties: 3,
+	}
+
+	want := field.Ints(97, 78, 33)
+	if got, err := circuit.ComputeExpected(secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("circuit.ComputeExpected(%v) = %d, %v, want %d", secrets, got, err, want)
+	}
+}
+
+func TestCircuit_Layers(t *testing.T) {
+	in0, in1, in2, in3, in4 := &gate.Input{Party: 0}, &gate.Input{Party: 1}, &gate.Input{Party: 2}, &gate.Input{Party: 3}, &gate.Input{Party: 4}
+	mul01 := gate.NewMul(in0, in1)
+	mul23 := gate.NewMul(in2, in3)
+	add := gate.NewAdd(mul01, in4)
+	root := gate.NewMul(add, mul23)
+	circuit := &Circuit{Root: root, NParties: 5}
+
+	// The order of the inputs depends on Traverse, so layer 0 is compared as a set.
+	wantInputs := map[gate.Gate]bool{in0: true, in1: true, in2: true, in3: true, in4: true}
+	want := [][]gate.Gate{
+		{mul01, mul23, add},
+		{root},
+	}
+
+	got := circuit.Layers()
+	if len(got) != len(want)+1 {
+		t.Fatalf("circuit.Layers() has %d layers, want %d", len(got), len(want)+1)
+	}
+	gotInputs := make(map[gate.Gate]bool)
+	for _, g := range got[0] {
+		gotInputs[g] = true
+	}
+	if !reflect.DeepEqual(gotInputs, wantInputs) {
+		t.Errorf("circuit.Layers()[0] = %v, want %v", got[0], wantInputs)
+	}
+	for i, layer := range want {
+		if !reflect.DeepEqual(got[i+1], layer) {
+			t.Errorf("circuit.Layers()[%d] = %v, want %v", i+1, got[i+1], layer)
+		}
+	}
+}
+
+func TestCircuit_SharedGates(t *testing.T) {
+	// The circuit computes the 30th Fibonacci number, reusing each term twice. As a tree, it would have over a
+	// million gates.
+	fib := []gate.Gate{&gate.Input{Party: 0}, &gate.Input{Party: 1}}
+	for k := 2; k <= 30; k++ {
+		fib = append(fib, gate.NewAdd(fib[k-1], fib[k-2]))
+	}
+	circuit := &Circuit{Root: fib[len(fib)-1], NParties: 2}
+
+	if got, want := len(circuit.Traverse()), len(fib); got != want {
+		t.Errorf("len(circuit.Traverse()) = %d, want %d", got, want)
+	}
+	secrets := [][]*big.Int{field.Ints(0), field.Ints(1)}
+	fld := field.New(field.Int(1000003))
+	if got, err := circuit.ComputeExpected(secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(field.Ints(832040)) {
+		t.Errorf("circuit.ComputeExpected(%v) = %d, %v, want %d", secrets, got, err, field.Ints(832040))
+	}
+
+	// The copy should share gates in the same way, without sharing any gates with the original.
+	c := circuit.Copy()
+	if got, want := len(c.Traverse()), len(fib); got != want {
+		t.Errorf("len(circuit.Copy().Traverse()) = %d, want %d", got, want)
+	}
+	if c.Root.First().First() != c.Root.Second() {
+		t.Errorf("circuit.Copy() does not preserve shared gates")
+	}
+	for _, g := range c.Traverse() {
+		for _, original := range circuit.Traverse() {
+			if g == original {
+				t.Fatalf("circuit.Copy() shares gate %s with the original", g.Type())
+			}
+		}
+	}
+}
+
+func TestCircuit_CopyConcurrently(t *testing.T) {
+	circuit := &Circuit{
+		Root:     gate.NewMul(gate.NewAdd(&gate.Input{Party: 0}, &gate.Input{Party: 1}), &gate.Input{Party: 2}),
+		NParties: 3,
+	}
+
+	// Copy only reads the circuit, so this should not race when run with -race.
+	var wg sync.WaitGroup
+	copies := make([]*Circuit, 4, 4)
+	for i := range copies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			copies[i] = circuit.Copy()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, c := range copies {
+		if got, want := len(c.Traverse()), len(circuit.Traverse()); got != want {
+			t.Errorf("len(copies[%d].Traverse()) = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestCircuit_Outputs(t *testing.T) {
+	secrets := [][]*big.Int{field.Ints(5), field.Ints(28), field.Ints(6)}
+	sum := gate.NewAdd(&gate.Input{Party: 0}, &gate.Input{Party: 1})
+	circuit := &Circuit{
+		Outputs: []Output{
+			{Name: "sum", Gate: sum},
+			{Name: "product", Gate: gate.NewMul(sum, &gate.Input{Party: 2})},
+			{Name: "first", Gate: sum.First()},
+		},
+		NParties: 3,
+	}
+
+	// fld is large enough that the results are not reduced.
+	fld := field.New(field.Int(1000003))
+	if got, err := circuit.ComputeExpected(secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(field.Ints(33, 198, 5)) {
+		t.Errorf("circuit.ComputeExpected(%v) = %d, %v, want %d", secrets, got, err, field.Ints(33, 198, 5))
+	}
+	// Every gate is shared between outputs, so it should only be traversed once.
+	if got, want := len(circuit.Traverse()), 5; got != want {
+		t.Errorf("len(circuit.Traverse()) = %d, want %d", got, want)
+	}
+
+	c := circuit.Copy()
+	if c.Outputs[0].Gate != c.Outputs[1].Gate.First() || c.Outputs[2].Gate != c.Outputs[0].Gate.First() {
+		t.Errorf("circuit.Copy() does not preserve gates shared between outputs")
+	}
+	for i, out := range c.OutputGates() {
+		if out.Name != circuit.Outputs[i].Name {
+			t.Errorf("circuit.Copy().OutputGates()[%d].Name = %q, want %q", i, out.Name, circuit.Outputs[i].Name)
+		}
+	}
+}
+
+func TestCircuit_CheckInputs(t *testing.T) {
+	// Party 0 has three inputs, one of which is used twice, and party 1 has one.
+	circuit := &Circuit{
+		Root: gate.NewAdd(
+			gate.NewMul(&gate.Input{Party: 0}, &gate.Input{Party: 0, Index: 2}),
+			gate.NewMul(&gate.Input{Party: 1}, gate.NewAdd(&gate.Input{Party: 0, Index: 1}, &gate.Input{Party: 0, Index: 2})),
+		),
+		NParties: 2,
+	}
+
+	if got, want := circuit.NInputs(), []int{3, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("circuit.NInputs() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		secrets [][]*big.Int
+		wantErr bool
+	}{{
+		name:    "Matching",
+		secrets: [][]*big.Int{field.Ints(2, 3, 5), field.Ints(7)},
+	}, {
+		name:    "Too few parties",
+		secrets: [][]*big.Int{field.Ints(2, 3, 5)},
+		wantErr: true,
+	}, {
+		name:    "Too few inputs",
+		secrets: [][]*big.Int{field.Ints(2, 3), field.Ints(7)},
+		wantErr: true,
+	}, {
+		name:    "Too many inputs",
+		secrets: [][]*big.Int{field.Ints(2, 3, 5), field.Ints(7, 11)},
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := circuit.CheckInputs(tc.secrets)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("circuit.CheckInputs(%v) = %v, want error %t", tc.secrets, err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			// 2 * 5 + 7 * (3 + 5)
+			fld := field.New(field.Int(101))
+			if got, err := circuit.ComputeExpected(tc.secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(field.Ints(66)) {
+				t.Errorf("circuit.ComputeExpected(%v) = %d, %v, want %d", tc.secrets, got, err, field.Ints(66))
+			}
+		})
+	}
+}
+
+func TestCircuit_DivisionByZero(t *testing.T) {
+	fld := field.New(field.Int(101))
+	x, y := &gate.Input{Party: 0}, &gate.Input{Party: 1}
+
+	tests := []struct {
+		name    string
+		secrets [][]*big.Int
+		root    gate.Gate
+	}{{
+		name:    "Inverse of zero",
+		secrets: [][]*big.Int{field.Ints(0), field.Ints(5)},
+		root:    gate.NewInv(x),
+	}, {
+		// 101 is 0 in the field.
+		name:    "Division by the prime",
+		secrets: [][]*big.Int{field.Ints(5), field.Ints(101)},
+		root:    gate.NewDiv(x, y),
+	}, {
+		name:    "Division by a zero difference",
+		secrets: [][]*big.Int{field.Ints(5), field.Ints(7)},
+		root:    gate.NewDiv(x, gate.NewSub(y, y)),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Circuit{Root: tc.root, NParties: 2}
+			if got, err := c.ComputeExpected(tc.secrets, fld); !errors.Is(err, ErrDivisionByZero) {
+				t.Errorf("circuit.ComputeExpected(%v) = %d, %v, want %v", tc.secrets, got, err, ErrDivisionByZero)
+			}
+		})
+	}
+}
+
+func TestCircuit_Comparisons(t *testing.T) {
+	fld := field.New(field.Int(101))
+	x, y := &gate.Input{Party: 0}, &gate.Input{Party: 1}
+	secrets := [][]*big.Int{field.Ints(20), field.Ints(45)}
+
+	c := &Circuit{
+		Outputs: []Output{
+			{Name: "equal", Gate: gate.NewEqual(x, gate.NewAddConst(y, field.Int(-25)))},
+			{Name: "less", Gate: gate.NewLessThan(x, y)},
+			// 20 - 45 wraps around to 76, so it is not less than 45.
+			{Name: "wrapped", Gate: gate.NewLessThan(gate.NewSub(x, y), y)},
+			// 45 = 0b101101.
+			{Name: "bit", Gate: gate.NewBitDecompose(y, 2)},
+			{Name: "high bit", Gate: gate.NewBitDecompose(y, 100)},
+		},
+		NParties: 2,
+	}
+	want := field.Ints(1, 1, 0, 1, 0)
+	if got, err := c.ComputeExpected(secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("circuit.ComputeExpected(%v) = %d, %v, want %d", secrets, got, err, want)
+	}
+
+	c = &Circuit{Root: gate.NewBitDecompose(x, -1), NParties: 2}
+	if got, err := c.ComputeExpected(secrets, fld); err == nil {
+		t.Errorf("circuit.ComputeExpected(%v) = %d, want error for a negative bit", secrets, got)
+	}
+}
+
+func TestCircuit_Boolean(t *testing.T) {
+	fld := field.New(field.Int(101))
+	x, y := &gate.Input{Party: 0}, &gate.Input{Party: 1}
+	secrets := [][]*big.Int{field.Ints(1), field.Ints(0)}
+	a, b := gate.NewToBinary(x), gate.NewToBinary(y)
+
+	c := &Circuit{
+		Outputs: []Output{
+			{Name: "xor", Gate: gate.NewXor(a, b)},
+			{Name: "and", Gate: gate.NewAnd(a, b)},
+			{Name: "not", Gate: gate.NewNot(b)},
+			{Name: "arithmetic", Gate: gate.NewAdd(gate.NewToArithmetic(a), x)},
+		},
+		NParties: 2,
+	}
+	want := field.Ints(1, 0, 1, 2)
+	if got, err := c.ComputeExpected(secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("circuit.ComputeExpected(%v) = %d, %v, want %d", secrets, got, err, want)
+	}
+	for i, wantBinary := range []bool{true, true, true, false} {
+		if got := IsBinary(c.Outputs[i].Gate); got != wantBinary {
+			t.Errorf("IsBinary(%s) = %t, want %t", c.Outputs[i].Name, got, wantBinary)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		root    gate.Gate
+		secrets [][]*big.Int
+	}{{
+		name:    "Prime input to a boolean gate",
+		root:    gate.NewAnd(a, y),
+		secrets: secrets,
+	}, {
+		name:    "Binary input to an arithmetic gate",
+		root:    gate.NewMul(a, y),
+		secrets: secrets,
+	}, {
+		name:    "Binary input to ToBinary",
+		root:    gate.NewToBinary(a),
+		secrets: secrets,
+	}, {
+		name:    "Converting a value which is not a bit",
+		root:    a,
+		secrets: [][]*big.Int{field.Ints(2), field.Ints(0)},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Circuit{Root: tc.root, NParties: 2}
+			if got, err := c.ComputeExpected(tc.secrets, fld); err == nil {
+				t.Errorf("circuit.ComputeExpected(%v) = %d, want error", tc.secrets, got)
+			}
+		})
 	}
 }
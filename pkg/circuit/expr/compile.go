@@ -0,0 +1,295 @@
+// Package expr compiles a small expression language into circuits. A program is a sequence of statements, separated by
+// newlines or semicolons:
+//
+//	# Comments start with # and run to the end of the line.
+//	input salary @ 0       # salary is an input of party 0.
+//	input bonus @ 0        # Each input of a party has the next index.
+//	input rate @ 1
+//	let total = salary + bonus
+//	out pay = total * rate
+//	out = lt(total, 100)
+//
+// Expressions use +, -, * and / with the usual precedence, unary minus, parentheses, decimal constants and the
+// functions in functions. A name bound by let is a single gate, which is shared by every expression that uses it. An
+// undeclared name of the form xN, e.g. x0, is an input of party N, so "out = x0*x1 + x2*x3 - 5" is a complete program.
+// Each out statement is an output of the circuit, which is named if a name is given. The number of parties is one more
+// than the largest party with an input, unless it is set by a "parties N" statement, and is at most MaxParties.
+package expr
+
+import (
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"math/big"
+	"regexp"
+	"strconv"
+)
+
+// MaxParties is the largest number of parties that a program can have. Every party runs the protocol with every other
+// party, so a program with more parties than this is almost certainly a mistake, such as a typo in xN.
+const MaxParties = 1000
+
+// function is a function which can be called in an expression.
+type function struct {
+	nArgs int
+	build func(args []gate.Gate) gate.Gate
+}
+
+// functions are the functions which can be called in an expression. bit(x, k), which is bit k of x, is also supported,
+// where k is a constant.
+var functions = map[string]function{
+	"inv":     {1, func(args []gate.Gate) gate.Gate { return gate.NewInv(args[0]) }},
+	"eq":      {2, func(args []gate.Gate) gate.Gate { return gate.NewEqual(args[0], args[1]) }},
+	"lt":      {2, func(args []gate.Gate) gate.Gate { return gate.NewLessThan(args[0], args[1]) }},
+	"rand":    {0, func([]gate.Gate) gate.Gate { return gate.NewRandom() }},
+	"randbit": {0, func([]gate.Gate) gate.Gate { return gate.NewRandomBit() }},
+}
+
+var keywords = map[string]bool{"input": true, "let": true, "out": true, "parties": true}
+
+// implicitInput matches the undeclared names which are inputs, capturing the party.
+var implicitInput = regexp.MustCompile(`^x([0-9]+)$`)
+
+// compiler holds the state of a program as its statements are compiled in order.
+type compiler struct {
+	// names are the gates of the inputs and let-bindings which have been defined, and defined are their positions.
+	names   map[string]gate.Gate
+	defined map[string]Pos
+	// nInputs are the number of inputs of each party which have been declared.
+	nInputs map[int]int
+	// maxParty is the largest party with an input, and maxPartyPos is where it was declared.
+	maxParty    int
+	maxPartyPos Pos
+}
+
+// Compile compiles the program in src into a circuit. Errors in the program are of type *Error, and give the position
+// of the error in src.
+func Compile(src string) (*circuit.Circuit, error) {
+	stmts, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{
+		names:    make(map[string]gate.Gate),
+		defined:  make(map[string]Pos),
+		nInputs:  make(map[int]int),
+		maxParty: -1,
+	}
+	var outputs []circuit.Output
+	outputNames := make(map[string]bool)
+	nParties := 0
+	var partiesPos Pos
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *inputStmt:
+			if err := c.input(s.pos, s.name, s.party); err != nil {
+				return nil, err
+			}
+		case *letStmt:
+			if err := c.checkName(s.pos, s.name); err != nil {
+				return nil, err
+			}
+			g, err := c.compile(s.value)
+			if err != nil {
+				return nil, err
+			}
+			c.names[s.name] = g
+			c.defined[s.name] = s.pos
+		case *outStmt:
+			g, err := c.compile(s.value)
+			if err != nil {
+				return nil, err
+			}
+			name := s.name
+			if name == "" {
+				name = circuit.DefaultOutputName
+			}
+			if outputNames[name] {
+				return nil, errorf(s.pos, "output %q is already defined", name)
+			}
+			outputNames[name] = true
+			outputs = append(outputs, circuit.Output{Name: name, Gate: g})
+		case *partiesStmt:
+			if nParties != 0 {
+				return nil, errorf(s.pos, "number of parties is already set at %s", partiesPos)
+			}
+			if s.n < 1 {
+				return nil, errorf(s.pos, "number of parties must be positive")
+			}
+			if s.n > MaxParties {
+				return nil, errorf(s.pos, "number of parties must be at most %d", MaxParties)
+			}
+			nParties, partiesPos = s.n, s.pos
+		}
+	}
+
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("program has no out statement")
+	}
+	if nParties == 0 {
+		nParties = c.maxParty + 1
+		if nParties == 0 {
+			return nil, fmt.Errorf("program has no inputs, so the number of parties must be set")
+		}
+	} else if c.maxParty >= nParties {
+		return nil, errorf(c.maxPartyPos, "party %d is out of range, since there are %d parties", c.maxParty, nParties)
+	}
+
+	res := &circuit.Circuit{NParties: nParties}
+	if len(outputs) == 1 && outputs[0].Name == circuit.DefaultOutputName {
+		res.Root = outputs[0].Gate
+	} else {
+		res.Outputs = outputs
+	}
+	return res, nil
+}
+
+// checkName returns an error if name cannot be defined at pos.
+func (c *compiler) checkName(pos Pos, name string) error {
+	if keywords[name] {
+		return errorf(pos, "%q is a keyword", name)
+	}
+	if prev, ok := c.defined[name]; ok {
+		return errorf(pos, "%q is already defined at %s", name, prev)
+	}
+	return nil
+}
+
+// input declares name as the next input of party.
+func (c *compiler) input(pos Pos, name string, party int) error {
+	if err := c.checkName(pos, name); err != nil {
+		return err
+	}
+	if party >= MaxParties {
+		return errorf(pos, "party %d is out of range, since there are at most %d parties", party, MaxParties)
+	}
+	c.names[name] = &gate.Input{Party: party, Index: c.nInputs[party]}
+	c.defined[name] = pos
+	c.nInputs[party]++
+	if party > c.maxParty {
+		c.maxParty, c.maxPartyPos = party, pos
+	}
+	return nil
+}
+
+// compile returns the gate which computes n.
+func (c *compiler) compile(n node) (gate.Gate, error) {
+	switch v := n.(type) {
+	case *numberNode:
+		return gate.NewConst(v.value), nil
+	case *identNode:
+		if g, ok := c.names[v.name]; ok {
+			return g, nil
+		}
+		if m := implicitInput.FindStringSubmatch(v.name); m != nil {
+			if party, err := strconv.Atoi(m[1]); err == nil {
+				if err := c.input(v.pos, v.name, party); err != nil {
+					return nil, err
+				}
+				return c.names[v.name], nil
+			}
+		}
+		return nil, errorf(v.pos, "%q is not defined", v.name)
+	case *negNode:
+		x, err := c.compile(v.x)
+		if err != nil {
+			return nil, err
+		}
+		if cx, ok := x.(*gate.Const); ok {
+			return gate.NewConst(new(big.Int).Neg(cx.Value)), nil
+		}
+		return gate.NewNeg(x), nil
+	case *binaryNode:
+		x, err := c.compile(v.x)
+		if err != nil {
+			return nil, err
+		}
+		y, err := c.compile(v.y)
+		if err != nil {
+			return nil, err
+		}
+		return binary(v.op, x, y), nil
+	case *callNode:
+		return c.call(v)
+	default:
+		return nil, errorf(n.position(), "unsupported expression")
+	}
+}
+
+// binary returns the gate which computes x op y. Constants are folded, and a wire is combined with a constant using
+// gate.AddConst or gate.MulConst, which cost no communication.
+func binary(op string, x, y gate.Gate) gate.Gate {
+	cx, xConst := x.(*gate.Const)
+	cy, yConst := y.(*gate.Const)
+	switch op {
+	case "+":
+		switch {
+		case xConst && yConst:
+			return gate.NewConst(new(big.Int).Add(cx.Value, cy.Value))
+		case xConst:
+			return gate.NewAddConst(y, cx.Value)
+		case yConst:
+			return gate.NewAddConst(x, cy.Value)
+		}
+		return gate.NewAdd(x, y)
+	case "-":
+		switch {
+		case xConst && yConst:
+			return gate.NewConst(new(big.Int).Sub(cx.Value, cy.Value))
+		case xConst:
+			return gate.NewAddConst(gate.NewNeg(y), cx.Value)
+		case yConst:
+			return gate.NewAddConst(x, new(big.Int).Neg(cy.Value))
+		}
+		return gate.NewSub(x, y)
+	case "*":
+		switch {
+		case xConst && yConst:
+			return gate.NewConst(new(big.Int).Mul(cx.Value, cy.Value))
+		case xConst:
+			return gate.NewMulConst(y, cx.Value)
+		case yConst:
+			return gate.NewMulConst(x, cy.Value)
+		}
+		return gate.NewMul(x, y)
+	default:
+		// Division depends on the field, so it is never folded.
+		return gate.NewDiv(x, y)
+	}
+}
+
+// call returns the gate which computes the function call n.
+func (c *compiler) call(n *callNode) (gate.Gate, error) {
+	if n.fn == "bit" {
+		if len(n.args) != 2 {
+			return nil, errorf(n.pos, "bit takes 2 arguments, found %d", len(n.args))
+		}
+		k, ok := n.args[1].(*numberNode)
+		if !ok || !k.value.IsInt64() || k.value.Int64() > 1<<20 {
+			return nil, errorf(n.args[1].position(), "the second argument of bit must be a small constant")
+		}
+		x, err := c.compile(n.args[0])
+		if err != nil {
+			return nil, err
+		}
+		return gate.NewBitDecompose(x, int(k.value.Int64())), nil
+	}
+
+	fn, ok := functions[n.fn]
+	if !ok {
+		return nil, errorf(n.pos, "unknown function %q", n.fn)
+	}
+	if len(n.args) != fn.nArgs {
+		return nil, errorf(n.pos, "%s takes %d arguments, found %d", n.fn, fn.nArgs, len(n.args))
+	}
+	args := make([]gate.Gate, len(n.args), len(n.args))
+	for i, arg := range n.args {
+		g, err := c.compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = g
+	}
+	return fn.build(args), nil
+}
@@ -0,0 +1,201 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/field"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"math/big"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	fld := field.New(field.Int(101))
+
+	tests := []struct {
+		name         string
+		src          string
+		secrets      [][]*big.Int
+		wantParties  int
+		wantOutputs  []string
+		want         []*big.Int
+		wantNInputs  []int
+		wantMaxGates int
+	}{{
+		name:        "Implicit inputs",
+		src:         "out = x0*x1 + x2*x3 - 5",
+		secrets:     [][]*big.Int{field.Ints(2), field.Ints(3), field.Ints(4), field.Ints(5)},
+		wantParties: 4,
+		wantOutputs: []string{"output"},
+		want:        field.Ints(21),
+	}, {
+		name: "Named inputs and outputs",
+		src: `# Party 0 has two inputs.
+input salary @ 0
+input bonus @ 0
+input rate @ 1
+let total = salary + bonus
+out pay = total * rate; out small = lt(total, 50)
+`,
+		secrets:     [][]*big.Int{field.Ints(30, 10), field.Ints(2)},
+		wantParties: 2,
+		wantOutputs: []string{"pay", "small"},
+		want:        field.Ints(80, 1),
+		wantNInputs: []int{2, 1},
+	}, {
+		name:        "Parties without inputs",
+		src:         "parties 5\nout = -x0 + 3 * x1 - (2 - 7)",
+		secrets:     [][]*big.Int{field.Ints(4), field.Ints(10), {}, {}, {}},
+		wantParties: 5,
+		wantOutputs: []string{"output"},
+		want:        field.Ints(31),
+	}, {
+		name:        "Functions",
+		src:         "input x @ 0; input y @ 1\nout = eq(x, y) + 10 * bit(x, 2) + 100 * (x / y) * inv(y)",
+		secrets:     [][]*big.Int{field.Ints(6), field.Ints(3)},
+		wantParties: 2,
+		wantOutputs: []string{"output"},
+		// 0 + 10 * 1 + 100 * 2 * 34 mod 101.
+		want: field.Ints((10 + 100*2*34) % 101),
+	}, {
+		// Each term of the sum is bound once, so the circuit has a linear number of gates.
+		name: "Shared bindings",
+		src: `let a = x0 + x1
+let b = a * a
+let c = b + b
+let d = c * c
+out = d + d`,
+		secrets:     [][]*big.Int{field.Ints(1), field.Ints(1)},
+		wantParties: 2,
+		wantOutputs: []string{"output"},
+		// 2 * ((2 * (x0 + x1)^2)^2) = 128, which is 27 mod 101.
+		want:         field.Ints(27),
+		wantMaxGates: 7,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Compile(tc.src)
+			if err != nil {
+				t.Fatalf("Compile(%q) failed with %v", tc.src, err)
+			}
+			if c.NParties != tc.wantParties {
+				t.Errorf("Compile(%q).NParties = %d, want %d", tc.src, c.NParties, tc.wantParties)
+			}
+			var names []string
+			for _, out := range c.OutputGates() {
+				names = append(names, out.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tc.wantOutputs) {
+				t.Errorf("Compile(%q) has outputs %v, want %v", tc.src, names, tc.wantOutputs)
+			}
+			if tc.wantNInputs != nil && fmt.Sprint(c.NInputs()) != fmt.Sprint(tc.wantNInputs) {
+				t.Errorf("Compile(%q).NInputs() = %v, want %v", tc.src, c.NInputs(), tc.wantNInputs)
+			}
+			if tc.wantMaxGates != 0 && len(c.Traverse()) > tc.wantMaxGates {
+				t.Errorf("Compile(%q) has %d gates, want at most %d", tc.src, len(c.Traverse()), tc.wantMaxGates)
+			}
+			if got, err := c.ComputeExpected(tc.secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("Compile(%q).ComputeExpected(%v) = %d, %v, want %d", tc.src, tc.secrets, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompile_Constants(t *testing.T) {
+	// Constants are folded, and combined with wires without multiplication gates.
+	c, err := Compile("out = 2 * (x0 + 3) - 4 * 5")
+	if err != nil {
+		t.Fatalf("Compile() failed with %v", err)
+	}
+	for _, g := range c.Traverse() {
+		switch g.(type) {
+		case *gate.Mul, *gate.Add, *gate.Sub:
+			t.Errorf("Compile() has a %s gate, want only constant gates", g.Type())
+		}
+	}
+	secrets := [][]*big.Int{field.Ints(7)}
+	if got, err := c.ComputeExpected(secrets, field.New(field.Int(101))); err != nil || got[0].Cmp(field.Int(0)) != 0 {
+		t.Errorf("Compile().ComputeExpected(%v) = %d, %v, want [0]", secrets, got, err)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantPos Pos
+		wantMsg string
+	}{{
+		name:    "Undefined name",
+		src:     "let a = x0\nout = a + b",
+		wantPos: Pos{Line: 2, Col: 11},
+		wantMsg: `"b" is not defined`,
+	}, {
+		name:    "Redefined name",
+		src:     "input a @ 0\nlet a = x1\nout = a",
+		wantPos: Pos{Line: 2, Col: 1},
+		wantMsg: `"a" is already defined at 1:1`,
+	}, {
+		name:    "Unknown function",
+		src:     "out = max(x0, x1)",
+		wantPos: Pos{Line: 1, Col: 7},
+		wantMsg: `unknown function "max"`,
+	}, {
+		name:    "Wrong number of arguments",
+		src:     "out = lt(x0)",
+		wantPos: Pos{Line: 1, Col: 7},
+		wantMsg: "lt takes 2 arguments, found 1",
+	}, {
+		name:    "Bit of a wire",
+		src:     "out = bit(x0, x1)",
+		wantPos: Pos{Line: 1, Col: 15},
+		wantMsg: "the second argument of bit must be a small constant",
+	}, {
+		name:    "Duplicate output",
+		src:     "out a = x0\nout a = x1",
+		wantPos: Pos{Line: 2, Col: 1},
+		wantMsg: `output "a" is already defined`,
+	}, {
+		name:    "Party out of range",
+		src:     "parties 2\ninput a @ 0\ninput b @ 2\nout = a + b",
+		wantPos: Pos{Line: 3, Col: 1},
+		wantMsg: "party 2 is out of range, since there are 2 parties",
+	}, {
+		name:    "Party above the limit",
+		src:     "input a @ 1000\nout = a",
+		wantPos: Pos{Line: 1, Col: 1},
+		wantMsg: "party 1000 is out of range, since there are at most 1000 parties",
+	}, {
+		name:    "Implicit party above the limit",
+		src:     "out = x0 + x123456789",
+		wantPos: Pos{Line: 1, Col: 12},
+		wantMsg: "party 123456789 is out of range, since there are at most 1000 parties",
+	}, {
+		name:    "Too many parties",
+		src:     "parties 1001\nout = x0",
+		wantPos: Pos{Line: 1, Col: 1},
+		wantMsg: "number of parties must be at most 1000",
+	}, {
+		name:    "Keyword",
+		src:     "let out = x0\nout = out",
+		wantPos: Pos{Line: 1, Col: 1},
+		wantMsg: `"out" is a keyword`,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Compile(tc.src)
+			var got *Error
+			if !errors.As(err, &got) || got.Pos != tc.wantPos || got.Msg != tc.wantMsg {
+				t.Errorf("Compile(%q) = %v, want error %s: %s", tc.src, err, tc.wantPos, tc.wantMsg)
+			}
+		})
+	}
+
+	for _, src := range []string{"", "input a @ 0", "out = 5"} {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("Compile(%q) succeeded, want error", src)
+		}
+	}
+}
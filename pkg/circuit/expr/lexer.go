@@ -0,0 +1,122 @@
+package expr
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// Pos is a position in the source of a program.
+type Pos struct {
+	// Line and Col start from 1.
+	Line, Col int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// Error is an error in a program, at a position in its source.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// errorf returns an Error at pos.
+func errorf(pos Pos, format string, a ...interface{}) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, a...)}
+}
+
+type kind int
+
+const (
+	eof kind = iota
+	// newline and ";" separate statements.
+	separator
+	ident
+	number
+	// punct is an operator or punctuation, e.g. "+" or "(".
+	punct
+)
+
+// token is a lexical token of a program.
+type token struct {
+	kind kind
+	// text is the source of the token.
+	text string
+	pos  Pos
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case eof:
+		return "end of input"
+	case separator:
+		if t.text == "\n" {
+			return "newline"
+		}
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lex splits src into tokens, ending with an eof token. Comments start with # and run to the end of the line.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+	pos := Pos{Line: 1, Col: 1}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := pos
+		// n is the length of the token.
+		n := 1
+		switch {
+		case r == '\n':
+			tokens = append(tokens, token{kind: separator, text: "\n", pos: start})
+			i++
+			pos = Pos{Line: pos.Line + 1, Col: 1}
+			continue
+		case unicode.IsSpace(r):
+		case r == '#':
+			for i+n < len(runes) && runes[i+n] != '\n' {
+				n++
+			}
+		case r == ';':
+			tokens = append(tokens, token{kind: separator, text: ";", pos: start})
+		case unicode.IsDigit(r):
+			for i+n < len(runes) && isIdentRune(runes[i+n]) {
+				n++
+			}
+			tokens = append(tokens, token{kind: number, text: string(runes[i : i+n]), pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			for i+n < len(runes) && isIdentRune(runes[i+n]) {
+				n++
+			}
+			tokens = append(tokens, token{kind: ident, text: string(runes[i : i+n]), pos: start})
+		case isPunct(r):
+			tokens = append(tokens, token{kind: punct, text: string(r), pos: start})
+		default:
+			return nil, errorf(start, "unexpected character %q", r)
+		}
+		i += n
+		pos.Col += n
+	}
+	return append(tokens, token{kind: eof, pos: pos}), nil
+}
+
+// isIdentRune returns whether r can appear in an identifier after its first character. Numbers are lexed in the same
+// way, so that e.g. 12ab is a single invalid number rather than a number followed by an identifier.
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func isPunct(r rune) bool {
+	switch r {
+	case '+', '-', '*', '/', '(', ')', ',', '=', '@':
+		return true
+	default:
+		return false
+	}
+}
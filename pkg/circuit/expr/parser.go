@@ -0,0 +1,319 @@
+package expr
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// statement is a statement of a program.
+type statement interface {
+	position() Pos
+}
+
+// inputStmt declares an input of a party, e.g. "input salary @ 0".
+type inputStmt struct {
+	pos   Pos
+	name  string
+	party int
+}
+
+// letStmt binds a name to the value of an expression, e.g. "let s = x + y".
+type letStmt struct {
+	pos   Pos
+	name  string
+	value node
+}
+
+// outStmt reveals the value of an expression, e.g. "out total = x + y". The name is empty if it is omitted.
+type outStmt struct {
+	pos   Pos
+	name  string
+	value node
+}
+
+// partiesStmt sets the number of parties, e.g. "parties 5".
+type partiesStmt struct {
+	pos Pos
+	n   int
+}
+
+func (s *inputStmt) position() Pos   { return s.pos }
+func (s *letStmt) position() Pos     { return s.pos }
+func (s *outStmt) position() Pos     { return s.pos }
+func (s *partiesStmt) position() Pos { return s.pos }
+
+// node is a node of the syntax tree of an expression.
+type node interface {
+	position() Pos
+}
+
+type numberNode struct {
+	pos   Pos
+	value *big.Int
+}
+
+type identNode struct {
+	pos  Pos
+	name string
+}
+
+// binaryNode is an expression with a binary operator, which is one of "+", "-", "*" and "/".
+type binaryNode struct {
+	pos  Pos
+	op   string
+	x, y node
+}
+
+type negNode struct {
+	pos Pos
+	x   node
+}
+
+// callNode is a call to one of the functions in functions, e.g. "lt(x, y)".
+type callNode struct {
+	pos  Pos
+	fn   string
+	args []node
+}
+
+func (n *numberNode) position() Pos { return n.pos }
+func (n *identNode) position() Pos  { return n.pos }
+func (n *binaryNode) position() Pos { return n.pos }
+func (n *negNode) position() Pos    { return n.pos }
+func (n *callNode) position() Pos   { return n.pos }
+
+// parser is a recursive descent parser for the grammar:
+//
+//	program   = [ statement ] { separator [ statement ] } eof
+//	statement = "input" ident "@" number
+//	          | "let" ident "=" expr
+//	          | "out" [ ident ] "=" expr
+//	          | "parties" number
+//	expr      = term { ( "+" | "-" ) term }
+//	term      = unary { ( "*" | "/" ) unary }
+//	unary     = "-" unary | primary
+//	primary   = number | ident | ident "(" [ expr { "," expr } ] ")" | "(" expr ")"
+type parser struct {
+	tokens []token
+	// next is the index of the next token.
+	next int
+}
+
+// parse parses the source of a program into its statements.
+func parse(src string) ([]statement, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	var stmts []statement
+	for {
+		switch p.peek().kind {
+		case eof:
+			return stmts, nil
+		case separator:
+			p.advance()
+			continue
+		}
+		stmt, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+		if t := p.peek(); t.kind != separator && t.kind != eof {
+			return nil, errorf(t.pos, "unexpected %s after statement", t)
+		}
+	}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != eof {
+		p.next++
+	}
+	return t
+}
+
+// expect consumes the next token, which must be the punctuation text.
+func (p *parser) expect(text string) error {
+	if t := p.advance(); t.kind != punct || t.text != text {
+		return errorf(t.pos, "expected %q, found %s", text, t)
+	}
+	return nil
+}
+
+// expectIdent consumes the next token, which must be an identifier, and returns its name.
+func (p *parser) expectIdent(what string) (string, error) {
+	t := p.advance()
+	if t.kind != ident {
+		return "", errorf(t.pos, "expected %s, found %s", what, t)
+	}
+	return t.text, nil
+}
+
+// expectInt consumes the next token, which must be a number which fits in an int, and returns it.
+func (p *parser) expectInt(what string) (int, error) {
+	t := p.advance()
+	if t.kind != number {
+		return 0, errorf(t.pos, "expected %s, found %s", what, t)
+	}
+	n, err := strconv.Atoi(t.text)
+	if err != nil {
+		return 0, errorf(t.pos, "invalid %s %s", what, t)
+	}
+	return n, nil
+}
+
+func (p *parser) statement() (statement, error) {
+	t := p.advance()
+	if t.kind != ident {
+		return nil, errorf(t.pos, "expected a statement, found %s", t)
+	}
+
+	switch t.text {
+	case "input":
+		name, err := p.expectIdent("input name")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("@"); err != nil {
+			return nil, err
+		}
+		party, err := p.expectInt("party")
+		if err != nil {
+			return nil, err
+		}
+		return &inputStmt{pos: t.pos, name: name, party: party}, nil
+	case "let":
+		name, err := p.expectIdent("name")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		value, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &letStmt{pos: t.pos, name: name, value: value}, nil
+	case "out":
+		var name string
+		if p.peek().kind == ident {
+			name = p.advance().text
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		value, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &outStmt{pos: t.pos, name: name, value: value}, nil
+	case "parties":
+		n, err := p.expectInt("number of parties")
+		if err != nil {
+			return nil, err
+		}
+		return &partiesStmt{pos: t.pos, n: n}, nil
+	default:
+		return nil, errorf(t.pos, "expected a statement, found %s", t)
+	}
+}
+
+func (p *parser) expr() (node, error) {
+	x, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == punct && (t.text == "+" || t.text == "-"); t = p.peek() {
+		p.advance()
+		y, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryNode{pos: t.pos, op: t.text, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) term() (node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == punct && (t.text == "*" || t.text == "/"); t = p.peek() {
+		p.advance()
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = &binaryNode{pos: t.pos, op: t.text, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) unary() (node, error) {
+	if t := p.peek(); t.kind == punct && t.text == "-" {
+		p.advance()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &negNode{pos: t.pos, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.advance()
+	switch {
+	case t.kind == number:
+		v, ok := new(big.Int).SetString(t.text, 10)
+		if !ok {
+			return nil, errorf(t.pos, "invalid number %s", t)
+		}
+		return &numberNode{pos: t.pos, value: v}, nil
+	case t.kind == ident:
+		if next := p.peek(); next.kind != punct || next.text != "(" {
+			return &identNode{pos: t.pos, name: t.text}, nil
+		}
+		p.advance()
+		call := &callNode{pos: t.pos, fn: t.text}
+		if next := p.peek(); next.kind == punct && next.text == ")" {
+			p.advance()
+			return call, nil
+		}
+		for {
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if next := p.peek(); next.kind == punct && next.text == "," {
+				p.advance()
+				continue
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return call, nil
+		}
+	case t.kind == punct && t.text == "(":
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	default:
+		return nil, errorf(t.pos, "expected an expression, found %s", t)
+	}
+}
@@ -0,0 +1,98 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantPos Pos
+		wantMsg string
+	}{{
+		name:    "Unexpected character",
+		src:     "out = x0 $ x1",
+		wantPos: Pos{Line: 1, Col: 10},
+		wantMsg: `unexpected character '$'`,
+	}, {
+		name:    "Missing operand",
+		src:     "let s = x0 +\nout = s",
+		wantPos: Pos{Line: 1, Col: 13},
+		wantMsg: "expected an expression, found newline",
+	}, {
+		name:    "Unbalanced parentheses",
+		src:     "out = (x0 + x1",
+		wantPos: Pos{Line: 1, Col: 15},
+		wantMsg: `expected ")", found end of input`,
+	}, {
+		name:    "Missing equals",
+		src:     "\n\nlet s x0",
+		wantPos: Pos{Line: 3, Col: 7},
+		wantMsg: `expected "=", found "x0"`,
+	}, {
+		name:    "Unknown statement",
+		src:     "output = x0",
+		wantPos: Pos{Line: 1, Col: 1},
+		wantMsg: `expected a statement, found "output"`,
+	}, {
+		name:    "Trailing tokens",
+		src:     "out = x0 x1",
+		wantPos: Pos{Line: 1, Col: 10},
+		wantMsg: `unexpected "x1" after statement`,
+	}, {
+		name:    "Input without a party",
+		src:     "input a @ b",
+		wantPos: Pos{Line: 1, Col: 11},
+		wantMsg: `expected party, found "b"`,
+	}, {
+		name:    "Invalid number",
+		src:     "  # A comment.\nout = 12ab",
+		wantPos: Pos{Line: 2, Col: 7},
+		wantMsg: `invalid number "12ab"`,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parse(tc.src)
+			var got *Error
+			if !errors.As(err, &got) || got.Pos != tc.wantPos || got.Msg != tc.wantMsg {
+				t.Errorf("parse(%q) = %v, want error %s: %s", tc.src, err, tc.wantPos, tc.wantMsg)
+			}
+		})
+	}
+}
+
+func TestParse_Precedence(t *testing.T) {
+	stmts, err := parse("out = -a + b * (c - d) / e; let f = g(h, 1)")
+	if err != nil {
+		t.Fatalf("parse() failed with %v", err)
+	}
+	if len(stmts) != 2 {
+		t.Fatalf("parse() has %d statements, want 2", len(stmts))
+	}
+
+	// The expression should be (-a) + ((b * (c - d)) / e).
+	add, ok := stmts[0].(*outStmt).value.(*binaryNode)
+	if !ok || add.op != "+" {
+		t.Fatalf("parse() has root %#v, want +", stmts[0].(*outStmt).value)
+	}
+	if _, ok := add.x.(*negNode); !ok {
+		t.Errorf("parse() has first operand %#v, want negation", add.x)
+	}
+	div, ok := add.y.(*binaryNode)
+	if !ok || div.op != "/" {
+		t.Fatalf("parse() has second operand %#v, want /", add.y)
+	}
+	if mul, ok := div.x.(*binaryNode); !ok || mul.op != "*" {
+		t.Errorf("parse() has dividend %#v, want *", div.x)
+	} else if sub, ok := mul.y.(*binaryNode); !ok || sub.op != "-" {
+		t.Errorf("parse() has multiplicand %#v, want -", mul.y)
+	}
+
+	call, ok := stmts[1].(*letStmt).value.(*callNode)
+	if !ok || call.fn != "g" || len(call.args) != 2 {
+		t.Errorf("parse() has let value %#v, want call to g with 2 arguments", stmts[1].(*letStmt).value)
+	}
+}
@@ -0,0 +1,72 @@
+package optimize
+
+import (
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/gate"
+)
+
+// CSE eliminates common subexpressions: gates of the same type with the same parameters and the same inputs are merged
+// into one gate, which is shared by every gate that used them. Inputs of commutative gates are compared in either
+// order, so x*y and y*x are merged. Random gates are never merged, since each one is independent.
+func CSE(c *circuit.Circuit) *circuit.Circuit {
+	// ids number the gates of the new circuit, so that gates with the same inputs have the same key.
+	ids := make(map[gate.Gate]int)
+	gates := make(map[string]gate.Gate)
+
+	return rewrite(c, func(g, first, second gate.Gate) gate.Gate {
+		res := g.Copy(first, second)
+		if _, ok := ids[res]; !ok {
+			ids[res] = len(ids)
+		}
+
+		switch g.(type) {
+		case *gate.Random, *gate.RandomBit:
+			return res
+		}
+
+		key := fmt.Sprintf("%s %s", g.Type(), params(g))
+		fstID, sndID := -1, -1
+		if first != nil {
+			fstID = ids[first]
+		}
+		if second != nil {
+			sndID = ids[second]
+		}
+		if commutative(g) && fstID > sndID {
+			fstID, sndID = sndID, fstID
+		}
+		key += fmt.Sprintf(" %d %d", fstID, sndID)
+
+		if existing, ok := gates[key]; ok {
+			return existing
+		}
+		gates[key] = res
+		return res
+	})
+}
+
+// params returns the parameters of g which are not included in its type.
+func params(g gate.Gate) string {
+	switch v := g.(type) {
+	case *gate.Const:
+		return v.Value.String()
+	case *gate.AddConst:
+		return v.Value.String()
+	case *gate.MulConst:
+		return v.Value.String()
+	default:
+		// Input and BitDecompose include their parameters in their type.
+		return ""
+	}
+}
+
+// commutative returns whether the output of g does not depend on the order of its inputs.
+func commutative(g gate.Gate) bool {
+	switch g.(type) {
+	case *gate.Add, *gate.Mul, *gate.Equal, *gate.Xor, *gate.And:
+		return true
+	default:
+		return false
+	}
+}
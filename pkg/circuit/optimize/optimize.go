@@ -0,0 +1,42 @@
+// Package optimize rewrites circuits into equivalent circuits which are cheaper to evaluate. Every multiplication costs
+// a round of communication per layer, so the passes aim to remove multiplications and reduce the multiplicative depth.
+// Each pass returns a new circuit, which computes the same outputs as the original, and never modifies the original.
+package optimize
+
+import (
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/gate"
+)
+
+// Optimize applies every pass to c: Simplify, then CSE, then Rebalance, then CSE again to merge any subexpressions
+// which have become common.
+func Optimize(c *circuit.Circuit) *circuit.Circuit {
+	return CSE(Rebalance(CSE(Simplify(c))))
+}
+
+// rewrite returns a copy of c in which each gate is replaced by the result of f, called in the order of c.Traverse. f
+// is passed the original gate and the replacements of its inputs, which are nil if it has no inputs, and returns the
+// replacement of the gate, which may be an existing gate.
+func rewrite(c *circuit.Circuit, f func(g, first, second gate.Gate) gate.Gate) *circuit.Circuit {
+	replacements := make(map[gate.Gate]gate.Gate)
+	for _, g := range c.Traverse() {
+		var first, second gate.Gate
+		if g.First() != nil {
+			first = replacements[g.First()]
+		}
+		if g.Second() != nil {
+			second = replacements[g.Second()]
+		}
+		replacements[g] = f(g, first, second)
+	}
+
+	res := &circuit.Circuit{NParties: c.NParties}
+	if len(c.Outputs) == 0 {
+		res.Root = replacements[c.Root]
+	}
+	for _, out := range c.Outputs {
+		recipients := append([]int(nil), out.Recipients...)
+		res.Outputs = append(res.Outputs, circuit.Output{Name: out.Name, Gate: replacements[out.Gate], Recipients: recipients})
+	}
+	return res
+}
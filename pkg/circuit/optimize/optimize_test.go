@@ -0,0 +1,293 @@
+package optimize
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/circuit/expr"
+	"github.com/sonjoonho/bgw/pkg/config"
+	"github.com/sonjoonho/bgw/pkg/field"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"math/big"
+	"testing"
+)
+
+// depth returns the multiplicative depth of c.
+func depth(c *circuit.Circuit) int {
+	return len(c.Layers()) - 1
+}
+
+// count returns the number of gates in c of type typ.
+func count(c *circuit.Circuit, typ string) int {
+	n := 0
+	for _, g := range c.Traverse() {
+		if g.Type() == typ {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPasses_Configs(t *testing.T) {
+	passes := []struct {
+		name string
+		pass func(*circuit.Circuit) *circuit.Circuit
+	}{
+		{"Simplify", Simplify},
+		{"CSE", CSE},
+		{"Rebalance", Rebalance},
+		{"Optimize", Optimize},
+	}
+	for _, p := range passes {
+		for circuitNumber := 1; circuitNumber <= 17; circuitNumber++ {
+			t.Run(fmt.Sprintf("pass=%s/circuit=%d", p.name, circuitNumber), func(t *testing.T) {
+				cfg, err := config.New("101", 1, 0, -1, -1, circuitNumber)
+				if err != nil {
+					t.Fatalf("New() failed with %v", err)
+				}
+				wantOut, wantErr := cfg.Circuit.ComputeExpected(cfg.Secrets, cfg.Field)
+				wantLen := len(cfg.Circuit.Traverse())
+
+				got := p.pass(cfg.Circuit)
+				gotOut, gotErr := got.ComputeExpected(cfg.Secrets, cfg.Field)
+				if fmt.Sprint(gotOut, gotErr) != fmt.Sprint(wantOut, wantErr) {
+					t.Errorf("%s().ComputeExpected() = %d, %v, want %d, %v", p.name, gotOut, gotErr, wantOut, wantErr)
+				}
+				if got.NParties != cfg.Circuit.NParties || len(got.OutputGates()) != len(cfg.Circuit.OutputGates()) {
+					t.Errorf("%s() has %d parties and %d outputs, want %d and %d", p.name, got.NParties, len(got.OutputGates()), cfg.Circuit.NParties, len(cfg.Circuit.OutputGates()))
+				}
+				if err := got.CheckInputs(cfg.Secrets); err != nil {
+					t.Errorf("%s().CheckInputs() failed with %v", p.name, err)
+				}
+				if gotDepth, wantDepth := depth(got), depth(cfg.Circuit); gotDepth > wantDepth {
+					t.Errorf("%s() has multiplicative depth %d, want at most %d", p.name, gotDepth, wantDepth)
+				}
+				if gotMuls, wantMuls := count(got, "MUL"), count(cfg.Circuit, "MUL"); gotMuls > wantMuls {
+					t.Errorf("%s() has %d MUL gates, want at most %d", p.name, gotMuls, wantMuls)
+				}
+
+				// The original circuit should not be modified.
+				cfg.Circuit = cfg.Circuit.Copy()
+				if gotLen := len(cfg.Circuit.Traverse()); gotLen != wantLen {
+					t.Errorf("original circuit has %d gates after %s(), want %d", gotLen, p.name, wantLen)
+				}
+			})
+		}
+	}
+}
+
+func TestCSE(t *testing.T) {
+	x, y := &gate.Input{Party: 0}, &gate.Input{Party: 1}
+	c := &circuit.Circuit{
+		Outputs: []circuit.Output{
+			{Name: "products", Gate: gate.NewAdd(gate.NewMul(x, y), gate.NewMul(y, x))},
+			{Name: "differences", Gate: gate.NewAdd(gate.NewSub(x, y), gate.NewSub(y, x))},
+			{Name: "constants", Gate: gate.NewAdd(gate.NewMulConst(x, field.Int(3)), gate.NewMulConst(x, field.Int(3)))},
+			{Name: "random", Gate: gate.NewAdd(gate.NewRandom(), gate.NewRandom())},
+		},
+		NParties: 2,
+	}
+
+	got := CSE(c)
+	// x*y and y*x are the same, but x-y and y-x are not, and each random gate is independent.
+	for typ, want := range map[string]int{"MUL": 1, "SUB": 2, "MULC": 1, "RAND": 2} {
+		if n := count(got, typ); n != want {
+			t.Errorf("CSE() has %d %s gates, want %d", n, typ, want)
+		}
+	}
+	secrets := [][]*big.Int{field.Ints(5), field.Ints(7)}
+	fld := field.New(field.Int(101))
+	if got, err := got.ComputeExpected(secrets, fld); err != nil || fmt.Sprint(got[:3]) != fmt.Sprint(field.Ints(70, 0, 30)) {
+		t.Errorf("CSE().ComputeExpected(%v) = %d, %v, want %d", secrets, got, err, field.Ints(70, 0, 30))
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	x, y := &gate.Input{Party: 0}, &gate.Input{Party: 1}
+	// ((x*3)*2 + (5-5)) * --y + (y-y)*y - 4
+	scaled := gate.NewMul(gate.NewMul(x, gate.NewConst(field.Int(3))), gate.NewConst(field.Int(2)))
+	sum := gate.NewAdd(scaled, gate.NewSub(gate.NewConst(field.Int(5)), gate.NewConst(field.Int(5))))
+	product := gate.NewMul(sum, gate.NewNeg(gate.NewNeg(y)))
+	zero := gate.NewMul(gate.NewSub(y, y), y)
+	c := &circuit.Circuit{Root: gate.NewSub(gate.NewAdd(product, zero), gate.NewConst(field.Int(4))), NParties: 2}
+
+	got := Simplify(c)
+	// This is (x*6)*y - 4, which needs a single multiplication.
+	if types := fmt.Sprint(gateTypes(got)); types != "[IN0 MULC IN1 MUL ADDC]" {
+		t.Errorf("Simplify() has gates %s, want [IN0 MULC IN1 MUL ADDC]", types)
+	}
+	secrets := [][]*big.Int{field.Ints(5), field.Ints(7)}
+	fld := field.New(field.Int(1009))
+	want, wantErr := c.ComputeExpected(secrets, fld)
+	if got, err := got.ComputeExpected(secrets, fld); err != nil || wantErr != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Simplify().ComputeExpected(%v) = %d, %v, want %d, %v", secrets, got, err, want, wantErr)
+	}
+}
+
+// gateTypes returns the types of the gates of c, in order.
+func gateTypes(c *circuit.Circuit) []string {
+	var res []string
+	for _, g := range c.Traverse() {
+		res = append(res, g.Type())
+	}
+	return res
+}
+
+func TestRebalance(t *testing.T) {
+	secrets := [][]*big.Int{field.Ints(2), field.Ints(3), field.Ints(4), field.Ints(5), field.Ints(6), field.Ints(7), field.Ints(8), field.Ints(9)}
+	fld := field.New(field.Int(1000003))
+	in := make([]gate.Gate, len(secrets), len(secrets))
+	for i := range in {
+		in[i] = &gate.Input{Party: i}
+	}
+	// chain returns the product of in[:n], from left to right.
+	chain := func(n int) gate.Gate {
+		g := in[0]
+		for _, x := range in[1:n] {
+			g = gate.NewMul(g, x)
+		}
+		return g
+	}
+	shared := chain(3)
+
+	tests := []struct {
+		name      string
+		circuit   *circuit.Circuit
+		wantDepth int
+		wantMuls  int
+	}{
+		{"chain of 8", &circuit.Circuit{Root: chain(8), NParties: 8}, 3, 7},
+		{"chain of 5", &circuit.Circuit{Root: chain(5), NParties: 8}, 3, 4},
+		{"chain of sums", &circuit.Circuit{Root: gate.NewMul(gate.NewAdd(gate.NewAdd(in[0], in[1]), in[2]), in[3]), NParties: 8}, 1, 1},
+		{
+			// The product of the first 3 inputs is also an output, so it is computed once, and is an operand of the
+			// other output's chain.
+			"shared",
+			&circuit.Circuit{Outputs: []circuit.Output{
+				{Name: "shared", Gate: shared},
+				{Name: "product", Gate: gate.NewMul(gate.NewMul(gate.NewMul(shared, in[3]), in[4]), in[5])},
+			}, NParties: 8},
+			3,
+			5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Rebalance(tt.circuit)
+			if d := depth(got); d != tt.wantDepth {
+				t.Errorf("Rebalance() has multiplicative depth %d, want %d", d, tt.wantDepth)
+			}
+			if n := count(got, "MUL"); n != tt.wantMuls {
+				t.Errorf("Rebalance() has %d MUL gates, want %d", n, tt.wantMuls)
+			}
+			want, wantErr := tt.circuit.ComputeExpected(secrets, fld)
+			if got, err := got.ComputeExpected(secrets, fld); err != nil || wantErr != nil || fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("Rebalance().ComputeExpected(%v) = %d, %v, want %d, %v", secrets, got, err, want, wantErr)
+			}
+		})
+	}
+}
+
+func TestOptimize_Expr(t *testing.T) {
+	c, err := expr.Compile("out = x0*x1*x2*x3*x4*x5 + x0*x1*2 - x2*0")
+	if err != nil {
+		t.Fatalf("Compile() failed with %v", err)
+	}
+
+	got := Optimize(c)
+	// The product is rebalanced, and x0*x1 is shared with it.
+	if d := depth(got); d != 3 {
+		t.Errorf("Optimize() has multiplicative depth %d, want 3", d)
+	}
+	if n := count(got, "MUL"); n != 5 {
+		t.Errorf("Optimize() has %d MUL gates, want 5", n)
+	}
+	secrets := [][]*big.Int{field.Ints(2), field.Ints(3), field.Ints(4), field.Ints(5), field.Ints(6), field.Ints(7)}
+	fld := field.New(field.Int(1000003))
+	// 2*3*4*5*6*7 + 2*3*2 = 5052.
+	if got, err := got.ComputeExpected(secrets, fld); err != nil || fmt.Sprint(got) != fmt.Sprint(field.Ints(5052)) {
+		t.Errorf("Optimize().ComputeExpected(%v) = %d, %v, want %d", secrets, got, err, field.Ints(5052))
+	}
+}
+
+func TestOptimize_KeepsInputs(t *testing.T) {
+	tests := []struct {
+		src     string
+		secrets [][]*big.Int
+		want    []*big.Int
+	}{{
+		src:     "out = 0*x0 + x1",
+		secrets: [][]*big.Int{field.Ints(3), field.Ints(4)},
+		want:    field.Ints(4),
+	}, {
+		src:     "out = x0 - x0 + x1",
+		secrets: [][]*big.Int{field.Ints(3), field.Ints(4)},
+		want:    field.Ints(4),
+	}, {
+		// Every input of party 0 is removed, as well as the last input of party 1.
+		src:     "input a @ 1\ninput b @ 1\nlet p = x0*b\nout = (p - p)*x2 + a",
+		secrets: [][]*big.Int{field.Ints(3), field.Ints(4, 5), field.Ints(6)},
+		want:    field.Ints(4),
+	}, {
+		src:     "out = 5 + 0*x0*x1",
+		secrets: [][]*big.Int{field.Ints(3), field.Ints(4)},
+		want:    field.Ints(5),
+	}}
+
+	fld := field.New(field.Int(1009))
+	for _, tc := range tests {
+		t.Run(tc.src, func(t *testing.T) {
+			c, err := expr.Compile(tc.src)
+			if err != nil {
+				t.Fatalf("Compile() failed with %v", err)
+			}
+
+			got := Optimize(c)
+			// The optimized circuit should take the same secrets as the original.
+			if err := got.CheckInputs(tc.secrets); err != nil {
+				t.Errorf("Optimize().CheckInputs(%v) failed with %v", tc.secrets, err)
+			}
+			if n := count(got, "MUL"); n != 0 {
+				t.Errorf("Optimize() has %d MUL gates, want 0", n)
+			}
+			if out, err := got.ComputeExpected(tc.secrets, fld); err != nil || fmt.Sprint(out) != fmt.Sprint(tc.want) {
+				t.Errorf("Optimize().ComputeExpected(%v) = %d, %v, want %d", tc.secrets, out, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestOptimize_DivisionByZero(t *testing.T) {
+	x, y := &gate.Input{Party: 0}, &gate.Input{Party: 1}
+	quotient := gate.NewDiv(y, x)
+	tests := []struct {
+		name string
+		root gate.Gate
+	}{{
+		name: "Inv times 0",
+		root: gate.NewMul(gate.NewInv(x), gate.NewConst(field.Int(0))),
+	}, {
+		name: "Scaled Div times 0",
+		root: gate.NewMul(gate.NewConst(field.Int(0)), gate.NewMul(quotient, gate.NewConst(field.Int(2)))),
+	}, {
+		name: "Div minus itself",
+		root: gate.NewSub(quotient, quotient),
+	}}
+
+	// x is 0, so dividing by it fails, even though the result would be multiplied by 0.
+	secrets := [][]*big.Int{field.Ints(0), field.Ints(4)}
+	fld := field.New(field.Int(1009))
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &circuit.Circuit{Root: tc.root, NParties: 2}
+			want, wantErr := c.ComputeExpected(secrets, fld)
+			if !errors.Is(wantErr, circuit.ErrDivisionByZero) {
+				t.Fatalf("ComputeExpected(%v) = %d, %v, want an error wrapping %v", secrets, want, wantErr, circuit.ErrDivisionByZero)
+			}
+			// The gates are numbered differently once constants are folded, so only the cause is compared.
+			if got, err := Optimize(c).ComputeExpected(secrets, fld); !errors.Is(err, circuit.ErrDivisionByZero) {
+				t.Errorf("Optimize().ComputeExpected(%v) = %d, %v, want an error wrapping %v", secrets, got, err, circuit.ErrDivisionByZero)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package optimize
+
+import (
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/gate"
+)
+
+// Rebalance rebuilds chains of associative gates of the same type, i.e. Add, Mul, Xor or And, so that their
+// multiplicative depth is as small as possible. For example, the product ((x0*x1)*x2)*x3 has depth 3, but is rebuilt as
+// (x0*x1)*(x2*x3), which has depth 2. The operands of a chain are combined greedily, two of the shallowest at a time,
+// so operands which are already deep are multiplied last.
+//
+// A gate is only absorbed into the chain of the gate which uses it if it is not used by any other gate or output, so
+// that gates which are shared are still computed once.
+func Rebalance(c *circuit.Circuit) *circuit.Circuit {
+	uses := make(map[gate.Gate]int)
+	for _, g := range c.Traverse() {
+		for _, in := range []gate.Gate{g.First(), g.Second()} {
+			if in != nil {
+				uses[in]++
+			}
+		}
+	}
+	for _, out := range c.OutputGates() {
+		uses[out.Gate]++
+	}
+	// absorbed returns whether in is part of the chain of g, which uses it.
+	absorbed := func(g, in gate.Gate) bool {
+		return associative(g) && in.Type() == g.Type() && uses[in] == 1
+	}
+
+	// absorbedBy are the gates which are part of the chain of another gate, so they are rebuilt by that gate.
+	absorbedBy := make(map[gate.Gate]bool)
+	for _, g := range c.Traverse() {
+		for _, in := range []gate.Gate{g.First(), g.Second()} {
+			if in != nil && absorbed(g, in) {
+				absorbedBy[in] = true
+			}
+		}
+	}
+
+	// replacements are the gates which have been rewritten so far, which include the operands of each chain before it
+	// is rebuilt, since gates are rewritten in the order of c.Traverse.
+	replacements := make(map[gate.Gate]gate.Gate)
+	depths := make(map[gate.Gate]int)
+	return rewrite(c, func(g, first, second gate.Gate) gate.Gate {
+		var res gate.Gate
+		if associative(g) && !absorbedBy[g] {
+			var ops []gate.Gate
+			for _, op := range operands(g, absorbed) {
+				ops = append(ops, replacements[op])
+			}
+			res = rebuild(g, ops, depths)
+		} else {
+			// The replacements of gates which are absorbed are not used, since their chains are rebuilt.
+			res = g.Copy(first, second)
+			setDepth(res, depths)
+		}
+		replacements[g] = res
+		return res
+	})
+}
+
+// operands returns the operands of the chain which ends at g, from left to right, where absorbed returns whether an
+// input of a gate in the chain is also part of it.
+func operands(g gate.Gate, absorbed func(g, in gate.Gate) bool) []gate.Gate {
+	var res []gate.Gate
+	// This is an iterative depth-first search, so that long chains do not overflow the call stack.
+	stack := []gate.Gate{g}
+	for len(stack) > 0 {
+		var next gate.Gate
+		stack, next = pop(stack)
+		if next != g && !absorbed(g, next) {
+			res = append(res, next)
+			continue
+		}
+		// Push the second input first, so that the first input is visited first.
+		stack = append(stack, next.Second(), next.First())
+	}
+	return res
+}
+
+// rebuild returns a gate of the same type as g which combines operands, so that its multiplicative depth is as small as
+// possible. The depths of operands must already be in depths, and the gates that it creates are added to it.
+func rebuild(g gate.Gate, operands []gate.Gate, depths map[gate.Gate]int) gate.Gate {
+	for len(operands) > 1 {
+		// Find the two shallowest operands, taking the first in case of a tie so that the result is deterministic.
+		i, j := -1, -1
+		for k, op := range operands {
+			switch {
+			case i == -1 || depths[op] < depths[operands[i]]:
+				i, j = k, i
+			case j == -1 || depths[op] < depths[operands[j]]:
+				j = k
+			}
+		}
+		if j < i {
+			i, j = j, i
+		}
+
+		combined := g.Copy(operands[i], operands[j])
+		setDepth(combined, depths)
+		// Remove both operands and add the combined gate at the end, so that operands of the same depth form a
+		// balanced tree.
+		operands = append(append(operands[:i:i], operands[i+1:j]...), operands[j+1:]...)
+		operands = append(operands, combined)
+	}
+	return operands[0]
+}
+
+// setDepth records the multiplicative depth of g, whose inputs must already be in depths.
+func setDepth(g gate.Gate, depths map[gate.Gate]int) {
+	if _, ok := depths[g]; ok {
+		return
+	}
+	depth := 0
+	if fst := g.First(); fst != nil {
+		depth = depths[fst]
+	}
+	if snd := g.Second(); snd != nil && depths[snd] > depth {
+		depth = depths[snd]
+	}
+	if isMul(g) {
+		depth++
+	}
+	depths[g] = depth
+}
+
+// associative returns whether gates of the same type as g can be combined in any order.
+func associative(g gate.Gate) bool {
+	switch g.(type) {
+	case *gate.Add, *gate.Mul, *gate.Xor, *gate.And:
+		return true
+	default:
+		return false
+	}
+}
+
+// isMul returns whether g is a multiplication in either the prime or the binary field, as in circuit.Layers.
+func isMul(g gate.Gate) bool {
+	switch g.(type) {
+	case *gate.Mul, *gate.And:
+		return true
+	default:
+		return false
+	}
+}
+
+func pop(stack []gate.Gate) ([]gate.Gate, gate.Gate) {
+	return stack[:len(stack)-1], stack[len(stack)-1]
+}
@@ -0,0 +1,173 @@
+package optimize
+
+import (
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"math/big"
+)
+
+// Simplify applies algebraic simplifications to the arithmetic gates of c, in a single pass from the inputs:
+//
+//   - gates whose inputs are all constants are folded into a constant, except for division and inversion, which
+//     depend on the field;
+//   - a wire is combined with a constant using AddConst or MulConst, so multiplying by a constant needs no
+//     communication;
+//   - adding 0 or multiplying by 1 is removed, and multiplying by 0 gives 0;
+//   - consecutive AddConst or MulConst gates are merged;
+//   - x - x is 0, and double negations cancel, as do double NOT gates.
+//
+// Since constants are folded as integers rather than field elements, they are reduced when the circuit is evaluated.
+// x*0 and x - x are only folded if x cannot fail, so that ComputeExpected returns the same error, such as a division by
+// zero, before and after. Any input of a party which is removed is kept by keepInputs, so the circuit takes the same
+// secrets.
+func Simplify(c *circuit.Circuit) *circuit.Circuit {
+	return keepInputs(c, rewrite(c, simplify))
+}
+
+// inputKey identifies an input of a circuit.
+type inputKey struct {
+	party, index int
+}
+
+// keepInputs returns res, which was rewritten from c, with every input of c that res no longer uses multiplied by 0
+// and added to the last gate of res in the prime field. This costs no communication, but means that res has the same
+// inputs as c, so that c.CheckInputs and res.CheckInputs accept the same secrets.
+func keepInputs(c, res *circuit.Circuit) *circuit.Circuit {
+	kept := make(map[inputKey]bool)
+	var anchor gate.Gate
+	for _, g := range res.Traverse() {
+		if in, ok := g.(*gate.Input); ok {
+			kept[inputKey{in.Party, in.Index}] = true
+		}
+		// Every circuit has a gate in the prime field, since the gates without inputs are all in the prime field.
+		if !circuit.IsBinary(g) {
+			anchor = g
+		}
+	}
+
+	var lost []gate.Gate
+	for _, g := range c.Traverse() {
+		if in, ok := g.(*gate.Input); ok && !kept[inputKey{in.Party, in.Index}] {
+			kept[inputKey{in.Party, in.Index}] = true
+			lost = append(lost, &gate.Input{Party: in.Party, Index: in.Index})
+		}
+	}
+	if len(lost) == 0 {
+		return res
+	}
+
+	zero := lost[0]
+	for _, in := range lost[1:] {
+		zero = gate.NewAdd(zero, in)
+	}
+	zero = gate.NewMulConst(zero, new(big.Int))
+	return rewrite(res, func(g, first, second gate.Gate) gate.Gate {
+		if g == anchor {
+			return gate.NewAdd(g.Copy(first, second), zero)
+		}
+		return g.Copy(first, second)
+	})
+}
+
+func simplify(g, first, second gate.Gate) gate.Gate {
+	fst, fstConst := constant(first)
+	snd, sndConst := constant(second)
+
+	switch v := g.(type) {
+	case *gate.Add:
+		switch {
+		case fstConst && sndConst:
+			return gate.NewConst(new(big.Int).Add(fst, snd))
+		case fstConst:
+			return addConst(second, fst)
+		case sndConst:
+			return addConst(first, snd)
+		}
+	case *gate.Sub:
+		switch {
+		case fstConst && sndConst:
+			return gate.NewConst(new(big.Int).Sub(fst, snd))
+		case sndConst:
+			return addConst(first, new(big.Int).Neg(snd))
+		case first == second && !mayFail(first):
+			return gate.NewConst(new(big.Int))
+		}
+	case *gate.Neg:
+		if fstConst {
+			return gate.NewConst(new(big.Int).Neg(fst))
+		}
+		if neg, ok := first.(*gate.Neg); ok {
+			return neg.First()
+		}
+	case *gate.Mul:
+		switch {
+		case fstConst && sndConst:
+			return gate.NewConst(new(big.Int).Mul(fst, snd))
+		case fstConst:
+			return mulConst(second, fst)
+		case sndConst:
+			return mulConst(first, snd)
+		}
+	case *gate.AddConst:
+		return addConst(first, v.Value)
+	case *gate.MulConst:
+		return mulConst(first, v.Value)
+	case *gate.Not:
+		if not, ok := first.(*gate.Not); ok {
+			return not.First()
+		}
+	}
+
+	return g.Copy(first, second)
+}
+
+// constant returns the value of g if it is a constant.
+func constant(g gate.Gate) (*big.Int, bool) {
+	if c, ok := g.(*gate.Const); ok {
+		return c.Value, true
+	}
+	return nil, false
+}
+
+// addConst returns a gate which adds value to g.
+func addConst(g gate.Gate, value *big.Int) gate.Gate {
+	switch v := g.(type) {
+	case *gate.Const:
+		return gate.NewConst(new(big.Int).Add(v.Value, value))
+	case *gate.AddConst:
+		return addConst(v.First(), new(big.Int).Add(v.Value, value))
+	}
+	if value.Sign() == 0 {
+		return g
+	}
+	return gate.NewAddConst(g, new(big.Int).Set(value))
+}
+
+// mulConst returns a gate which multiplies g by value.
+func mulConst(g gate.Gate, value *big.Int) gate.Gate {
+	switch v := g.(type) {
+	case *gate.Const:
+		return gate.NewConst(new(big.Int).Mul(v.Value, value))
+	case *gate.MulConst:
+		return mulConst(v.First(), new(big.Int).Mul(v.Value, value))
+	}
+	switch {
+	case value.Sign() == 0 && !mayFail(g):
+		return gate.NewConst(new(big.Int))
+	case value.Cmp(big.NewInt(1)) == 0:
+		return g
+	}
+	return gate.NewMulConst(g, new(big.Int).Set(value))
+}
+
+// mayFail returns whether ComputeExpected can fail to evaluate g, since it depends on a division or inversion, which
+// fails if the divisor is zero, or on a gate which fails if its input is not a bit.
+func mayFail(g gate.Gate) bool {
+	for _, h := range (&circuit.Circuit{Root: g}).Traverse() {
+		switch h.(type) {
+		case *gate.Inv, *gate.Div, *gate.ToBinary, *gate.BitDecompose:
+			return true
+		}
+	}
+	return false
+}
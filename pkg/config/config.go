@@ -1,13 +1,16 @@
-// Package config contains hardcoded circuit configurations.
+// Package config contains hardcoded circuit configurations, and reads and writes configurations as JSON or YAML.
 package config
 
 import (
 	"fmt"
 	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/circuit/bristol"
+	"github.com/sonjoonho/bgw/pkg/circuit/expr"
 	"github.com/sonjoonho/bgw/pkg/field"
 	"github.com/sonjoonho/bgw/pkg/gate"
 	"log"
 	"math"
+	"math/big"
 	"math/rand"
 	"os"
 	"time"
@@ -17,8 +20,8 @@ var logger = log.New(os.Stderr, "Config: ", 0)
 
 // Config is a configuration for the protocol.
 type Config struct {
-	// Secrets are the private values for each party.
-	Secrets []int
+	// Secrets are the private inputs of each party, indexed by party id then by gate.Input.Index.
+	Secrets [][]*big.Int
 	// Circuit is the circuit to be evaluated. A *copy* of this should be passed to each party to ensure that they do
 	// not share memory.
 	Circuit *circuit.Circuit
@@ -26,26 +29,30 @@ type Config struct {
 	Field field.Field
 	// Degree, also referred to as T, is the degree of polynomials used in Shamir Secret Sharing.
 	Degree int
+	// ErrorCorrection specifies whether parties reconstruct the output using Reed-Solomon error correction.
+	ErrorCorrection bool
+	// Beaver specifies whether parties multiply using Beaver triples, rather than by re-sharing every product.
+	Beaver bool
+	// Dealer specifies whether Beaver triples are generated by a trusted dealer, rather than by the parties themselves.
+	// It only applies if Beaver is set.
+	Dealer bool
 }
 
 // New selects a configuration and performs validation on user inputs.
-func New(prime int, seed, defaultSeed int64, degree, defaultDegree, circuit int) (*Config, error) {
-	if seed == defaultSeed {
-		seed = time.Now().UnixNano()
+func New(prime string, seed, defaultSeed int64, degree, defaultDegree, circuit int) (*Config, error) {
+	fld, err := newField(prime, seed, defaultSeed)
+	if err != nil {
+		return nil, err
 	}
 
-	rand.Seed(seed)
-
-	fld := field.New(prime)
-
 	var cfg *Config
 	switch circuit {
 	case 1:
 		cfg = config1(fld)
 	case 2:
-		cfg = config2(fld)
+		cfg, err = config2(fld)
 	case 3:
-		cfg = config3(fld)
+		cfg, err = config3(fld)
 	case 4:
 		cfg = config4(fld)
 	case 5:
@@ -60,10 +67,130 @@ func New(prime int, seed, defaultSeed int64, degree, defaultDegree, circuit int)
 		cfg = config9(fld)
 	case 10:
 		cfg = config10(fld)
+	case 11:
+		cfg = config11(fld)
+	case 12:
+		cfg = config12(fld)
+	case 13:
+		cfg = config13(fld)
+	case 14:
+		cfg = config14(fld)
+	case 15:
+		cfg = config15(fld)
+	case 16:
+		cfg = config16(fld)
+	case 17:
+		cfg = config17(fld)
 	default:
 		logger.Fatalf("Unrecognised circuit number: %d", circuit)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	return validate(cfg, degree, defaultDegree)
+}
+
+// NewFromFile creates a configuration for the Bristol Fashion circuit in the file at path (see bristol.Parse), and
+// performs validation on user inputs. Since the file only defines the circuit, each party's secrets are random, and are
+// bits if the circuit is boolean.
+func NewFromFile(prime string, seed, defaultSeed int64, degree, defaultDegree int, path string) (*Config, error) {
+	fld, err := newField(prime, seed, defaultSeed)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := bristol.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{
+		Secrets: RandomSecrets(c, fld),
+		Field:   fld,
+		Circuit: c,
+	}
+
+	return validate(cfg, degree, defaultDegree)
+}
+
+// NewFromExpr creates a configuration for the circuit compiled from the program src (see expr.Compile), and performs
+// validation on user inputs. Like NewFromFile, each party's secrets are random.
+func NewFromExpr(prime string, seed, defaultSeed int64, degree, defaultDegree int, src string) (*Config, error) {
+	fld, err := newField(prime, seed, defaultSeed)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := expr.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{
+		Secrets: RandomSecrets(c, fld),
+		Field:   fld,
+		Circuit: c,
+	}
+
+	return validate(cfg, degree, defaultDegree)
+}
+
+// RandomSecrets returns random secrets for every input of c. An input is a random bit if it is converted to the binary
+// field using gate.ToBinary, and a random element of fld otherwise.
+func RandomSecrets(c *circuit.Circuit, fld field.Field) [][]*big.Int {
+	// bits are indexed by party id then input index.
+	bits := make(map[[2]int]bool)
+	for _, g := range c.Traverse() {
+		if in, ok := g.First().(*gate.Input); ok {
+			if _, ok := g.(*gate.ToBinary); ok {
+				bits[[2]int{in.Party, in.Index}] = true
+			}
+		}
+	}
+
+	nInputs := c.NInputs()
+	secrets := make([][]*big.Int, c.NParties, c.NParties)
+	for party := range secrets {
+		secrets[party] = make([]*big.Int, nInputs[party], nInputs[party])
+		for index := range secrets[party] {
+			if bits[[2]int{party, index}] {
+				secrets[party][index] = big.NewInt(int64(rand.Intn(2)))
+			} else {
+				secrets[party][index] = fld.Rand()
+			}
+		}
+	}
+	return secrets
+}
+
+// newField seeds pseudorandom number generation, and returns the field with the given prime.
+func newField(prime string, seed, defaultSeed int64) (field.Field, error) {
+	seedRand(seed, defaultSeed)
+
+	fld, err := field.Parse(prime)
+	if err != nil {
+		return field.Field{}, err
+	}
+
+	// The error probability of ProbablyPrime(n) is at most 4^-n.
+	if !fld.Prime.ProbablyPrime(20) {
+		return field.Field{}, fmt.Errorf("prime=%d is not prime", fld.Prime)
+	}
+
+	return fld, nil
+}
+
+// seedRand seeds pseudorandom number generation with seed, or the current time if it is defaultSeed.
+func seedRand(seed, defaultSeed int64) {
+	if seed == defaultSeed {
+		seed = time.Now().UnixNano()
+	}
+
+	rand.Seed(seed)
+}
 
+// validate sets the degree of cfg, which is chosen automatically if it is defaultDegree, and checks it against the
+// circuit and secrets.
+func validate(cfg *Config, degree, defaultDegree int) (*Config, error) {
 	if degree == defaultDegree {
 		degree = (cfg.Circuit.NParties - 1) / 2
 	}
@@ -72,24 +199,39 @@ func New(prime int, seed, defaultSeed int64, degree, defaultDegree, circuit int)
 		return nil, fmt.Errorf("degree=%d cannot be negative", degree)
 	}
 
-	if !(2*degree < cfg.Circuit.NParties) {
-		return nil, fmt.Errorf("degree=%d does not satisfy 2T < N", degree)
+	// Multiplication additionally requires 2T < N, but that depends on the circuit and is checked by each party.
+	if !(degree < cfg.Circuit.NParties) {
+		return nil, fmt.Errorf("degree=%d does not satisfy T < N", degree)
 	}
 
 	cfg.Degree = degree
 
-	if nSecrets, nParties := len(cfg.Secrets), cfg.Circuit.NParties; nSecrets != nParties {
-		return nil, fmt.Errorf("length mismatch between number of secrets (%d) and number of parties (%d)", nSecrets, nParties)
+	// Every party needs a distinct non-zero point in the field.
+	if nParties := big.NewInt(int64(cfg.Circuit.NParties)); cfg.Field.Prime.Cmp(nParties) <= 0 {
+		return nil, fmt.Errorf("prime=%d is too small for %d parties, which need distinct non-zero points", cfg.Field.Prime, nParties)
+	}
+
+	if err := cfg.Circuit.CheckInputs(cfg.Secrets); err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
 }
 
+// OneEach returns the secrets for parties which each have a single input, where secrets[i] is the input of party i.
+func OneEach(secrets []*big.Int) [][]*big.Int {
+	res := make([][]*big.Int, len(secrets), len(secrets))
+	for i, s := range secrets {
+		res[i] = []*big.Int{s}
+	}
+	return res
+}
+
 // This is the example from Smart (p. 445).
-func config1(field field.Field) *Config {
+func config1(fld field.Field) *Config {
 	return &Config{
-		Secrets: []int{20, 40, 21, 31, 1, 71},
-		Field:   field,
+		Secrets: OneEach(field.Ints(20, 40, 21, 31, 1, 71)),
+		Field:   fld,
 		Circuit: &circuit.Circuit{
 			Root: gate.NewAdd(
 				gate.NewAdd(
@@ -111,72 +253,66 @@ func config1(field field.Field) *Config {
 	}
 }
 
-// multree creates the gates for a multiplication of every party's input and returns the root gate.
-func multree(nParties int, partyIdx int, field field.Field) gate.Gate {
-	if nParties%2 == 1 {
-		return gate.NewMul(
-			&gate.Input{Party: partyIdx},
-			multree(nParties-1, partyIdx+1, field),
-		)
-	}
-	left := gate.NewMul(
-		&gate.Input{Party: partyIdx},
-		&gate.Input{Party: partyIdx + 1},
-	)
-	if nParties == 2 {
-		return left
-	}
-	return gate.NewMul(
-		left,
-		multree(nParties-2, partyIdx+2, field),
-	)
+// multree creates a circuit which multiplies every party's input, using a balanced tree of multiplications.
+func multree(nParties int) (*circuit.Circuit, error) {
+	b := circuit.NewBuilder(nParties)
+	inputs := make([]circuit.Wire, nParties, nParties)
+	for i := range inputs {
+		inputs[i] = b.Input(i)
+	}
+	b.Output(b.Product(inputs...))
+	return b.Build()
 }
 
-func config2(field field.Field) *Config {
+func config2(fld field.Field) (*Config, error) {
 	nParties := int(math.Pow(2, 3))
-	root := multree(nParties, 0, field)
 
-	secrets := make([]int, nParties)
+	secrets := make([][]*big.Int, nParties)
 	for i := 0; i < nParties; i++ {
-		secrets[i] = i + 1
+		secrets[i] = field.Ints(i + 1)
+	}
+	c, err := multree(nParties)
+	if err != nil {
+		return nil, err
 	}
 	return &Config{
 		Secrets: secrets,
-		Field:   field,
-		Circuit: &circuit.Circuit{
-			Root:     root,
-			NParties: nParties,
-		},
-	}
+		Field:   fld,
+		Circuit: c,
+	}, nil
 }
 
 // Fibonacci sequence.
-func config3(field field.Field) *Config {
+func config3(fld field.Field) (*Config, error) {
 	n := 10
-	return &Config{
-		Secrets: []int{0, 1},
-		Field:   field,
-		Circuit: &circuit.Circuit{
-			Root:     fibonacci(n),
-			NParties: 2,
-		},
+	c, err := fibonacci(n)
+	if err != nil {
+		return nil, err
 	}
+	return &Config{
+		Secrets: OneEach(field.Ints(0, 1)),
+		Field:   fld,
+		Circuit: c,
+	}, nil
 }
 
-// fibonacci creates the gates for computing the nth fibonacci number and returns the root gate.
-func fibonacci(n int) gate.Gate {
-	fibGates := []gate.Gate{&gate.Input{Party: 0}, &gate.Input{Party: 1}}
+// fibonacci creates a circuit which computes the nth fibonacci number, where n is at least 2, from the first two terms
+// input by parties 0 and 1.
+func fibonacci(n int) (*circuit.Circuit, error) {
+	b := circuit.NewBuilder(2)
+	prev, cur := b.Input(0), b.Input(1)
 	for k := 2; k <= n; k++ {
-		fibGates = append(fibGates, gate.NewAdd(fibGates[len(fibGates)-1], fibGates[len(fibGates)-2]))
+		prev, cur = cur, b.Add(cur, prev)
 	}
-	return fibGates[len(fibGates)-1]
+	b.Output(cur)
+	return b.Build()
 }
 
 // A single add gate.
-func config4(field field.Field) *Config {
+func config4(fld field.Field) *Config {
 	return &Config{
-		Secrets: []int{5, 28},
-		Field:   field,
+		Secrets: OneEach(field.Ints(5, 28)),
+		Field:   fld,
 		Circuit: &circuit.Circuit{
 			Root: gate.NewAdd(
 				&gate.Input{Party: 0},
@@ -188,10 +324,10 @@ func config4(field field.Field) *Config {
 }
 
 // Two add gates.
-func config5(field field.Field) *Config {
+func config5(fld field.Field) *Config {
 	return &Config{
-		Secrets: []int{5, 28, 6},
-		Field:   field,
+		Secrets: OneEach(field.Ints(5, 28, 6)),
+		Field:   fld,
 		Circuit: &circuit.Circuit{
 			Root: gate.NewAdd(
 				&gate.Input{Party: 0},
@@ -206,10 +342,10 @@ func config5(field field.Field) *Config {
 }
 
 // An add gate and multiplication gate.
-func config6(field field.Field) *Config {
+func config6(fld field.Field) *Config {
 	return &Config{
-		Secrets: []int{10, 20, 30},
-		Field:   field,
+		Secrets: OneEach(field.Ints(10, 20, 30)),
+		Field:   fld,
 		Circuit: &circuit.Circuit{
 			Root: gate.NewMul(
 				gate.NewAdd(
@@ -224,10 +360,10 @@ func config6(field field.Field) *Config {
 }
 
 // Two multiplication gates.
-func config7(field field.Field) *Config {
+func config7(fld field.Field) *Config {
 	return &Config{
-		Secrets: []int{1, 2, 3},
-		Field:   field,
+		Secrets: OneEach(field.Ints(1, 2, 3)),
+		Field:   fld,
 		Circuit: &circuit.Circuit{
 			Root: gate.NewMul(
 				gate.NewMul(
@@ -241,10 +377,10 @@ func config7(field field.Field) *Config {
 }
 
 // Many addition gates.
-func config8(field field.Field) *Config {
+func config8(fld field.Field) *Config {
 	return &Config{
-		Secrets: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17},
-		Field:   field,
+		Secrets: OneEach(field.Ints(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17)),
+		Field:   fld,
 		Circuit: &circuit.Circuit{
 			Root: gate.NewAdd(&gate.Input{Party: 0}, gate.NewAdd(
 				&gate.Input{Party: 1},
@@ -298,27 +434,27 @@ func config8(field field.Field) *Config {
 }
 
 // Party 0 has two inputs into the circuit.
-func config9(field field.Field) *Config {
+func config9(fld field.Field) *Config {
 	return &Config{
-		Secrets: []int{1, 2},
-		Field:   field,
+		Secrets: [][]*big.Int{field.Ints(1, 3), field.Ints(2)},
+		Field:   fld,
 		Circuit: &circuit.Circuit{
 			Root: gate.NewMul(
 				gate.NewMul(
 					&gate.Input{Party: 0},
 					&gate.Input{Party: 1},
 				),
-				&gate.Input{Party: 0}),
+				&gate.Input{Party: 0, Index: 1}),
 			NParties: 2,
 		},
 	}
 }
 
 // Many multiplication gates.
-func config10(field field.Field) *Config {
+func config10(fld field.Field) *Config {
 	return &Config{
-		Secrets: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17},
-		Field:   field,
+		Secrets: OneEach(field.Ints(1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17)),
+		Field:   fld,
 		Circuit: &circuit.Circuit{
 			Root: gate.NewMul(&gate.Input{Party: 0}, gate.NewMul(
 				&gate.Input{Party: 1},
@@ -370,3 +506,158 @@ func config10(field field.Field) *Config {
 		},
 	}
 }
+
+// The sum and the sum of squares of every party's input, as two outputs.
+func config11(fld field.Field) *Config {
+	nParties := 5
+	inputs := make([]gate.Gate, nParties, nParties)
+	for i := range inputs {
+		inputs[i] = &gate.Input{Party: i}
+	}
+
+	// Each input is used by both outputs.
+	sum, squares := inputs[0], gate.NewMul(inputs[0], inputs[0])
+	for _, in := range inputs[1:] {
+		sum = gate.NewAdd(sum, in)
+		squares = gate.NewAdd(squares, gate.NewMul(in, in))
+	}
+
+	return &Config{
+		Secrets: OneEach(field.Ints(3, 1, 4, 1, 5)),
+		Field:   fld,
+		Circuit: &circuit.Circuit{
+			Outputs: []circuit.Output{
+				{Name: "sum", Gate: sum},
+				{Name: "sum of squares", Gate: squares},
+			},
+			NParties: nParties,
+		},
+	}
+}
+
+// Party 0 learns a score computed from every other party's data, weighted by its own input, while only the other
+// parties learn the total of their data.
+func config12(fld field.Field) *Config {
+	nParties := 4
+	var total gate.Gate = &gate.Input{Party: 1}
+	for i := 2; i < nParties; i++ {
+		total = gate.NewAdd(total, &gate.Input{Party: i})
+	}
+
+	return &Config{
+		Secrets: OneEach(field.Ints(3, 10, 20, 30)),
+		Field:   fld,
+		Circuit: &circuit.Circuit{
+			Outputs: []circuit.Output{
+				{Name: "score", Gate: gate.NewMul(&gate.Input{Party: 0}, total), Recipients: []int{0}},
+				{Name: "total", Gate: total, Recipients: []int{1, 2, 3}},
+			},
+			NParties: nParties,
+		},
+	}
+}
+
+// An affine function of the inputs, 3 * (x + y) + 7, which uses public constants rather than party inputs.
+func config13(fld field.Field) *Config {
+	return &Config{
+		Secrets: OneEach(field.Ints(5, 8)),
+		Field:   fld,
+		Circuit: &circuit.Circuit{
+			Root: gate.NewAddConst(
+				gate.NewMulConst(
+					gate.NewAdd(
+						&gate.Input{Party: 0},
+						&gate.Input{Party: 1},
+					),
+					field.Int(3)),
+				field.Int(7)),
+			NParties: 2,
+		},
+	}
+}
+
+// The average of every party's data, weighted by how many items each party has. Each party inputs the total of its
+// data and the number of items, and the total of every party's data is divided by the total number of items.
+func config14(fld field.Field) *Config {
+	nParties := 3
+	var total, count gate.Gate = &gate.Input{Party: 0}, &gate.Input{Party: 0, Index: 1}
+	for i := 1; i < nParties; i++ {
+		total = gate.NewAdd(total, &gate.Input{Party: i})
+		count = gate.NewAdd(count, &gate.Input{Party: i, Index: 1})
+	}
+
+	return &Config{
+		Secrets: [][]*big.Int{field.Ints(30, 2), field.Ints(45, 3), field.Ints(25, 5)},
+		Field:   fld,
+		Circuit: &circuit.Circuit{
+			Root:     gate.NewDiv(total, count),
+			NParties: nParties,
+		},
+	}
+}
+
+// A fair coin toss, which no party can bias, decides whether party 0's or party 1's input is revealed, computing
+// y + b * (x - y) for a random bit b.
+func config15(fld field.Field) *Config {
+	x, y := &gate.Input{Party: 0}, &gate.Input{Party: 1}
+
+	return &Config{
+		Secrets: [][]*big.Int{field.Ints(42), field.Ints(17), {}},
+		Field:   fld,
+		Circuit: &circuit.Circuit{
+			Root:     gate.NewAdd(y, gate.NewMul(gate.NewRandomBit(), gate.NewSub(x, y))),
+			NParties: 3,
+		},
+	}
+}
+
+// A sealed-bid auction, which reveals the highest of every party's bid and whether party 0 won, but nothing else about
+// the bids. max(a, b) is computed as a + (a < b) * (b - a).
+func config16(fld field.Field) *Config {
+	nParties := 3
+	first := &gate.Input{Party: 0}
+	var highest gate.Gate = first
+	for i := 1; i < nParties; i++ {
+		bid := &gate.Input{Party: i}
+		highest = gate.NewAdd(highest, gate.NewMul(gate.NewLessThan(highest, bid), gate.NewSub(bid, highest)))
+	}
+
+	return &Config{
+		Secrets: OneEach(field.Ints(35, 72, 58)),
+		Field:   fld,
+		Circuit: &circuit.Circuit{
+			Outputs: []circuit.Output{
+				{Name: "highest bid", Gate: highest},
+				{Name: "party 0 won", Gate: gate.NewEqual(first, highest)},
+			},
+			NParties: nParties,
+		},
+	}
+}
+
+// Whether party 0's and party 1's 4-bit values are equal, computed as a boolean circuit over GF(2^8). Each party inputs
+// its bits, least significant first, and the values are equal if NOT (x_i XOR y_i) for every bit i.
+func config17(fld field.Field) *Config {
+	nBits := 4
+	var equal gate.Gate
+	for i := 0; i < nBits; i++ {
+		x := gate.NewToBinary(&gate.Input{Party: 0, Index: i})
+		y := gate.NewToBinary(&gate.Input{Party: 1, Index: i})
+		same := gate.NewNot(gate.NewXor(x, y))
+		if equal == nil {
+			equal = same
+		} else {
+			equal = gate.NewAnd(equal, same)
+		}
+	}
+
+	return &Config{
+		// 11 = 0b1011.
+		Secrets: [][]*big.Int{field.Ints(1, 1, 0, 1), field.Ints(1, 1, 0, 1), {}},
+		Field:   fld,
+		Circuit: &circuit.Circuit{
+			Root:     equal,
+			NParties: 3,
+		},
+	}
+}
@@ -0,0 +1,437 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/field"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"gopkg.in/yaml.v3"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format is a format in which a configuration can be stored.
+type Format int
+
+const (
+	JSON Format = iota
+	YAML
+)
+
+// FormatOf returns the format of the file at path, from its extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON, nil
+	case ".yaml", ".yml":
+		return YAML, nil
+	default:
+		return 0, fmt.Errorf("%s: unrecognised extension, want .json, .yaml or .yml", path)
+	}
+}
+
+// File is the schema of a configuration stored as JSON or YAML. Values, including the prime, may be arbitrarily large
+// integers, which are written as numbers. Keys are the same in both formats. For example:
+//
+//	{
+//	  "parties": 2,
+//	  "prime": 101,
+//	  "degree": 0,
+//	  "secrets": [[3], [4]],
+//	  "gates": [
+//	    {"id": "x", "type": "INPUT", "party": 0},
+//	    {"id": "y", "type": "INPUT", "party": 1},
+//	    {"id": "product", "type": "MUL", "inputs": ["x", "y"]}
+//	  ],
+//	  "root": "product"
+//	}
+type File struct {
+	// Parties is the number of parties, circuit.Circuit.NParties.
+	Parties int `json:"parties" yaml:"parties"`
+	// Prime is the prime of the field.
+	Prime *big.Int `json:"prime" yaml:"prime"`
+	// Degree is the degree of polynomials used in Shamir Secret Sharing. If it is omitted, it is set to (N-1)/2.
+	Degree *int `json:"degree,omitempty" yaml:"degree,omitempty"`
+	// ErrorCorrection, Beaver and Dealer are the options of Config with the same names.
+	ErrorCorrection bool `json:"errorCorrection,omitempty" yaml:"errorCorrection,omitempty"`
+	Beaver          bool `json:"beaver,omitempty" yaml:"beaver,omitempty"`
+	Dealer          bool `json:"dealer,omitempty" yaml:"dealer,omitempty"`
+	// Secrets are the private inputs of each party, indexed by party id then by input index.
+	Secrets [][]*big.Int `json:"secrets" yaml:"secrets"`
+	// Gates are the gates of the circuit. Each gate may only use gates which come before it as inputs.
+	Gates []GateSpec `json:"gates" yaml:"gates"`
+	// Root is the id of the output gate of a circuit with a single output. Exactly one of Root and Outputs must be set.
+	Root string `json:"root,omitempty" yaml:"root,omitempty"`
+	// Outputs are the outputs of a circuit with several outputs.
+	Outputs []OutputSpec `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+}
+
+// GateSpec is a gate of a File.
+type GateSpec struct {
+	// ID identifies the gate, so that it can be used as the input to other gates and as an output. It must be unique.
+	ID string `json:"id" yaml:"id"`
+	// Type is one of the types in gateTypes, e.g. ADD.
+	Type string `json:"type" yaml:"type"`
+	// Inputs are the ids of the inputs of the gate, in order.
+	Inputs []string `json:"inputs,omitempty" yaml:"inputs,omitempty,flow"`
+	// Party and Index identify the input slot of an INPUT gate.
+	Party int `json:"party,omitempty" yaml:"party,omitempty"`
+	Index int `json:"index,omitempty" yaml:"index,omitempty"`
+	// Value is the constant of a CONST, ADDC or MULC gate.
+	Value *big.Int `json:"value,omitempty" yaml:"value,omitempty"`
+	// Bit is the index of the bit output by a BIT gate.
+	Bit int `json:"bit,omitempty" yaml:"bit,omitempty"`
+}
+
+// OutputSpec is an output of a File.
+type OutputSpec struct {
+	Name string `json:"name" yaml:"name"`
+	// Gate is the id of the gate whose output is revealed.
+	Gate string `json:"gate" yaml:"gate"`
+	// Recipients are the ids of the parties which learn the output. If it is empty, every party learns the output.
+	Recipients []int `json:"recipients,omitempty" yaml:"recipients,omitempty,flow"`
+}
+
+// gateType describes how a type of gate is built from a GateSpec.
+type gateType struct {
+	// nInputs is the number of inputs of the gate.
+	nInputs int
+	// value specifies whether the gate has a constant Value.
+	value bool
+	// build returns the gate with the specified inputs.
+	build func(spec GateSpec, ins []gate.Gate) gate.Gate
+}
+
+// gateTypes are the types of gate in a File, which are the same as gate.Gate.Type, except for INPUT and BIT whose
+// parameters are given separately.
+var gateTypes = map[string]gateType{
+	"INPUT": {0, false, func(spec GateSpec, _ []gate.Gate) gate.Gate {
+		return &gate.Input{Party: spec.Party, Index: spec.Index}
+	}},
+	"CONST": {0, true, func(spec GateSpec, _ []gate.Gate) gate.Gate { return gate.NewConst(spec.Value) }},
+	"RAND":  {0, false, func(GateSpec, []gate.Gate) gate.Gate { return gate.NewRandom() }},
+	"RBIT":  {0, false, func(GateSpec, []gate.Gate) gate.Gate { return gate.NewRandomBit() }},
+	"ADD":   {2, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewAdd(ins[0], ins[1]) }},
+	"SUB":   {2, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewSub(ins[0], ins[1]) }},
+	"MUL":   {2, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewMul(ins[0], ins[1]) }},
+	"NEG":   {1, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewNeg(ins[0]) }},
+	"ADDC":  {1, true, func(spec GateSpec, ins []gate.Gate) gate.Gate { return gate.NewAddConst(ins[0], spec.Value) }},
+	"MULC":  {1, true, func(spec GateSpec, ins []gate.Gate) gate.Gate { return gate.NewMulConst(ins[0], spec.Value) }},
+	"INV":   {1, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewInv(ins[0]) }},
+	"DIV":   {2, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewDiv(ins[0], ins[1]) }},
+	"EQ":    {2, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewEqual(ins[0], ins[1]) }},
+	"LT":    {2, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewLessThan(ins[0], ins[1]) }},
+	"BIT":   {1, false, func(spec GateSpec, ins []gate.Gate) gate.Gate { return gate.NewBitDecompose(ins[0], spec.Bit) }},
+	"XOR":   {2, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewXor(ins[0], ins[1]) }},
+	"AND":   {2, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewAnd(ins[0], ins[1]) }},
+	"NOT":   {1, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewNot(ins[0]) }},
+	"A2B":   {1, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewToBinary(ins[0]) }},
+	"B2A":   {1, false, func(_ GateSpec, ins []gate.Gate) gate.Gate { return gate.NewToArithmetic(ins[0]) }},
+}
+
+// Load reads the configuration in the file at path, in the format given by its extension, and seeds pseudorandom number
+// generation in the same way as New.
+func Load(path string, seed, defaultSeed int64) (*Config, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seedRand(seed, defaultSeed)
+	cfg, err := Read(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// Save writes cfg to the file at path, in the format given by its extension.
+func Save(path string, cfg *Config) error {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, cfg, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read reads a configuration in the specified format, and validates it. Unknown keys are rejected, and errors in the
+// circuit identify the offending gate by its position and id, e.g. gates[3] ("sum").
+func Read(r io.Reader, format Format) (*Config, error) {
+	var f File
+	switch format {
+	case JSON:
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			return nil, err
+		}
+	case YAML:
+		dec := yaml.NewDecoder(r)
+		dec.KnownFields(true)
+		if err := dec.Decode(&f); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown format %d", format)
+	}
+	return f.Config()
+}
+
+// Config returns the configuration described by f, and validates it.
+func (f *File) Config() (*Config, error) {
+	if f.Prime == nil {
+		return nil, fmt.Errorf("prime is missing")
+	}
+	fld := field.New(f.Prime)
+	// The error probability of ProbablyPrime(n) is at most 4^-n.
+	if !fld.Prime.ProbablyPrime(20) {
+		return nil, fmt.Errorf("prime=%d is not prime", fld.Prime)
+	}
+
+	c, err := f.circuit()
+	if err != nil {
+		return nil, err
+	}
+	// A secret is nil if it is null in the file.
+	for party, secrets := range f.Secrets {
+		for index, secret := range secrets {
+			if secret == nil {
+				return nil, fmt.Errorf("secrets[%d][%d] is missing", party, index)
+			}
+		}
+	}
+
+	cfg := &Config{
+		Secrets:         f.Secrets,
+		Circuit:         c,
+		Field:           fld,
+		ErrorCorrection: f.ErrorCorrection,
+		Beaver:          f.Beaver,
+		Dealer:          f.Dealer,
+	}
+	if cfg.Dealer && !cfg.Beaver {
+		return nil, fmt.Errorf("dealer requires beaver")
+	}
+	degree := -1
+	if f.Degree != nil {
+		degree = *f.Degree
+	}
+	return validate(cfg, degree, -1)
+}
+
+// circuit builds the circuit described by f.
+func (f *File) circuit() (*circuit.Circuit, error) {
+	if f.Parties < 1 {
+		return nil, fmt.Errorf("parties=%d must be positive", f.Parties)
+	}
+
+	gates := make(map[string]gate.Gate)
+	for i, spec := range f.Gates {
+		g, err := f.gate(spec, gates)
+		if err != nil {
+			return nil, fmt.Errorf("gates[%d] (%q): %v", i, spec.ID, err)
+		}
+		gates[spec.ID] = g
+	}
+
+	c := &circuit.Circuit{NParties: f.Parties}
+	switch {
+	case f.Root != "" && len(f.Outputs) > 0:
+		return nil, fmt.Errorf("only one of root and outputs can be set")
+	case f.Root != "":
+		if c.Root = gates[f.Root]; c.Root == nil {
+			return nil, fmt.Errorf("root: gate %q is not defined", f.Root)
+		}
+	case len(f.Outputs) > 0:
+		for i, out := range f.Outputs {
+			g := gates[out.Gate]
+			if g == nil {
+				return nil, fmt.Errorf("outputs[%d] (%q): gate %q is not defined", i, out.Name, out.Gate)
+			}
+			for _, r := range out.Recipients {
+				if r < 0 || r >= f.Parties {
+					return nil, fmt.Errorf("outputs[%d] (%q): recipient %d is not a party", i, out.Name, r)
+				}
+			}
+			c.Outputs = append(c.Outputs, circuit.Output{Name: out.Name, Gate: g, Recipients: out.Recipients})
+		}
+	default:
+		return nil, fmt.Errorf("either root or outputs must be set")
+	}
+
+	return c, nil
+}
+
+// gate builds the gate described by spec, whose inputs are in gates.
+func (f *File) gate(spec GateSpec, gates map[string]gate.Gate) (gate.Gate, error) {
+	if spec.ID == "" {
+		return nil, fmt.Errorf("id is missing")
+	}
+	if gates[spec.ID] != nil {
+		return nil, fmt.Errorf("id is not unique")
+	}
+	t, ok := gateTypes[spec.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", spec.Type)
+	}
+	if len(spec.Inputs) != t.nInputs {
+		return nil, fmt.Errorf("%s gate has %d inputs, want %d", spec.Type, len(spec.Inputs), t.nInputs)
+	}
+	if t.value != (spec.Value != nil) {
+		if t.value {
+			return nil, fmt.Errorf("%s gate has no value", spec.Type)
+		}
+		return nil, fmt.Errorf("%s gate cannot have a value", spec.Type)
+	}
+	switch spec.Type {
+	case "INPUT":
+		if spec.Party < 0 || spec.Party >= f.Parties {
+			return nil, fmt.Errorf("party %d is not a party", spec.Party)
+		}
+		if spec.Index < 0 {
+			return nil, fmt.Errorf("index %d cannot be negative", spec.Index)
+		}
+	case "BIT":
+		if spec.Bit < 0 {
+			return nil, fmt.Errorf("bit %d cannot be negative", spec.Bit)
+		}
+	}
+
+	ins := make([]gate.Gate, len(spec.Inputs), len(spec.Inputs))
+	for k, id := range spec.Inputs {
+		if ins[k] = gates[id]; ins[k] == nil {
+			return nil, fmt.Errorf("input %q is not defined by an earlier gate", id)
+		}
+	}
+
+	g := t.build(spec, ins)
+	if err := circuit.CheckDomain(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Write writes cfg in the specified format. Each gate is identified by its index in cfg.Circuit.Traverse, so the ids
+// match the gate numbers logged by each party.
+func Write(w io.Writer, cfg *Config, format Format) error {
+	f, err := NewFile(cfg)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if format == JSON {
+		_, err = w.Write(append(b, '\n'))
+		return err
+	}
+	if format != YAML {
+		return fmt.Errorf("unknown format %d", format)
+	}
+
+	// JSON is valid YAML, so it is decoded as a YAML document, which writes arbitrarily large integers as numbers.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	setStyle(&doc)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// setStyle clears the JSON style of n and its children, so that they are written in block style, except for lists of
+// scalars such as secrets and inputs, which are written on one line.
+func setStyle(n *yaml.Node) {
+	n.Style = 0
+	flow := n.Kind == yaml.SequenceNode
+	for _, child := range n.Content {
+		setStyle(child)
+		flow = flow && child.Kind == yaml.ScalarNode
+	}
+	if flow {
+		n.Style = yaml.FlowStyle
+	}
+}
+
+// NewFile returns the File which describes cfg.
+func NewFile(cfg *Config) (*File, error) {
+	c := cfg.Circuit
+	degree := cfg.Degree
+	f := &File{
+		Parties:         c.NParties,
+		Prime:           cfg.Field.Prime,
+		Degree:          &degree,
+		ErrorCorrection: cfg.ErrorCorrection,
+		Beaver:          cfg.Beaver,
+		Dealer:          cfg.Dealer,
+		Secrets:         cfg.Secrets,
+	}
+
+	ids := make(map[gate.Gate]string)
+	for i, g := range c.Traverse() {
+		spec, err := newGateSpec(g)
+		if err != nil {
+			return nil, fmt.Errorf("gate %d (%s): %v", i, g.Type(), err)
+		}
+		spec.ID = fmt.Sprintf("g%d", i)
+		for _, in := range []gate.Gate{g.First(), g.Second()} {
+			if in != nil {
+				spec.Inputs = append(spec.Inputs, ids[in])
+			}
+		}
+		ids[g] = spec.ID
+		f.Gates = append(f.Gates, spec)
+	}
+
+	if len(c.Outputs) == 0 {
+		f.Root = ids[c.Root]
+	}
+	for _, out := range c.Outputs {
+		f.Outputs = append(f.Outputs, OutputSpec{Name: out.Name, Gate: ids[out.Gate], Recipients: out.Recipients})
+	}
+
+	return f, nil
+}
+
+// newGateSpec returns the GateSpec which describes g, without its id and inputs.
+func newGateSpec(g gate.Gate) (GateSpec, error) {
+	switch v := g.(type) {
+	case *gate.Input:
+		return GateSpec{Type: "INPUT", Party: v.Party, Index: v.Index}, nil
+	case *gate.BitDecompose:
+		return GateSpec{Type: "BIT", Bit: v.Bit}, nil
+	case *gate.Const:
+		return GateSpec{Type: v.Type(), Value: v.Value}, nil
+	case *gate.AddConst:
+		return GateSpec{Type: v.Type(), Value: v.Value}, nil
+	case *gate.MulConst:
+		return GateSpec{Type: v.Type(), Value: v.Value}, nil
+	}
+	if _, ok := gateTypes[g.Type()]; !ok {
+		return GateSpec{}, fmt.Errorf("unsupported gate")
+	}
+	return GateSpec{Type: g.Type()}, nil
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWrite_RoundTrip(t *testing.T) {
+	for _, format := range []Format{JSON, YAML} {
+		for circuitNumber := 1; circuitNumber <= 17; circuitNumber++ {
+			t.Run(fmt.Sprintf("format=%d/circuit=%d", format, circuitNumber), func(t *testing.T) {
+				cfg, err := New("101", 1, 0, -1, -1, circuitNumber)
+				if err != nil {
+					t.Fatalf("New() failed with %v", err)
+				}
+
+				var buf bytes.Buffer
+				if err := Write(&buf, cfg, format); err != nil {
+					t.Fatalf("Write() failed with %v", err)
+				}
+				want := buf.String()
+				got, err := Read(strings.NewReader(want), format)
+				if err != nil {
+					t.Fatalf("Read(%s) failed with %v", want, err)
+				}
+
+				// Writing the configuration again should give the same file.
+				buf.Reset()
+				if err := Write(&buf, got, format); err != nil {
+					t.Fatalf("Write() failed with %v", err)
+				}
+				if buf.String() != want {
+					t.Errorf("Write(Read(%s)) = %s, want the same", want, buf.String())
+				}
+
+				if got.Degree != cfg.Degree || got.Circuit.NParties != cfg.Circuit.NParties || got.Field.Prime.Cmp(cfg.Field.Prime) != 0 {
+					t.Errorf("Read() has degree %d, %d parties and prime %d, want %d, %d and %d", got.Degree, got.Circuit.NParties, got.Field.Prime, cfg.Degree, cfg.Circuit.NParties, cfg.Field.Prime)
+				}
+				if fmt.Sprint(got.Secrets) != fmt.Sprint(cfg.Secrets) {
+					t.Errorf("Read().Secrets = %v, want %v", got.Secrets, cfg.Secrets)
+				}
+				if gotLen, wantLen := len(got.Circuit.Traverse()), len(cfg.Circuit.Traverse()); gotLen != wantLen {
+					t.Errorf("Read().Circuit has %d gates, want %d", gotLen, wantLen)
+				}
+				gotOut, gotErr := got.Circuit.ComputeExpected(got.Secrets, got.Field)
+				wantOut, wantErr := cfg.Circuit.ComputeExpected(cfg.Secrets, cfg.Field)
+				if fmt.Sprint(gotOut, gotErr) != fmt.Sprint(wantOut, wantErr) {
+					t.Errorf("Read().Circuit.ComputeExpected() = %d, %v, want %d, %v", gotOut, gotErr, wantOut, wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{{
+		path: "../../configs/smart.json",
+		want: "[7]",
+	}, {
+		path: "../../configs/auction.yaml",
+		want: "[72 0]",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			cfg, err := Load(tc.path, 1, 0)
+			if err != nil {
+				t.Fatalf("Load(%q) failed with %v", tc.path, err)
+			}
+			if got, err := cfg.Circuit.ComputeExpected(cfg.Secrets, cfg.Field); err != nil || fmt.Sprint(got) != tc.want {
+				t.Errorf("Load(%q).Circuit.ComputeExpected() = %d, %v, want %s", tc.path, got, err, tc.want)
+			}
+		})
+	}
+
+	if _, err := Load("config.txt", 1, 0); err == nil {
+		t.Errorf("Load(%q) succeeded, want error for the extension", "config.txt")
+	}
+}
+
+func TestRead_Errors(t *testing.T) {
+	// header is a valid start of a configuration with two parties, whose circuit has two inputs x and y.
+	header := `"parties": 2, "prime": 101, "secrets": [[3], [4]],
+		"gates": [{"id": "x", "type": "INPUT"}, {"id": "y", "type": "INPUT", "party": 1}`
+
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{{
+		name:    "Valid",
+		src:     `{` + header + `, {"id": "sum", "type": "ADD", "inputs": ["x", "y"]}], "root": "sum"}`,
+		wantErr: "",
+	}, {
+		name:    "Unknown key",
+		src:     `{` + header + `], "root": "x", "circuit": 1}`,
+		wantErr: `unknown field "circuit"`,
+	}, {
+		name:    "Not prime",
+		src:     `{"parties": 1, "prime": 100, "secrets": [[1]], "gates": [{"id": "x", "type": "INPUT"}], "root": "x"}`,
+		wantErr: "prime=100 is not prime",
+	}, {
+		name:    "Unknown type",
+		src:     `{` + header + `, {"id": "or", "type": "OR", "inputs": ["x", "y"]}], "root": "or"}`,
+		wantErr: `gates[2] ("or"): unknown type "OR"`,
+	}, {
+		name:    "Wrong number of inputs",
+		src:     `{` + header + `, {"id": "sum", "type": "ADD", "inputs": ["x"]}], "root": "sum"}`,
+		wantErr: `gates[2] ("sum"): ADD gate has 1 inputs, want 2`,
+	}, {
+		name:    "Undefined input",
+		src:     `{` + header + `, {"id": "sum", "type": "ADD", "inputs": ["x", "z"]}], "root": "sum"}`,
+		wantErr: `gates[2] ("sum"): input "z" is not defined by an earlier gate`,
+	}, {
+		name:    "Duplicate id",
+		src:     `{` + header + `, {"id": "x", "type": "NEG", "inputs": ["y"]}], "root": "x"}`,
+		wantErr: `gates[2] ("x"): id is not unique`,
+	}, {
+		name:    "Missing value",
+		src:     `{` + header + `, {"id": "c", "type": "ADDC", "inputs": ["x"]}], "root": "c"}`,
+		wantErr: `gates[2] ("c"): ADDC gate has no value`,
+	}, {
+		name:    "Party out of range",
+		src:     `{` + header + `, {"id": "z", "type": "INPUT", "party": 2}], "root": "z"}`,
+		wantErr: `gates[2] ("z"): party 2 is not a party`,
+	}, {
+		name:    "Wrong domain",
+		src:     `{` + header + `, {"id": "xor", "type": "XOR", "inputs": ["x", "y"]}], "root": "xor"}`,
+		wantErr: `gates[2] ("xor"): input IN0 is not binary`,
+	}, {
+		name:    "Undefined output",
+		src:     `{` + header + `], "outputs": [{"name": "result", "gate": "z"}]}`,
+		wantErr: `outputs[0] ("result"): gate "z" is not defined`,
+	}, {
+		name:    "No outputs",
+		src:     `{` + header + `]}`,
+		wantErr: "either root or outputs must be set",
+	}, {
+		name:    "Missing secrets",
+		src:     `{"parties": 2, "prime": 101, "secrets": [[3]], "gates": [{"id": "x", "type": "INPUT"}], "root": "x"}`,
+		wantErr: "secrets",
+	}, {
+		name:    "Null secret",
+		src:     `{"parties": 2, "prime": 101, "secrets": [[null], [4]], "gates": [{"id": "x", "type": "INPUT"}], "root": "x"}`,
+		wantErr: "secrets[0][0] is missing",
+	}, {
+		name:    "Degree too large",
+		src:     `{` + header + `], "root": "x", "degree": 2}`,
+		wantErr: "degree=2 does not satisfy T < N",
+	}, {
+		name:    "Prime too small",
+		src:     `{"parties": 3, "prime": 3, "secrets": [[1], [], []], "gates": [{"id": "x", "type": "INPUT"}], "root": "x"}`,
+		wantErr: "prime=3 is too small for 3 parties",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tc.src), JSON)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Read(%s) failed with %v", tc.src, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Read(%s) = %v, want error containing %q", tc.src, err, tc.wantErr)
+			}
+		})
+	}
+
+	// YAML is validated in the same way.
+	src := "parties: 1\nprime: 101\nsecrets: [[1]]\ngates:\n  - {id: x, type: INPUT}\n  - {id: y, type: MUL, inputs: [x]}\nroot: y\n"
+	if _, err := Read(strings.NewReader(src), YAML); err == nil || !strings.Contains(err.Error(), `gates[1] ("y")`) {
+		t.Errorf("Read(%s) = %v, want error containing %q", src, err, `gates[1] ("y")`)
+	}
+}
@@ -0,0 +1,128 @@
+package field
+
+import (
+	"math/big"
+	"math/rand"
+)
+
+// Binary is the binary field GF(2^k). Its elements are the polynomials over GF(2) of degree less than k, represented by
+// the bits of a big.Int, and arithmetic is performed modulo an irreducible polynomial of degree k. Like Field, every
+// operation returns a newly allocated value and never modifies its arguments.
+// See https://en.wikipedia.org/wiki/Finite_field_arithmetic.
+type Binary struct {
+	// Poly is an irreducible polynomial of degree k over GF(2), written with one bit per coefficient. The
+	// irreducibility of Poly is not enforced.
+	Poly *big.Int
+}
+
+// NewBinary returns the binary field GF(2^k), where poly is an irreducible polynomial of degree k. For example, 0x11b
+// is x^8 + x^4 + x^3 + x + 1.
+func NewBinary(poly *big.Int) Binary {
+	return Binary{Poly: poly}
+}
+
+// GF256 returns GF(2^8), using the irreducible polynomial x^8 + x^4 + x^3 + x + 1 from AES.
+func GF256() Binary {
+	return NewBinary(big.NewInt(0x11b))
+}
+
+// Size returns the number of elements in the field, which is 2^k.
+func (f Binary) Size() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(f.Poly.BitLen()-1))
+}
+
+// Modulus returns Poly.
+func (f Binary) Modulus() *big.Int {
+	return f.Poly
+}
+
+// Mod reduces the polynomial a modulo Poly. The sign of a is ignored, since -1 = 1 in characteristic 2.
+func (f Binary) Mod(a *big.Int) *big.Int {
+	r := new(big.Int).Abs(a)
+	shifted := new(big.Int)
+	for n := f.Poly.BitLen(); r.BitLen() >= n; {
+		// Cancel the leading term of r by subtracting Poly times a power of x.
+		r.Xor(r, shifted.Lsh(f.Poly, uint(r.BitLen()-n)))
+	}
+	return r
+}
+
+// Add adds two polynomials, which is the XOR of their coefficients.
+func (f Binary) Add(a, b *big.Int) *big.Int {
+	return new(big.Int).Xor(f.Mod(a), f.Mod(b))
+}
+
+// Sub subtracts two polynomials, which is the same as adding them.
+func (f Binary) Sub(a, b *big.Int) *big.Int {
+	return f.Add(a, b)
+}
+
+// Mul multiplies two polynomials modulo Poly, using carry-less multiplication.
+func (f Binary) Mul(a, b *big.Int) *big.Int {
+	a, b = f.Mod(a), f.Mod(b)
+	product := new(big.Int)
+	shifted := new(big.Int)
+	for i := 0; i < b.BitLen(); i++ {
+		if b.Bit(i) == 1 {
+			product.Xor(product, shifted.Lsh(a, uint(i)))
+		}
+	}
+	return f.Mod(product)
+}
+
+// Pow raises a to the non-negative power b modulo Poly by repeated squaring.
+func (f Binary) Pow(a, b *big.Int) *big.Int {
+	result := big.NewInt(1)
+	for i := b.BitLen() - 1; i >= 0; i-- {
+		result = f.Mul(result, result)
+		if b.Bit(i) == 1 {
+			result = f.Mul(result, a)
+		}
+	}
+	return result
+}
+
+// Inv computes the multiplicative inverse a^(2^k - 2), since a^(2^k - 1) = 1 for every non-zero a.
+func (f Binary) Inv(a *big.Int) *big.Int {
+	return f.Pow(a, new(big.Int).Sub(f.Size(), big.NewInt(2)))
+}
+
+// Div divides two polynomials modulo Poly.
+func (f Binary) Div(a, b *big.Int) *big.Int {
+	return f.Mul(a, f.Inv(b))
+}
+
+// Sqrt returns the square root of a, which is unique in GF(2^k) and is a^(2^(k-1)).
+func (f Binary) Sqrt(a *big.Int) *big.Int {
+	return f.Pow(a, new(big.Int).Rsh(f.Size(), 1))
+}
+
+// Rand returns a uniformly random polynomial of degree less than k. Like Field.Rand, random bits are drawn from the
+// global math/rand source.
+func (f Binary) Rand() *big.Int {
+	k := f.Poly.BitLen() - 1
+	buf := make([]byte, (k+7)/8)
+	rand.Read(buf)
+	if excess := uint(len(buf)*8 - k); excess > 0 {
+		buf[0] &= byte(0xff >> excess)
+	}
+	return new(big.Int).SetBytes(buf)
+}
+
+// Summation returns the sum of a slice modulo Poly.
+func (f Binary) Summation(s []*big.Int) *big.Int {
+	sum := new(big.Int)
+	for _, n := range s {
+		sum = f.Add(sum, n)
+	}
+	return sum
+}
+
+// Product returns the product of a slice modulo Poly.
+func (f Binary) Product(s []*big.Int) *big.Int {
+	prod := big.NewInt(1)
+	for _, n := range s {
+		prod = f.Mul(prod, n)
+	}
+	return prod
+}
@@ -2,91 +2,151 @@
 package field
 
 import (
+	"fmt"
+	"math/big"
 	"math/rand"
 )
 
+// Finite is the arithmetic of a finite field whose elements are represented by big.Int values. It is implemented by the
+// integers modulo a prime (Field) and by binary fields (Binary), so that polynomials and Shamir sharing work over
+// either.
+type Finite interface {
+	// Size returns the number of elements in the field.
+	Size() *big.Int
+	// Modulus returns the value that arithmetic is performed modulo, which is a prime or a polynomial.
+	Modulus() *big.Int
+	Mod(a *big.Int) *big.Int
+	Add(a, b *big.Int) *big.Int
+	Sub(a, b *big.Int) *big.Int
+	Mul(a, b *big.Int) *big.Int
+	Pow(a, b *big.Int) *big.Int
+	Inv(a *big.Int) *big.Int
+	Div(a, b *big.Int) *big.Int
+	Rand() *big.Int
+	Summation(s []*big.Int) *big.Int
+	Product(s []*big.Int) *big.Int
+}
+
 // Field is supposed to almost approximately represent something akin to the finite field defined by integers mod p (but
-// not really). It provides arithmetic operations module Prime. For simplicity it uses the standard Go int type so will
-// not support numbers bigger than 2^63 - 1. It is not robust, please be gentle.
+// not really). It provides arithmetic operations modulo Prime. Values are represented as arbitrary-precision integers
+// using big.Int, so Prime can be as large as required. Every operation returns a newly allocated value and never
+// modifies its arguments.
 // See: https://en.wikipedia.org/wiki/Finite_field.
 type Field struct {
 	// Prime is a prime number. The primeness of Prime is not enforced.
-	Prime int
+	Prime *big.Int
 }
 
-func New(prime int) Field {
+func New(prime *big.Int) Field {
 	return Field{Prime: prime}
 }
 
-// Mod implements the modulus function for Prime. Note that unlike some other languages the % operator implements
-// remainder, which can return a negative value.
-func (f Field) Mod(a int) int {
-	m := a % f.Prime
-	if a < 0 && f.Prime < 0 {
-		m -= f.Prime
+// Size returns the number of elements in the field, which is Prime.
+func (f Field) Size() *big.Int {
+	return new(big.Int).Set(f.Prime)
+}
+
+// Modulus returns Prime.
+func (f Field) Modulus() *big.Int {
+	return f.Prime
+}
+
+// Parse returns a new Field with the prime given by s, which may be written in decimal or, with a 0x prefix, in
+// hexadecimal.
+func Parse(s string) (Field, error) {
+	prime, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		return Field{}, fmt.Errorf("prime=%q is not a valid integer", s)
 	}
-	if a < 0 && f.Prime > 0 {
-		m += f.Prime
+	return New(prime), nil
+}
+
+// Int is a convenience function which returns n as a *big.Int.
+func Int(n int) *big.Int {
+	return big.NewInt(int64(n))
+}
+
+// Ints is a convenience function which returns each of ns as a *big.Int.
+func Ints(ns ...int) []*big.Int {
+	s := make([]*big.Int, len(ns), len(ns))
+	for i, n := range ns {
+		s[i] = Int(n)
 	}
-	return m
+	return s
+}
+
+// Mod implements the modulus function for Prime. Note that unlike some other languages the % operator implements
+// remainder, which can return a negative value. Unlike big.Int.Rem, big.Int.Mod always returns a value in [0, |Prime|).
+func (f Field) Mod(a *big.Int) *big.Int {
+	return new(big.Int).Mod(a, f.Prime)
 }
 
 // Add adds two integers modulo Prime.
-func (f Field) Add(a, b int) int {
-	return f.Mod(a + b)
+func (f Field) Add(a, b *big.Int) *big.Int {
+	return f.Mod(new(big.Int).Add(a, b))
 }
 
 // Sub subtracts two integers modulo Prime.
-func (f Field) Sub(a, b int) int {
-	return f.Mod(a - b)
+func (f Field) Sub(a, b *big.Int) *big.Int {
+	return f.Mod(new(big.Int).Sub(a, b))
 }
 
 // Mul multiplies two integers modulo Prime.
-func (f Field) Mul(a, b int) int {
-	return f.Mod(a * b)
+func (f Field) Mul(a, b *big.Int) *big.Int {
+	return f.Mod(new(big.Int).Mul(a, b))
 }
 
 // Pow performs integer exponentiation modulo Prime.
-func (f Field) Pow(a, b int) int {
-	r := 1
-	for b > 0 {
-		if b&1 != 0 {
-			r = f.Mul(r, a)
-		}
-		b >>= 1
-		a = f.Mul(a, a)
-	}
-	return f.Mod(r)
+func (f Field) Pow(a, b *big.Int) *big.Int {
+	return new(big.Int).Exp(f.Mod(a), b, f.Prime)
 }
 
 // Inv computes the multiplicative inverse modulo Prime using Fermat's little theorem.
 // See https://en.wikipedia.org/wiki/Fermat%27s_little_theorem.
-func (f Field) Inv(a int) int {
-	return f.Pow(a, f.Prime-2)
+func (f Field) Inv(a *big.Int) *big.Int {
+	return f.Pow(a, new(big.Int).Sub(f.Prime, big.NewInt(2)))
 }
 
 // Div performs integer division modulo Prime.
-func (f Field) Div(a, b int) int {
+func (f Field) Div(a, b *big.Int) *big.Int {
 	return f.Mul(a, f.Inv(b))
 }
 
-// Rand returns a random integer between n, 0 <= n < Prime.
-func (f Field) Rand() int {
-	return rand.Intn(f.Prime)
+// Sqrt returns a square root of a modulo Prime, or nil if a is not a square. The other square root is its negation.
+func (f Field) Sqrt(a *big.Int) *big.Int {
+	return new(big.Int).ModSqrt(f.Mod(a), f.Prime)
+}
+
+// Rand returns a random integer between n, 0 <= n < Prime. Random bits are drawn from the global math/rand source, so
+// results are reproducible for a given seed.
+func (f Field) Rand() *big.Int {
+	bitLen := f.Prime.BitLen()
+	buf := make([]byte, (bitLen+7)/8)
+	// Rejection sampling avoids the bias that would be introduced by reducing a random value modulo Prime.
+	for {
+		rand.Read(buf)
+		if excess := uint(len(buf)*8 - bitLen); excess > 0 {
+			buf[0] &= byte(0xff >> excess)
+		}
+		n := new(big.Int).SetBytes(buf)
+		if n.Cmp(f.Prime) < 0 {
+			return n
+		}
+	}
 }
 
 // Summation returns the sum of slice modulo Prime.
-func (f Field) Summation(s []int) int {
-	sum := 0
+func (f Field) Summation(s []*big.Int) *big.Int {
+	sum := new(big.Int)
 	for _, n := range s {
-		sum = f.Add(sum, n)
+		sum.Add(sum, n)
 	}
-	return sum
+	return f.Mod(sum)
 }
 
 // Product returns the product of a slice modulo Prime.
-func (f Field) Product(s []int) int {
-	prod := 1
+func (f Field) Product(s []*big.Int) *big.Int {
+	prod := big.NewInt(1)
 	for _, n := range s {
 		prod = f.Mul(prod, n)
 	}
@@ -2,6 +2,7 @@ package field
 
 import (
 	"fmt"
+	"math/big"
 	"testing"
 )
 
@@ -27,9 +28,9 @@ func TestField_Mod(t *testing.T) {
 	for _, tc := range tests {
 		name := fmt.Sprintf("a=%d p=%d", tc.a, tc.p)
 		t.Run(name, func(t *testing.T) {
-			f := Field{Prime: tc.p}
+			f := New(Int(tc.p))
 
-			if got, want := f.Mod(tc.a), tc.want; got != want {
+			if got, want := f.Mod(Int(tc.a)), Int(tc.want); got.Cmp(want) != 0 {
 				t.Errorf("%v.Mod(%d) = %d, want %d", f, tc.a, got, want)
 			}
 		})
@@ -57,9 +58,9 @@ func TestField_Add(t *testing.T) {
 	for _, tc := range tests {
 		name := fmt.Sprintf("a=%d b=%d p=%d", tc.a, tc.b, tc.p)
 		t.Run(name, func(t *testing.T) {
-			f := Field{Prime: tc.p}
+			f := New(Int(tc.p))
 
-			if got, want := f.Add(tc.a, tc.b), tc.want; got != want {
+			if got, want := f.Add(Int(tc.a), Int(tc.b)), Int(tc.want); got.Cmp(want) != 0 {
 				t.Errorf("%v.Add(%d, %d) = %d, want %d", f, tc.a, tc.b, got, want)
 			}
 		})
@@ -86,9 +87,9 @@ func TestField_Sub(t *testing.T) {
 	for _, tc := range tests {
 		name := fmt.Sprintf("a=%d b=%d p=%d", tc.a, tc.b, tc.p)
 		t.Run(name, func(t *testing.T) {
-			f := Field{Prime: tc.p}
+			f := New(Int(tc.p))
 
-			if got, want := f.Sub(tc.a, tc.b), tc.want; got != want {
+			if got, want := f.Sub(Int(tc.a), Int(tc.b)), Int(tc.want); got.Cmp(want) != 0 {
 				t.Errorf("%v.Sub(%d, %d) = %d, want %d", f, tc.a, tc.b, got, want)
 			}
 		})
@@ -116,9 +117,9 @@ func TestField_Mul(t *testing.T) {
 	for _, tc := range tests {
 		name := fmt.Sprintf("a=%d b=%d p=%d", tc.a, tc.b, tc.p)
 		t.Run(name, func(t *testing.T) {
-			f := Field{Prime: tc.p}
+			f := New(Int(tc.p))
 
-			if got, want := f.Mul(tc.a, tc.b), tc.want; got != want {
+			if got, want := f.Mul(Int(tc.a), Int(tc.b)), Int(tc.want); got.Cmp(want) != 0 {
 				t.Errorf("%v.Mul(%d, %d) = %d, want %d", f, tc.a, tc.b, got, want)
 			}
 		})
@@ -145,9 +146,9 @@ func TestField_Pow(t *testing.T) {
 	for _, tc := range tests {
 		name := fmt.Sprintf("a=%d b=%d p=%d", tc.a, tc.b, tc.p)
 		t.Run(name, func(t *testing.T) {
-			f := Field{Prime: tc.p}
+			f := New(Int(tc.p))
 
-			if got, want := f.Pow(tc.a, tc.b), tc.want; got != want {
+			if got, want := f.Pow(Int(tc.a), Int(tc.b)), Int(tc.want); got.Cmp(want) != 0 {
 				t.Errorf("%v.Pow(%d, %d) = %d, want %d", f, tc.a, tc.b, got, want)
 			}
 		})
@@ -171,9 +172,9 @@ func TestField_Inv(t *testing.T) {
 	for _, tc := range tests {
 		name := fmt.Sprintf("a=%d p=%d", tc.a, tc.p)
 		t.Run(name, func(t *testing.T) {
-			f := Field{Prime: tc.p}
+			f := New(Int(tc.p))
 
-			if got, want := f.Inv(tc.a), tc.want; got != want {
+			if got, want := f.Inv(Int(tc.a)), Int(tc.want); got.Cmp(want) != 0 {
 				t.Errorf("%v.Inv(%d) = %d, want %d", f, tc.a, got, want)
 			}
 		})
@@ -206,9 +207,9 @@ func TestField_Div(t *testing.T) {
 	for _, tc := range tests {
 		name := fmt.Sprintf("a=%d b=%d p=%d", tc.a, tc.b, tc.p)
 		t.Run(name, func(t *testing.T) {
-			f := Field{Prime: tc.p}
+			f := New(Int(tc.p))
 
-			if got, want := f.Div(tc.a, tc.b), tc.want; got != want {
+			if got, want := f.Div(Int(tc.a), Int(tc.b)), Int(tc.want); got.Cmp(want) != 0 {
 				t.Errorf("%v.Div(%d, %d) = %d, want %d", f, tc.a, tc.b, got, want)
 			}
 		})
@@ -216,11 +217,11 @@ func TestField_Div(t *testing.T) {
 }
 func TestField_Rand(t *testing.T) {
 	p := 3
-	f := Field{Prime: p}
+	f := New(Int(p))
 
 	for i := 0; i < 10; i++ {
 		got := f.Rand()
-		if got < 0 || got > 2 {
+		if got.Sign() < 0 || got.Cmp(Int(2)) > 0 {
 			t.Errorf("%v.Rand() = %v which is out of range for p = %d", f, got, p)
 		}
 	}
@@ -244,9 +245,9 @@ func TestField_Summation(t *testing.T) {
 	for _, tc := range tests {
 		name := fmt.Sprintf("s=%d p=%d", tc.s, tc.p)
 		t.Run(name, func(t *testing.T) {
-			f := Field{Prime: tc.p}
+			f := New(Int(tc.p))
 
-			if got, want := f.Summation(tc.s), tc.want; got != want {
+			if got, want := f.Summation(Ints(tc.s...)), Int(tc.want); got.Cmp(want) != 0 {
 				t.Errorf("%v.Summation(%v) = %d, want %d", f, tc.s, got, want)
 			}
 		})
@@ -271,11 +272,153 @@ func TestField_Product(t *testing.T) {
 	for _, tc := range tests {
 		name := fmt.Sprintf("s=%d p=%d", tc.s, tc.p)
 		t.Run(name, func(t *testing.T) {
-			f := Field{Prime: tc.p}
+			f := New(Int(tc.p))
 
-			if got, want := f.Product(tc.s), tc.want; got != want {
+			if got, want := f.Product(Ints(tc.s...)), Int(tc.want); got.Cmp(want) != 0 {
 				t.Errorf("%v.Product(%v) = %d, want %d", f, tc.s, got, want)
 			}
 		})
 	}
 }
+
+func TestField_BigPrime(t *testing.T) {
+	// 2^127 - 1 is a Mersenne prime, so every non-zero element has an inverse.
+	f, err := Parse("0x7fffffffffffffffffffffffffffffff")
+	if err != nil {
+		t.Fatalf("Parse() failed with %v", err)
+	}
+
+	a, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	b, _ := new(big.Int).SetString("987654321098765432109876543210", 10)
+
+	// The product of a and b is larger than Prime, so this exercises reduction of values that overflow an int64.
+	if got := f.Div(f.Mul(a, b), b); got.Cmp(a) != 0 {
+		t.Errorf("%v.Div(%v.Mul(%d, %d), %d) = %d, want %d", f, f, a, b, b, got, a)
+	}
+
+	for i := 0; i < 10; i++ {
+		if got := f.Rand(); got.Sign() < 0 || got.Cmp(f.Prime) >= 0 {
+			t.Errorf("%v.Rand() = %d which is out of range", f, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int
+		wantErr bool
+	}{{
+		s:    "101",
+		want: 101,
+	}, {
+		s:    "0x65",
+		want: 101,
+	}, {
+		s:       "one hundred and one",
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.s, func(t *testing.T) {
+			f, err := Parse(tc.s)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Parse(%q) returned error %v, want error %t", tc.s, err, tc.wantErr)
+			}
+			if !tc.wantErr && f.Prime.Cmp(Int(tc.want)) != 0 {
+				t.Errorf("Parse(%q).Prime = %d, want %d", tc.s, f.Prime, tc.want)
+			}
+		})
+	}
+}
+
+func TestField_Sqrt(t *testing.T) {
+	tests := []struct {
+		a  int
+		p  int
+		ok bool
+	}{{
+		a:  4,
+		p:  101,
+		ok: true,
+	}, {
+		// 101 = 1 mod 4, so this needs the general Tonelli-Shanks algorithm.
+		a:  5,
+		p:  101,
+		ok: true,
+	}, {
+		a:  0,
+		p:  7,
+		ok: true,
+	}, {
+		// The squares mod 7 are 0, 1, 2 and 4.
+		a:  3,
+		p:  7,
+		ok: false,
+	}, {
+		a:  -3,
+		p:  7,
+		ok: true,
+	}}
+
+	for _, tc := range tests {
+		name := fmt.Sprintf("a=%d p=%d", tc.a, tc.p)
+		t.Run(name, func(t *testing.T) {
+			f := New(Int(tc.p))
+
+			got := f.Sqrt(Int(tc.a))
+			if !tc.ok {
+				if got != nil {
+					t.Errorf("%v.Sqrt(%d) = %d, want nil", f, tc.a, got)
+				}
+				return
+			}
+			if got == nil || f.Mul(got, got).Cmp(f.Mod(Int(tc.a))) != 0 {
+				t.Errorf("%v.Sqrt(%d) = %d, which is not a square root", f, tc.a, got)
+			}
+		})
+	}
+}
+
+func TestField_Binary(t *testing.T) {
+	f := GF256()
+
+	// Examples from the AES specification (FIPS 197, section 4).
+	if got, want := f.Add(Int(0x57), Int(0x83)), Int(0xd4); got.Cmp(want) != 0 {
+		t.Errorf("%v.Add(0x57, 0x83) = %#x, want %#x", f, got, want)
+	}
+	if got, want := f.Mul(Int(0x57), Int(0x83)), Int(0xc1); got.Cmp(want) != 0 {
+		t.Errorf("%v.Mul(0x57, 0x83) = %#x, want %#x", f, got, want)
+	}
+	if got, want := f.Mul(Int(0x57), Int(0x13)), Int(0xfe); got.Cmp(want) != 0 {
+		t.Errorf("%v.Mul(0x57, 0x13) = %#x, want %#x", f, got, want)
+	}
+	if got, want := f.Inv(Int(0x53)), Int(0xca); got.Cmp(want) != 0 {
+		t.Errorf("%v.Inv(0x53) = %#x, want %#x", f, got, want)
+	}
+	// Subtraction is the same as addition, and the polynomial itself is zero.
+	if got, want := f.Sub(Int(0x57), Int(0x83)), Int(0xd4); got.Cmp(want) != 0 {
+		t.Errorf("%v.Sub(0x57, 0x83) = %#x, want %#x", f, got, want)
+	}
+	if got := f.Mod(Int(0x11b)); got.Sign() != 0 {
+		t.Errorf("%v.Mod(0x11b) = %#x, want 0", f, got)
+	}
+	if got, want := f.Size(), Int(256); got.Cmp(want) != 0 {
+		t.Errorf("%v.Size() = %d, want %d", f, got, want)
+	}
+
+	for a := 1; a < 256; a++ {
+		if got := f.Mul(Int(a), f.Inv(Int(a))); got.Cmp(Int(1)) != 0 {
+			t.Errorf("%#x * %v.Inv(%#x) = %#x, want 1", a, f, a, got)
+		}
+		if s := f.Sqrt(Int(a)); f.Mul(s, s).Cmp(Int(a)) != 0 {
+			t.Errorf("%v.Sqrt(%#x) = %#x, which is not a square root", f, a, s)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		if got := f.Rand(); got.Sign() < 0 || got.Cmp(Int(256)) >= 0 {
+			t.Fatalf("%v.Rand() = %d, want a value in [0, 256)", f, got)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package gate
 
+import "math/big"
+
 // Add is an arithmetic addition gate.
 type Add struct {
 	// first is the first input to this gate.
@@ -7,7 +9,7 @@ type Add struct {
 	// second is the second input to this gate.
 	second Gate
 	// output is the output value of this gate.
-	output int
+	output *big.Int
 }
 
 func NewAdd(first Gate, second Gate) Gate {
@@ -25,11 +27,11 @@ func (g *Add) Second() Gate {
 	return g.second
 }
 
-func (g *Add) SetOutput(output int) {
+func (g *Add) SetOutput(output *big.Int) {
 	g.output = output
 }
 
-func (g *Add) Output() int {
+func (g *Add) Output() *big.Int {
 	return g.output
 }
 
@@ -37,10 +39,10 @@ func (g *Add) Type() string {
 	return "ADD"
 }
 
-func (g *Add) Copy() Gate {
+func (g *Add) Copy(first, second Gate) Gate {
 	return &Add{
-		first:  g.first.Copy(),
-		second: g.second.Copy(),
+		first:  first,
+		second: second,
 		output: g.output,
 	}
 }
@@ -0,0 +1,48 @@
+package gate
+
+import "math/big"
+
+// AddConst is a gate which adds a public constant to its input. It is evaluated locally by each party.
+type AddConst struct {
+	// first is the input to this gate.
+	first Gate
+	// Value is the constant which is added to the input.
+	Value *big.Int
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewAddConst(first Gate, value *big.Int) Gate {
+	return &AddConst{
+		first: first,
+		Value: value,
+	}
+}
+
+func (g *AddConst) First() Gate {
+	return g.first
+}
+
+func (g *AddConst) Second() Gate {
+	return nil
+}
+
+func (g *AddConst) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *AddConst) Output() *big.Int {
+	return g.output
+}
+
+func (g *AddConst) Type() string {
+	return "ADDC"
+}
+
+func (g *AddConst) Copy(first, second Gate) Gate {
+	return &AddConst{
+		first:  first,
+		Value:  new(big.Int).Set(g.Value),
+		output: g.output,
+	}
+}
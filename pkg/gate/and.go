@@ -0,0 +1,49 @@
+package gate
+
+import "math/big"
+
+// And is a boolean and gate, whose inputs and output are bits shared over a binary field. Evaluating it requires
+// communication, since it is multiplication in the binary field.
+type And struct {
+	// first is the first input to this gate.
+	first Gate
+	// second is the second input to this gate.
+	second Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewAnd(first Gate, second Gate) Gate {
+	return &And{
+		first:  first,
+		second: second,
+	}
+}
+
+func (g *And) First() Gate {
+	return g.first
+}
+
+func (g *And) Second() Gate {
+	return g.second
+}
+
+func (g *And) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *And) Output() *big.Int {
+	return g.output
+}
+
+func (g *And) Type() string {
+	return "AND"
+}
+
+func (g *And) Copy(first, second Gate) Gate {
+	return &And{
+		first:  first,
+		second: second,
+		output: g.output,
+	}
+}
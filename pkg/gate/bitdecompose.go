@@ -0,0 +1,53 @@
+package gate
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// BitDecompose is a bit decomposition gate, whose output is one bit of the binary representation of its input in
+// [0, p). Evaluating it requires communication, but the bits of an input are only decomposed once, however many of them
+// are used.
+type BitDecompose struct {
+	// first is the input to this gate.
+	first Gate
+	// Bit is the index of the bit of the input which is output, where bit 0 is the least significant.
+	Bit int
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewBitDecompose(first Gate, bit int) Gate {
+	return &BitDecompose{
+		first: first,
+		Bit:   bit,
+	}
+}
+
+func (g *BitDecompose) First() Gate {
+	return g.first
+}
+
+func (g *BitDecompose) Second() Gate {
+	return nil
+}
+
+func (g *BitDecompose) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *BitDecompose) Output() *big.Int {
+	return g.output
+}
+
+func (g *BitDecompose) Type() string {
+	return fmt.Sprintf("BIT%d", g.Bit)
+}
+
+func (g *BitDecompose) Copy(first, second Gate) Gate {
+	return &BitDecompose{
+		first:  first,
+		Bit:    g.Bit,
+		output: g.output,
+	}
+}
@@ -0,0 +1,44 @@
+package gate
+
+import "math/big"
+
+// Const is a gate whose output is a public constant. Every party knows the constant, so it costs no communication.
+type Const struct {
+	// Value is the constant.
+	Value *big.Int
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewConst(value *big.Int) Gate {
+	return &Const{
+		Value: value,
+	}
+}
+
+func (g *Const) First() Gate {
+	return nil
+}
+
+func (g *Const) Second() Gate {
+	return nil
+}
+
+func (g *Const) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *Const) Output() *big.Int {
+	return g.output
+}
+
+func (g *Const) Type() string {
+	return "CONST"
+}
+
+func (g *Const) Copy(first, second Gate) Gate {
+	return &Const{
+		Value:  new(big.Int).Set(g.Value),
+		output: g.output,
+	}
+}
@@ -0,0 +1,49 @@
+package gate
+
+import "math/big"
+
+// Div is a division gate, whose output is its first input divided by its second in the field. Evaluating it requires
+// communication, and fails if the second input is zero.
+type Div struct {
+	// first is the first input to this gate.
+	first Gate
+	// second is the second input to this gate.
+	second Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewDiv(first Gate, second Gate) Gate {
+	return &Div{
+		first:  first,
+		second: second,
+	}
+}
+
+func (g *Div) First() Gate {
+	return g.first
+}
+
+func (g *Div) Second() Gate {
+	return g.second
+}
+
+func (g *Div) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *Div) Output() *big.Int {
+	return g.output
+}
+
+func (g *Div) Type() string {
+	return "DIV"
+}
+
+func (g *Div) Copy(first, second Gate) Gate {
+	return &Div{
+		first:  first,
+		second: second,
+		output: g.output,
+	}
+}
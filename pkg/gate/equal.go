@@ -0,0 +1,49 @@
+package gate
+
+import "math/big"
+
+// Equal is an equality test gate, whose output is 1 if its inputs are equal and 0 otherwise. Evaluating it requires
+// communication.
+type Equal struct {
+	// first is the first input to this gate.
+	first Gate
+	// second is the second input to this gate.
+	second Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewEqual(first Gate, second Gate) Gate {
+	return &Equal{
+		first:  first,
+		second: second,
+	}
+}
+
+func (g *Equal) First() Gate {
+	return g.first
+}
+
+func (g *Equal) Second() Gate {
+	return g.second
+}
+
+func (g *Equal) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *Equal) Output() *big.Int {
+	return g.output
+}
+
+func (g *Equal) Type() string {
+	return "EQ"
+}
+
+func (g *Equal) Copy(first, second Gate) Gate {
+	return &Equal{
+		first:  first,
+		second: second,
+		output: g.output,
+	}
+}
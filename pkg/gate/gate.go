@@ -1,6 +1,8 @@
 // Package gate contains implementations of circuit gates.
 package gate
 
+import "math/big"
+
 // Gate represents a gate in the circuit. All gates should implement this interface.
 type Gate interface {
 	// First is the first input into this two-input gate.
@@ -8,11 +10,13 @@ type Gate interface {
 	// Second is the second input into this two-input gate.
 	Second() Gate
 	// SetOutput sets the output value of this gate (which can be retrieved with Output).
-	SetOutput(int)
+	SetOutput(*big.Int)
 	// Output is the output value of this gate.
-	Output() int
+	Output() *big.Int
 	// Type returns a human-readable representation of the type of this Gate, primarily for debugging purposes.
 	Type() string
-	// Copy returns a deep copy of this gate.
-	Copy() Gate
+	// Copy returns a copy of this gate whose inputs are first and second, which are nil if this gate has no inputs.
+	// Gates may be shared by several other gates, so copying a whole circuit is done by circuit.Circuit.Copy, which
+	// copies each gate exactly once.
+	Copy(first, second Gate) Gate
 }
@@ -1,11 +1,17 @@
 package gate
 
-import "fmt"
+import (
+	"fmt"
+	"math/big"
+)
 
-// Input is an implicit party gate.
+// Input is an implicit party gate. It identifies an input slot: one of the secret inputs of a party.
 type Input struct {
-	Party  int
-	output int
+	// Party is the id of the party which provides this input.
+	Party int
+	// Index is the index of this input among the inputs of Party, starting from 0.
+	Index  int
+	output *big.Int
 }
 
 func (g *Input) First() Gate {
@@ -16,21 +22,26 @@ func (g *Input) Second() Gate {
 	return nil
 }
 
-func (g *Input) SetOutput(output int) {
+func (g *Input) SetOutput(output *big.Int) {
 	g.output = output
 }
 
-func (g *Input) Output() int {
+func (g *Input) Output() *big.Int {
 	return g.output
 }
 
 func (g *Input) Type() string {
-	return fmt.Sprintf("IN%d", g.Party)
+	// The first input of each party is the most common, so its index is omitted.
+	if g.Index == 0 {
+		return fmt.Sprintf("IN%d", g.Party)
+	}
+	return fmt.Sprintf("IN%d.%d", g.Party, g.Index)
 }
 
-func (g *Input) Copy() Gate {
+func (g *Input) Copy(first, second Gate) Gate {
 	return &Input{
 		Party:  g.Party,
+		Index:  g.Index,
 		output: g.output,
 	}
 }
@@ -0,0 +1,44 @@
+package gate
+
+import "math/big"
+
+// Inv is a multiplicative inverse gate. Evaluating it requires communication, and fails if its input is zero.
+type Inv struct {
+	// first is the input to this gate.
+	first Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewInv(first Gate) Gate {
+	return &Inv{
+		first: first,
+	}
+}
+
+func (g *Inv) First() Gate {
+	return g.first
+}
+
+func (g *Inv) Second() Gate {
+	return nil
+}
+
+func (g *Inv) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *Inv) Output() *big.Int {
+	return g.output
+}
+
+func (g *Inv) Type() string {
+	return "INV"
+}
+
+func (g *Inv) Copy(first, second Gate) Gate {
+	return &Inv{
+		first:  first,
+		output: g.output,
+	}
+}
@@ -0,0 +1,49 @@
+package gate
+
+import "math/big"
+
+// LessThan is a comparison gate, whose output is 1 if its first input is less than its second and 0 otherwise, where
+// inputs are compared as integers in [0, p). Evaluating it requires communication.
+type LessThan struct {
+	// first is the first input to this gate.
+	first Gate
+	// second is the second input to this gate.
+	second Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewLessThan(first Gate, second Gate) Gate {
+	return &LessThan{
+		first:  first,
+		second: second,
+	}
+}
+
+func (g *LessThan) First() Gate {
+	return g.first
+}
+
+func (g *LessThan) Second() Gate {
+	return g.second
+}
+
+func (g *LessThan) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *LessThan) Output() *big.Int {
+	return g.output
+}
+
+func (g *LessThan) Type() string {
+	return "LT"
+}
+
+func (g *LessThan) Copy(first, second Gate) Gate {
+	return &LessThan{
+		first:  first,
+		second: second,
+		output: g.output,
+	}
+}
@@ -1,5 +1,7 @@
 package gate
 
+import "math/big"
+
 // Mul is an arithmetic multiplication gate.
 type Mul struct {
 	// first is the first input to this gate.
@@ -7,7 +9,7 @@ type Mul struct {
 	// second is the second input to this gate.
 	second Gate
 	// output is the output value of this gate.
-	output int
+	output *big.Int
 }
 
 func NewMul(first Gate, second Gate) Gate {
@@ -25,11 +27,11 @@ func (g *Mul) Second() Gate {
 	return g.second
 }
 
-func (g *Mul) SetOutput(output int) {
+func (g *Mul) SetOutput(output *big.Int) {
 	g.output = output
 }
 
-func (g *Mul) Output() int {
+func (g *Mul) Output() *big.Int {
 	return g.output
 }
 
@@ -37,9 +39,9 @@ func (g *Mul) Type() string {
 	return "MUL"
 }
 
-func (g *Mul) Copy() Gate {
+func (g *Mul) Copy(first, second Gate) Gate {
 	return &Mul{
-		first:  g.first.Copy(),
-		second: g.second.Copy(),
+		first:  first,
+		second: second,
 	}
 }
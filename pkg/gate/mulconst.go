@@ -0,0 +1,48 @@
+package gate
+
+import "math/big"
+
+// MulConst is a gate which multiplies its input by a public constant. It is evaluated locally by each party.
+type MulConst struct {
+	// first is the input to this gate.
+	first Gate
+	// Value is the constant which the input is multiplied by.
+	Value *big.Int
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewMulConst(first Gate, value *big.Int) Gate {
+	return &MulConst{
+		first: first,
+		Value: value,
+	}
+}
+
+func (g *MulConst) First() Gate {
+	return g.first
+}
+
+func (g *MulConst) Second() Gate {
+	return nil
+}
+
+func (g *MulConst) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *MulConst) Output() *big.Int {
+	return g.output
+}
+
+func (g *MulConst) Type() string {
+	return "MULC"
+}
+
+func (g *MulConst) Copy(first, second Gate) Gate {
+	return &MulConst{
+		first:  first,
+		Value:  new(big.Int).Set(g.Value),
+		output: g.output,
+	}
+}
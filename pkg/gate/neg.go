@@ -0,0 +1,44 @@
+package gate
+
+import "math/big"
+
+// Neg is an arithmetic negation gate.
+type Neg struct {
+	// first is the input to this gate.
+	first Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewNeg(first Gate) Gate {
+	return &Neg{
+		first: first,
+	}
+}
+
+func (g *Neg) First() Gate {
+	return g.first
+}
+
+func (g *Neg) Second() Gate {
+	return nil
+}
+
+func (g *Neg) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *Neg) Output() *big.Int {
+	return g.output
+}
+
+func (g *Neg) Type() string {
+	return "NEG"
+}
+
+func (g *Neg) Copy(first, second Gate) Gate {
+	return &Neg{
+		first:  first,
+		output: g.output,
+	}
+}
@@ -0,0 +1,45 @@
+package gate
+
+import "math/big"
+
+// Not is a boolean negation gate, whose input and output are bits shared over a binary field. It is evaluated
+// locally.
+type Not struct {
+	// first is the input to this gate.
+	first Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewNot(first Gate) Gate {
+	return &Not{
+		first: first,
+	}
+}
+
+func (g *Not) First() Gate {
+	return g.first
+}
+
+func (g *Not) Second() Gate {
+	return nil
+}
+
+func (g *Not) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *Not) Output() *big.Int {
+	return g.output
+}
+
+func (g *Not) Type() string {
+	return "NOT"
+}
+
+func (g *Not) Copy(first, second Gate) Gate {
+	return &Not{
+		first:  first,
+		output: g.output,
+	}
+}
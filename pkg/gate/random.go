@@ -0,0 +1,40 @@
+package gate
+
+import "math/big"
+
+// Random is a uniformly random field element which no party knows, generated jointly by the parties. Evaluating it
+// requires communication.
+type Random struct {
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewRandom() Gate {
+	return &Random{}
+}
+
+func (g *Random) First() Gate {
+	return nil
+}
+
+func (g *Random) Second() Gate {
+	return nil
+}
+
+func (g *Random) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *Random) Output() *big.Int {
+	return g.output
+}
+
+func (g *Random) Type() string {
+	return "RAND"
+}
+
+func (g *Random) Copy(first, second Gate) Gate {
+	return &Random{
+		output: g.output,
+	}
+}
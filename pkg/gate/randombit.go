@@ -0,0 +1,40 @@
+package gate
+
+import "math/big"
+
+// RandomBit is a uniformly random bit, 0 or 1, which no party knows, generated jointly by the parties. Evaluating it
+// requires communication.
+type RandomBit struct {
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewRandomBit() Gate {
+	return &RandomBit{}
+}
+
+func (g *RandomBit) First() Gate {
+	return nil
+}
+
+func (g *RandomBit) Second() Gate {
+	return nil
+}
+
+func (g *RandomBit) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *RandomBit) Output() *big.Int {
+	return g.output
+}
+
+func (g *RandomBit) Type() string {
+	return "RBIT"
+}
+
+func (g *RandomBit) Copy(first, second Gate) Gate {
+	return &RandomBit{
+		output: g.output,
+	}
+}
@@ -0,0 +1,48 @@
+package gate
+
+import "math/big"
+
+// Sub is an arithmetic subtraction gate, whose output is its first input minus its second.
+type Sub struct {
+	// first is the first input to this gate.
+	first Gate
+	// second is the second input to this gate.
+	second Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewSub(first Gate, second Gate) Gate {
+	return &Sub{
+		first:  first,
+		second: second,
+	}
+}
+
+func (g *Sub) First() Gate {
+	return g.first
+}
+
+func (g *Sub) Second() Gate {
+	return g.second
+}
+
+func (g *Sub) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *Sub) Output() *big.Int {
+	return g.output
+}
+
+func (g *Sub) Type() string {
+	return "SUB"
+}
+
+func (g *Sub) Copy(first, second Gate) Gate {
+	return &Sub{
+		first:  first,
+		second: second,
+		output: g.output,
+	}
+}
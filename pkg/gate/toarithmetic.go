@@ -0,0 +1,45 @@
+package gate
+
+import "math/big"
+
+// ToArithmetic is a conversion gate, whose input is a bit shared over a binary field and whose output is the same bit
+// as 0 or 1 in the prime field, so that it can be used by arithmetic gates. Evaluating it requires communication.
+type ToArithmetic struct {
+	// first is the input to this gate.
+	first Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewToArithmetic(first Gate) Gate {
+	return &ToArithmetic{
+		first: first,
+	}
+}
+
+func (g *ToArithmetic) First() Gate {
+	return g.first
+}
+
+func (g *ToArithmetic) Second() Gate {
+	return nil
+}
+
+func (g *ToArithmetic) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *ToArithmetic) Output() *big.Int {
+	return g.output
+}
+
+func (g *ToArithmetic) Type() string {
+	return "B2A"
+}
+
+func (g *ToArithmetic) Copy(first, second Gate) Gate {
+	return &ToArithmetic{
+		first:  first,
+		output: g.output,
+	}
+}
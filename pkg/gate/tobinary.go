@@ -0,0 +1,45 @@
+package gate
+
+import "math/big"
+
+// ToBinary is a conversion gate, whose input is 0 or 1 in the prime field and whose output is the same bit shared over
+// a binary field, so that it can be used by boolean gates. Evaluating it requires communication.
+type ToBinary struct {
+	// first is the input to this gate.
+	first Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewToBinary(first Gate) Gate {
+	return &ToBinary{
+		first: first,
+	}
+}
+
+func (g *ToBinary) First() Gate {
+	return g.first
+}
+
+func (g *ToBinary) Second() Gate {
+	return nil
+}
+
+func (g *ToBinary) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *ToBinary) Output() *big.Int {
+	return g.output
+}
+
+func (g *ToBinary) Type() string {
+	return "A2B"
+}
+
+func (g *ToBinary) Copy(first, second Gate) Gate {
+	return &ToBinary{
+		first:  first,
+		output: g.output,
+	}
+}
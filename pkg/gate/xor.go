@@ -0,0 +1,49 @@
+package gate
+
+import "math/big"
+
+// Xor is a boolean exclusive or gate, whose inputs and output are bits shared over a binary field. It is evaluated
+// locally, since it is addition in the binary field.
+type Xor struct {
+	// first is the first input to this gate.
+	first Gate
+	// second is the second input to this gate.
+	second Gate
+	// output is the output value of this gate.
+	output *big.Int
+}
+
+func NewXor(first Gate, second Gate) Gate {
+	return &Xor{
+		first:  first,
+		second: second,
+	}
+}
+
+func (g *Xor) First() Gate {
+	return g.first
+}
+
+func (g *Xor) Second() Gate {
+	return g.second
+}
+
+func (g *Xor) SetOutput(output *big.Int) {
+	g.output = output
+}
+
+func (g *Xor) Output() *big.Int {
+	return g.output
+}
+
+func (g *Xor) Type() string {
+	return "XOR"
+}
+
+func (g *Xor) Copy(first, second Gate) Gate {
+	return &Xor{
+		first:  first,
+		second: second,
+		output: g.output,
+	}
+}
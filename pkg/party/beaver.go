@@ -0,0 +1,272 @@
+package party
+
+import (
+	"context"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/field"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"github.com/sonjoonho/bgw/pkg/poly"
+	"math/big"
+	"sync"
+)
+
+// Triple is a party's shares of a Beaver triple: random values a and b, and their product c = a * b.
+type Triple struct {
+	A, B, C *big.Int
+}
+
+// DealTriples generates n Beaver triples as a trusted dealer, and shares each of them between nParties parties using
+// polynomials of the specified degree. The triples for party i are at index i of the result.
+func DealTriples(n, nParties, degree int, field field.Field) [][]Triple {
+	triples := make([][]Triple, nParties, nParties)
+	for party := range triples {
+		triples[party] = make([]Triple, n, n)
+	}
+
+	for k := 0; k < n; k++ {
+		a, b := field.Rand(), field.Rand()
+		pa := poly.Random(a, degree, field)
+		pb := poly.Random(b, degree, field)
+		pc := poly.Random(field.Mul(a, b), degree, field)
+		for party := range triples {
+			x := point(party)
+			triples[party][k] = Triple{A: pa.Eval(x), B: pb.Eval(x), C: pc.Eval(x)}
+		}
+	}
+
+	return triples
+}
+
+// TriplesNeeded returns the number of Beaver triples needed to evaluate c over fld, assuming that no gate has to be
+// retried. Gates which are retried prepare the triples they need for each new attempt.
+func TriplesNeeded(c *circuit.Circuit, fld field.Field) int {
+	l := fld.Prime.BitLen()
+	// decomposed are the gates whose bits have been decomposed, which is only done once for each gate.
+	decomposed := make(map[gate.Gate]bool)
+	bitsOf := func(g gate.Gate) int {
+		if decomposed[g] {
+			return 0
+		}
+		decomposed[g] = true
+		return decomposeTriples(l)
+	}
+
+	n := 0
+	for _, g := range c.Traverse() {
+		switch g.(type) {
+		case *gate.Mul, *gate.Inv, *gate.RandomBit:
+			n++
+		case *gate.Div:
+			// The dividend is multiplied by the same random value as the divisor.
+			n += 2
+		case *gate.Equal:
+			n += decomposeTriples(l) + compareBitsTriples(l)
+		case *gate.LessThan:
+			n += bitsOf(g.First()) + bitsOf(g.Second()) + compareBitsTriples(l)
+		case *gate.BitDecompose:
+			n += bitsOf(g.First())
+		case *gate.ToBinary:
+			// A random non-zero value is generated, and the input is squared, multiplied by the random bit to mask it,
+			// and the difference of the two is multiplied by the random value to check that the input is a bit.
+			n += doubleBitsTriples(c.NParties) + 4
+		case *gate.ToArithmetic:
+			n += doubleBitsTriples(c.NParties)
+		}
+	}
+	return n
+}
+
+// A Dealer is a trusted dealer, which deals Beaver triples to parties in the same process whenever they need more.
+// Every party is dealt the same triples in the same order, so the parties must request the same numbers of triples in
+// the same order, which they do since they evaluate the same circuit.
+type Dealer struct {
+	mu       sync.Mutex
+	nParties int
+	degree   int
+	field    field.Field
+	// dealt are the triples dealt so far, where dealt[i] are party i's shares of them, and next[i] is the index of the
+	// next triple to deal to party i.
+	dealt [][]Triple
+	next  []int
+}
+
+// NewDealer returns a Dealer which shares triples between nParties parties using polynomials of the specified degree.
+func NewDealer(nParties, degree int, field field.Field) *Dealer {
+	return &Dealer{
+		nParties: nParties,
+		degree:   degree,
+		field:    field,
+		dealt:    make([][]Triple, nParties, nParties),
+		next:     make([]int, nParties, nParties),
+	}
+}
+
+// Deal returns the specified party's shares of the next n triples dealt to it.
+func (d *Dealer) Deal(party, n int) []Triple {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if short := d.next[party] + n - len(d.dealt[party]); short > 0 {
+		triples := DealTriples(short, d.nParties, d.degree, d.field)
+		for i := range d.dealt {
+			d.dealt[i] = append(d.dealt[i], triples[i]...)
+		}
+	}
+	triples := d.dealt[party][d.next[party] : d.next[party]+n]
+	d.next[party] += n
+	return triples
+}
+
+// beaver multiplies shared values using Beaver triples, which are generated in advance. To multiply x and y using the
+// triple (a, b, c), the parties open d = x - a and e = y - b, and compute their share of the product as
+// c + d * b + e * a + d * e. Since a and b are uniformly random, d and e reveal nothing about x and y.
+// See https://link.springer.com/chapter/10.1007/3-540-46766-1_34.
+type beaver struct {
+	p *Party
+	// triples are this party's shares of the triples which have not been used yet.
+	triples []Triple
+	// needed is the number of multiplications which have been prepared for, but not evaluated yet.
+	needed int
+	// more returns this party's shares of n more triples. It is nil if the triples were provided, so there are no more.
+	more func(ctx context.Context, n int) ([]Triple, error)
+	// generates is whether the parties generate triples themselves, and generated is whether they have done so yet.
+	generates, generated bool
+}
+
+// degree returns T, as long as the masked values can be opened. If the parties generate the triples themselves, this
+// additionally requires that there are enough parties to multiply using grr.
+func (m *beaver) degree(a, b int) (int, error) {
+	nParties := m.p.circuit.NParties
+	if d := max(max(a, b), m.p.degree); !(d < nParties) {
+		return 0, fmt.Errorf("cannot open masked values shared with degree %d with %d parties", d, nParties)
+	}
+	if m.generates {
+		if _, err := (&grr{p: m.p, field: m.p.field}).degree(m.p.degree, m.p.degree); err != nil {
+			return 0, fmt.Errorf("cannot generate Beaver triples: %v", err)
+		}
+	}
+	return m.p.degree, nil
+}
+
+// preprocess ensures that there are triples for n more multiplications than have been prepared for already, getting
+// more triples if there are not enough, or returning an error if there are no more.
+func (m *beaver) preprocess(ctx context.Context, n int) error {
+	m.needed += n
+	short := m.needed - len(m.triples)
+	if short <= 0 {
+		return nil
+	}
+	if m.more == nil {
+		return fmt.Errorf("party %d has %d Beaver triples, but %d are needed", m.p.id, len(m.triples), m.needed)
+	}
+
+	triples, err := m.more(ctx, short)
+	if err != nil {
+		return err
+	}
+	m.triples = append(m.triples, triples...)
+	return nil
+}
+
+// generate generates n Beaver triples without a trusted dealer. Each party shares random values, which are summed to
+// give a and b, and c is computed by multiplying them using grr. All n triples are generated in two rounds of
+// communication. The first time, these are identified by ids following the output gate, and afterwards, when a gate was
+// retried, by new ids.
+func (m *beaver) generate(ctx context.Context, n int) ([]Triple, error) {
+	p := m.p
+	if n == 0 {
+		return []Triple{}, nil
+	}
+	id := len(p.circuit.Traverse()) + 1
+	if m.generated {
+		// The two rounds need consecutive ids.
+		id = p.nextRound()
+		p.nextRound()
+	}
+	m.generated = true
+	gatePrefix := p.gatePrefix(id, "TRPL")
+
+	// 1. Each party shares 2n random values, n of which contribute to a and n to b. a and b are the sums of every
+	//    party's random values, so they are random as long as any party is honest.
+	random, err := p.randomShares(ctx, id, 2*n)
+	if err != nil {
+		return nil, err
+	}
+	as, bs := random[:n], random[n:]
+
+	// 2. c is the product of a and b.
+	cs, err := (&grr{p: p, field: p.field}).mul(ctx, id+1, as, bs)
+	if err != nil {
+		return nil, err
+	}
+
+	triples := make([]Triple, n, n)
+	for k := range triples {
+		triples[k] = Triple{A: as[k], B: bs[k], C: cs[k]}
+	}
+
+	p.logger.Printf("%s generated %d triples", gatePrefix, n)
+
+	return triples, nil
+}
+
+func (m *beaver) mul(ctx context.Context, id int, fsts, snds []*big.Int) ([]*big.Int, error) {
+	p := m.p
+	gatePrefix := p.gatePrefix(id, "MUL")
+	nParties := p.circuit.NParties
+	n := len(fsts)
+
+	// Every multiplication should have been prepared for, so running out of triples means that they were miscounted.
+	if len(m.triples) < n {
+		return nil, fmt.Errorf("party %d has %d Beaver triples left, but %d multiplications are needed", p.id, len(m.triples), n)
+	}
+	triples := m.triples[:n]
+	m.triples = m.triples[n:]
+	m.needed -= n
+
+	// 1. Each party masks its shares with the triple, and sends the masked shares of every product to every party in a
+	//    single message. The shares of d come first, followed by the shares of e.
+	masked := make([]*big.Int, 2*n, 2*n)
+	for k, t := range triples {
+		masked[k] = p.field.Sub(fsts[k], t.A)
+		masked[n+k] = p.field.Sub(snds[k], t.B)
+	}
+	for party := 0; party < nParties; party++ {
+		if err := p.SendShares(ctx, party, id, masked...); err != nil {
+			return nil, err
+		}
+	}
+
+	p.logger.Printf("%s sent masked shares %v", gatePrefix, masked)
+
+	if err := p.awaitShares(ctx, id, p.allParties(), nParties); err != nil {
+		return nil, err
+	}
+	received, err := p.receivedShares(id, 2*n)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Printf("%s received masked shares %v", gatePrefix, p.formatSharesForGate(id))
+
+	// 2. Open d and e, then compute z = c + d * b + e * a + d * e, which is a share of x * y with degree T.
+	recombination := p.recombinationVector(p.allParties(), p.field)
+	outputs := make([]*big.Int, n, n)
+	for k, t := range triples {
+		dTerms := make([]*big.Int, nParties, nParties)
+		eTerms := make([]*big.Int, nParties, nParties)
+		for party := 0; party < nParties; party++ {
+			dTerms[party] = p.field.Mul(received[party][k], recombination[party])
+			eTerms[party] = p.field.Mul(received[party][n+k], recombination[party])
+		}
+		d := p.field.Summation(dTerms)
+		e := p.field.Summation(eTerms)
+
+		outputs[k] = p.field.Summation([]*big.Int{t.C, p.field.Mul(d, t.B), p.field.Mul(e, t.A), p.field.Mul(d, e)})
+
+		p.logger.Printf("%s opened d = %d, e = %d, %d + %d × %d + %d × %d + %d × %d = %d", gatePrefix, d, e, t.C, d, t.B, e, t.A, d, e, outputs[k])
+	}
+
+	return outputs, nil
+}
@@ -0,0 +1,207 @@
+package party
+
+import (
+	"context"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"github.com/sonjoonho/bgw/pkg/poly"
+	"math/big"
+	"math/rand"
+)
+
+func (p *Party) processXor(gateIdx int, gate *gate.Xor) {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+	fst := gate.First().Output()
+	snd := gate.Second().Output()
+
+	// Addition in a binary field is the exclusive or of bits.
+	out := p.binary.Add(fst, snd)
+
+	p.logger.Printf("%s %d ⊕ %d = %d", gatePrefix, fst, snd, out)
+
+	gate.SetOutput(out)
+}
+
+func (p *Party) processNot(gateIdx int, gate *gate.Not) {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+	fst := gate.First().Output()
+
+	// Adding the public constant 1 flips the bit.
+	out := p.binary.Add(fst, big.NewInt(1))
+
+	p.logger.Printf("%s ¬%d = %d", gatePrefix, fst, out)
+
+	gate.SetOutput(out)
+}
+
+// processAnds evaluates the specified and gates in a single round of communication, identified by id. The conjunction
+// of bits is their product in the binary field, which is computed using grr.
+func (p *Party) processAnds(ctx context.Context, id int, gates []*gate.And) error {
+	fsts := make([]*big.Int, len(gates), len(gates))
+	snds := make([]*big.Int, len(gates), len(gates))
+	for i, g := range gates {
+		fsts[i] = g.First().Output()
+		snds[i] = g.Second().Output()
+	}
+
+	outputs, err := (&grr{p: p, field: p.binary}).mul(ctx, id, fsts, snds)
+	if err != nil {
+		return err
+	}
+
+	for i, g := range gates {
+		g.SetOutput(outputs[i])
+	}
+
+	return nil
+}
+
+// processToBinary converts a bit a in the prime field to the binary field. First, the parties check that a is a bit
+// without learning anything else about it: a^2 - a is zero exactly when a is a bit, so they open (a^2 - a) * s for a
+// random non-zero s, which is zero if a is a bit and uniformly random otherwise. Then, using a random bit r shared in
+// both fields, the parties open c = a XOR r = a + r - 2ar in the prime field, which reveals nothing about a. Then
+// c XOR r = c + r in the binary field is a. Since every binary wire is converted by processToBinary, or computed from
+// such wires by boolean gates, every binary wire is a bit.
+func (p *Party) processToBinary(ctx context.Context, gateIdx int, gate *gate.ToBinary) error {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+	a := gate.First().Output()
+
+	rs, err := p.doubleBits(ctx)
+	if err != nil {
+		return err
+	}
+	s, err := p.randomNonZero(ctx)
+	if err != nil {
+		return fmt.Errorf("gate %d (%s): %v", gateIdx, gate.Type(), err)
+	}
+
+	// 1. Compute a^2 and ar in a single round.
+	products, err := p.multiplier.mul(ctx, p.nextRound(), []*big.Int{a, a}, []*big.Int{a, rs.prime})
+	if err != nil {
+		return err
+	}
+	square, ar := products[0], products[1]
+
+	// 2. Check that a is a bit, before anything derived from it is opened.
+	checks, err := p.multiplier.mul(ctx, p.nextRound(), []*big.Int{p.field.Sub(square, a)}, []*big.Int{s})
+	if err != nil {
+		return err
+	}
+	opened, err := p.open(ctx, p.nextRound(), p.field, checks)
+	if err != nil {
+		return err
+	}
+	if opened[0].Sign() != 0 {
+		return fmt.Errorf("gate %d (%s): input is not a bit", gateIdx, gate.Type())
+	}
+
+	// 3. Open c = a XOR r.
+	masked := p.field.Sub(p.field.Add(a, rs.prime), p.field.Mul(big.NewInt(2), ar))
+	opened, err = p.open(ctx, p.nextRound(), p.field, []*big.Int{masked})
+	if err != nil {
+		return err
+	}
+	c := opened[0]
+	out := p.binary.Add(rs.binary, c)
+
+	p.logger.Printf("%s opened a ⊕ r = %d, %d ⊕ %d = %d", gatePrefix, c, c, rs.binary, out)
+
+	gate.SetOutput(out)
+	return nil
+}
+
+// processToArithmetic converts a bit a in the binary field to the prime field. Using a random bit r shared in both
+// fields, the parties open c = a XOR r = a + r in the binary field, which reveals nothing about a. Then
+// c XOR r = c + r - 2cr in the prime field is a, which every party can compute locally since c is public.
+func (p *Party) processToArithmetic(ctx context.Context, gateIdx int, gate *gate.ToArithmetic) error {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+	a := gate.First().Output()
+
+	rs, err := p.doubleBits(ctx)
+	if err != nil {
+		return err
+	}
+	opened, err := p.open(ctx, p.nextRound(), p.binary, []*big.Int{p.binary.Add(a, rs.binary)})
+	if err != nil {
+		return err
+	}
+	c := opened[0]
+	out := rs.prime
+	switch c.Int64() {
+	case 0:
+	case 1:
+		out = p.field.Sub(big.NewInt(1), rs.prime)
+	default:
+		// This cannot happen, since every binary wire is a bit.
+		return fmt.Errorf("gate %d (%s): input is not a bit", gateIdx, gate.Type())
+	}
+
+	p.logger.Printf("%s opened a ⊕ r = %d, %d ⊕ %d = %d", gatePrefix, c, c, rs.prime, out)
+
+	gate.SetOutput(out)
+	return nil
+}
+
+// doubleBit is a party's shares of a random bit in both the prime field and the binary field.
+type doubleBit struct {
+	prime, binary *big.Int
+}
+
+// doubleBits returns this party's shares of a random bit shared in both the prime field and the binary field. Each
+// party shares a random bit in both fields, and the bit is the exclusive or of every party's bit, so it is random as
+// long as any party is honest. In the binary field, this is the sum of the shares. In the prime field, bits are
+// combined pairwise as x + y - 2xy, which takes a logarithmic number of rounds in the number of parties.
+func (p *Party) doubleBits(ctx context.Context) (doubleBit, error) {
+	nParties := p.circuit.NParties
+	id := p.nextRound()
+
+	// 1. Share a random bit in both fields. The first share of each message is in the prime field, and the second in
+	//    the binary field.
+	bit := big.NewInt(int64(rand.Intn(2)))
+	primePoly := poly.Random(bit, p.degree, p.field)
+	binaryPoly := poly.Random(bit, p.degree, p.binary)
+	for party := 0; party < nParties; party++ {
+		x := point(party)
+		if err := p.SendShares(ctx, party, id, primePoly.Eval(x), binaryPoly.Eval(x)); err != nil {
+			return doubleBit{}, err
+		}
+	}
+
+	if err := p.awaitShares(ctx, id, p.allParties(), nParties); err != nil {
+		return doubleBit{}, err
+	}
+	received, err := p.receivedShares(id, 2)
+	if err != nil {
+		return doubleBit{}, err
+	}
+
+	// 2. Combine every party's bit.
+	bits := make([]*big.Int, nParties, nParties)
+	binaryShares := make([]*big.Int, nParties, nParties)
+	for party := 0; party < nParties; party++ {
+		bits[party] = received[party][0]
+		binaryShares[party] = received[party][1]
+	}
+	for len(bits) > 1 {
+		half := len(bits) / 2
+		products, err := p.multiplier.mul(ctx, p.nextRound(), bits[:half], bits[half:2*half])
+		if err != nil {
+			return doubleBit{}, err
+		}
+		combined := make([]*big.Int, half, half)
+		for k := range combined {
+			sum := p.field.Add(bits[k], bits[half+k])
+			combined[k] = p.field.Sub(sum, p.field.Mul(big.NewInt(2), products[k]))
+		}
+		// An odd bit out is carried over to the next level.
+		bits = append(combined, bits[2*half:]...)
+	}
+
+	return doubleBit{prime: bits[0], binary: p.binary.Summation(binaryShares)}, nil
+}
+
+// doubleBitsTriples returns the number of multiplications used by doubleBits with nParties parties, which is one for
+// each pair of bits combined.
+func doubleBitsTriples(nParties int) int {
+	return nParties - 1
+}
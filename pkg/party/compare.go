@@ -0,0 +1,404 @@
+package party
+
+import (
+	"context"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"math/big"
+	"math/bits"
+)
+
+func (p *Party) processEqual(ctx context.Context, gateIdx int, gate *gate.Equal) error {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+
+	// a and b are equal exactly when every bit of a - b is zero.
+	bits, err := p.decompose(ctx, p.field.Sub(gate.First().Output(), gate.Second().Output()))
+	if err != nil {
+		return fmt.Errorf("gate %d (%s): %v", gateIdx, gate.Type(), err)
+	}
+	_, eq, err := p.compareBits(ctx, bits, publicBits(new(big.Int), len(bits)))
+	if err != nil {
+		return err
+	}
+
+	p.logger.Printf("%s bits of difference %v, equal = %d", gatePrefix, bits, eq)
+
+	gate.SetOutput(eq)
+	return nil
+}
+
+func (p *Party) processLessThan(ctx context.Context, gateIdx int, gate *gate.LessThan) error {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+
+	fsts, err := p.bitsOf(ctx, gate.First())
+	if err != nil {
+		return fmt.Errorf("gate %d (%s): %v", gateIdx, gate.Type(), err)
+	}
+	snds, err := p.bitsOf(ctx, gate.Second())
+	if err != nil {
+		return fmt.Errorf("gate %d (%s): %v", gateIdx, gate.Type(), err)
+	}
+	lt, _, err := p.compareBits(ctx, fsts, snds)
+	if err != nil {
+		return err
+	}
+
+	p.logger.Printf("%s bits %v < %v = %d", gatePrefix, fsts, snds, lt)
+
+	gate.SetOutput(lt)
+	return nil
+}
+
+func (p *Party) processBitDecompose(ctx context.Context, gateIdx int, gate *gate.BitDecompose) error {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+
+	bits, err := p.bitsOf(ctx, gate.First())
+	if err != nil {
+		return fmt.Errorf("gate %d (%s): %v", gateIdx, gate.Type(), err)
+	}
+	// Every element of the field is less than 2^l, so the higher bits are always zero.
+	out := new(big.Int)
+	if gate.Bit < len(bits) {
+		out = bits[gate.Bit]
+	}
+
+	p.logger.Printf("%s bits %v, bit %d = %d", gatePrefix, bits, gate.Bit, out)
+
+	gate.SetOutput(out)
+	return nil
+}
+
+// bitsOf returns this party's shares of the bits of the output of g, decomposing it if it has not been already.
+func (p *Party) bitsOf(ctx context.Context, g gate.Gate) ([]*big.Int, error) {
+	if bits, ok := p.bits[g]; ok {
+		return bits, nil
+	}
+	bits, err := p.decompose(ctx, g.Output())
+	if err != nil {
+		return nil, err
+	}
+	p.bits[g] = bits
+	return bits, nil
+}
+
+// decompose returns this party's shares of the l bits of the value that a is a share of, least significant first, where
+// l is the bit length of the prime. The parties generate a random value r < p whose bits are shared, and open
+// c = a - r, which reveals nothing about a. Then a = c + r or c + r - p, depending on whether the sum wraps around p,
+// which is computed using the shared bits of r. This is the protocol of Damgård, Fitzi, Kiltz, Nielsen and Toft.
+// See https://link.springer.com/chapter/10.1007/11681878_15.
+func (p *Party) decompose(ctx context.Context, a *big.Int) ([]*big.Int, error) {
+	l := p.field.Prime.BitLen()
+
+	// 1. Generate a random value r < p, and open c = a - r.
+	rBits, err := p.randomBitwise(ctx)
+	if err != nil {
+		return nil, err
+	}
+	terms := make([]*big.Int, l, l)
+	for i, bit := range rBits {
+		terms[i] = p.field.Mul(bit, new(big.Int).Lsh(big.NewInt(1), uint(i)))
+	}
+	r := p.field.Summation(terms)
+	opened, err := p.open(ctx, p.nextRound(), p.field, []*big.Int{p.field.Sub(a, r)})
+	if err != nil {
+		return nil, err
+	}
+	c := opened[0]
+
+	// 2. Compute the l+1 bits of c + r, which is in [0, 2p).
+	sum, err := p.addPublic(ctx, rBits, c)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. The sum wrapped around p if it is not less than p, in which case a = c + r - p. The bits of c + r - p are
+	//    computed by adding 2^(l+1) - p and ignoring the carry.
+	lt, _, err := p.compareBits(ctx, sum, publicBits(p.field.Prime, l+1))
+	if err != nil {
+		return nil, err
+	}
+	wrapped := p.field.Sub(big.NewInt(1), lt)
+	diff, err := p.addPublic(ctx, sum, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(l+1)), p.field.Prime))
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. Select the bits of c + r - p if the sum wrapped around, and of c + r otherwise.
+	wrappedShares := make([]*big.Int, l, l)
+	deltas := make([]*big.Int, l, l)
+	for i := 0; i < l; i++ {
+		wrappedShares[i] = wrapped
+		deltas[i] = p.field.Sub(diff[i], sum[i])
+	}
+	selected, err := p.multiplier.mul(ctx, p.nextRound(), wrappedShares, deltas)
+	if err != nil {
+		return nil, err
+	}
+	bits := make([]*big.Int, l, l)
+	for i := range bits {
+		bits[i] = p.field.Add(sum[i], selected[i])
+	}
+	return bits, nil
+}
+
+// decomposeTriples returns the number of multiplications used by decompose when the bit length of the prime is l, if
+// no random value has to be generated again.
+func decomposeTriples(l int) int {
+	// The bits of r, c + r and c + r - p are computed, then one bit of each sum is selected for each of the l bits.
+	return randomBitwiseTriples(l) + addPublicTriples(l) + compareBitsTriples(l+1) + addPublicTriples(l+1) + l
+}
+
+// randomBitwise returns this party's shares of the l bits of a uniformly random value r < p, least significant
+// first, where l is the bit length of the prime. Random l-bit values are generated until one is less than p, which
+// happens with probability more than 1/2 each time, so it is attempted up to 4 * maxAttempts times.
+func (p *Party) randomBitwise(ctx context.Context) ([]*big.Int, error) {
+	l := p.field.Prime.BitLen()
+	primeBits := publicBits(p.field.Prime, l)
+	for attempt := 0; attempt < 4*maxAttempts; attempt++ {
+		if attempt > 0 {
+			// The retried value needs triples which were not counted by TriplesNeeded.
+			if err := p.multiplier.preprocess(ctx, randomBitwiseTriples(l)); err != nil {
+				return nil, err
+			}
+		}
+		bits, err := p.randomBits(ctx, l)
+		if err != nil {
+			return nil, err
+		}
+		lt, _, err := p.compareBits(ctx, bits, primeBits)
+		if err != nil {
+			return nil, err
+		}
+		// Whether r < p reveals nothing about r once it is accepted.
+		opened, err := p.open(ctx, p.nextRound(), p.field, []*big.Int{lt})
+		if err != nil {
+			return nil, err
+		}
+		if opened[0].Sign() != 0 {
+			return bits, nil
+		}
+	}
+	return nil, fmt.Errorf("random value was not less than %d in %d attempts", p.field.Prime, 4*maxAttempts)
+}
+
+// randomBitwiseTriples returns the number of multiplications used by each attempt of randomBitwise when the bit length
+// of the prime is l, if no random bit has to be generated again.
+func randomBitwiseTriples(l int) int {
+	// Each random bit needs a multiplication, and then the bits are compared with the bits of the prime.
+	return l + compareBitsTriples(l)
+}
+
+// compareBits returns this party's shares of whether x < y and whether x = y, where xs and ys are shares of the bits
+// of x and y, least significant first. Either may be public, in which case its bits are their own shares. x < y if y
+// has a 1 where x has a 0 at the most significant bit at which they differ, which is found using the prefix ORs of the
+// bits at which they differ, from the most significant. This is the constant-round comparison of Damgård et al., so it
+// takes the same number of rounds of communication however large the prime is.
+func (p *Party) compareBits(ctx context.Context, xs, ys []*big.Int) (*big.Int, *big.Int, error) {
+	n := len(xs)
+	one := big.NewInt(1)
+
+	// 1. Compute x_i y_i for every bit in a single round. Then x_i XOR y_i = x_i + y_i - 2 x_i y_i.
+	xys, err := p.multiplier.mul(ctx, p.nextRound(), xs, ys)
+	if err != nil {
+		return nil, nil, err
+	}
+	// differs are whether x_i and y_i differ, from the most significant bit.
+	differs := make([]*big.Int, n, n)
+	for i := range xys {
+		differs[n-1-i] = p.field.Sub(p.field.Add(xs[i], ys[i]), p.field.Mul(big.NewInt(2), xys[i]))
+	}
+
+	// 2. f_k is 1 if x and y differ at any of the k+1 most significant bits, so f_k - f_{k-1} is 1 exactly at the most
+	//    significant bit at which they differ. x and y are equal if they do not differ at any bit.
+	prefixes, err := p.preOr(ctx, [][]*big.Int{differs})
+	if err != nil {
+		return nil, nil, err
+	}
+	fs := prefixes[0]
+	eq := p.field.Sub(one, fs[n-1])
+
+	// 3. x < y if y_i is 1 at that bit.
+	firsts := make([]*big.Int, n, n)
+	for k := range firsts {
+		firsts[k] = fs[k]
+		if k > 0 {
+			firsts[k] = p.field.Sub(fs[k], fs[k-1])
+		}
+	}
+	msbFirst := make([]*big.Int, n, n)
+	for i, y := range ys {
+		msbFirst[n-1-i] = y
+	}
+	products, err := p.multiplier.mul(ctx, p.nextRound(), firsts, msbFirst)
+	if err != nil {
+		return nil, nil, err
+	}
+	lt := p.field.Summation(products)
+
+	return lt, eq, nil
+}
+
+// compareBitsTriples returns the number of multiplications used by compareBits to compare n bits, which is two for
+// each bit, and those of the prefix ORs.
+func compareBitsTriples(n int) int {
+	return 2*n + preOrTriples(n)
+}
+
+// addPublic returns this party's shares of the len(bits)+1 bits of x + c, least significant first, where bits are
+// shares of the bits of x and c is public and less than 2^len(bits). The carry into bit i+1 is c_j, where j is the
+// most significant bit up to i at which x_j = c_j, since x_j + c_j carries exactly when both are 1, and the bits
+// between propagate it. This is found for every bit in the same number of rounds of communication, however many bits
+// there are, using O(n log n) multiplications. The bits up to i are split into at most log2(n)+1 aligned blocks whose
+// sizes are powers of 2, given by the bits of i+1. For every block, the most significant bit at which x_j = c_j is
+// found using prefix ORs, and then for every bit, the most significant of its blocks which has such a bit.
+func (p *Party) addPublic(ctx context.Context, bits []*big.Int, c *big.Int) ([]*big.Int, error) {
+	n := len(bits)
+	one := big.NewInt(1)
+
+	// same are whether x_j = c_j.
+	same := make([]*big.Int, n, n)
+	for j, bit := range bits {
+		same[j] = bit
+		if c.Bit(j) == 0 {
+			same[j] = p.field.Sub(one, bit)
+		}
+	}
+
+	// 1. For every aligned block, any is whether x_j = c_j for any of its bits, and carry is c_j at the most
+	//    significant of them, which is a share since the indicator of that bit is shared and c is public.
+	blocks := addPublicBlocks(n)
+	vecs := make([][]*big.Int, len(blocks), len(blocks))
+	for b, blk := range blocks {
+		for j := blk.end - 1; j >= blk.start; j-- {
+			vecs[b] = append(vecs[b], same[j])
+		}
+	}
+	prefixes, err := p.preOr(ctx, vecs)
+	if err != nil {
+		return nil, err
+	}
+	anys := make(map[addPublicBlock]*big.Int)
+	carries := make(map[addPublicBlock]*big.Int)
+	for b, blk := range blocks {
+		fs := prefixes[b]
+		carry := new(big.Int)
+		for k, j := 0, blk.end-1; j >= blk.start; k, j = k+1, j-1 {
+			if c.Bit(j) == 1 {
+				first := fs[k]
+				if k > 0 {
+					first = p.field.Sub(fs[k], fs[k-1])
+				}
+				carry = p.field.Add(carry, first)
+			}
+		}
+		anys[blk] = fs[len(fs)-1]
+		carries[blk] = carry
+	}
+
+	// 2. The carry into bit i+1 is the carry of the most significant block of the bits up to i which has any bit with
+	//    x_j = c_j. The carry of a block is 0 unless it has one, so the most significant block needs no
+	//    multiplication.
+	vecs = make([][]*big.Int, n, n)
+	for i := range vecs {
+		for _, blk := range prefixBlocks(i + 1) {
+			vecs[i] = append(vecs[i], anys[blk])
+		}
+	}
+	if prefixes, err = p.preOr(ctx, vecs); err != nil {
+		return nil, err
+	}
+	var fsts, snds []*big.Int
+	for i := range vecs {
+		fs := prefixes[i]
+		for k, blk := range prefixBlocks(i + 1)[1:] {
+			fsts = append(fsts, p.field.Sub(fs[k+1], fs[k]))
+			snds = append(snds, carries[blk])
+		}
+	}
+	var products []*big.Int
+	if len(fsts) > 0 {
+		if products, err = p.multiplier.mul(ctx, p.nextRound(), fsts, snds); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. x_i + c_i + carry_i = sum_i + 2 carry_{i+1}.
+	sum := make([]*big.Int, n+1, n+1)
+	carry := new(big.Int)
+	for i, bit := range bits {
+		blks := prefixBlocks(i + 1)
+		terms := []*big.Int{carries[blks[0]]}
+		terms = append(terms, products[:len(blks)-1]...)
+		products = products[len(blks)-1:]
+		next := p.field.Summation(terms)
+
+		total := p.field.Add(p.field.Add(bit, big.NewInt(int64(c.Bit(i)))), carry)
+		sum[i] = p.field.Sub(total, p.field.Mul(big.NewInt(2), next))
+		carry = next
+	}
+	sum[n] = carry
+
+	return sum, nil
+}
+
+// addPublicBlock is the bits from start up to, but not including, end.
+type addPublicBlock struct {
+	start, end int
+}
+
+// addPublicBlocks returns every block which prefixBlocks returns for the first i bits, for i up to n. These are the
+// aligned blocks of 2^k bits which are all less than n, from the largest.
+func addPublicBlocks(n int) []addPublicBlock {
+	var blocks []addPublicBlock
+	size := 1
+	for size*2 <= n {
+		size *= 2
+	}
+	for ; size >= 1; size /= 2 {
+		for start := 0; start+size <= n; start += size {
+			blocks = append(blocks, addPublicBlock{start, start + size})
+		}
+	}
+	return blocks
+}
+
+// prefixBlocks returns the aligned blocks which make up the first n bits, from the most significant. There is a block
+// of 2^k bits for each bit k of n which is 1.
+func prefixBlocks(n int) []addPublicBlock {
+	var blocks []addPublicBlock
+	start := 0
+	for k := bits.Len(uint(n)) - 1; k >= 0; k-- {
+		if n>>k&1 == 1 {
+			blocks = append(blocks, addPublicBlock{start, start + 1<<k})
+			start += 1 << k
+		}
+	}
+	// The blocks are found from the least significant bits.
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return blocks
+}
+
+// addPublicTriples returns the number of multiplications used by addPublic to add n bits.
+func addPublicTriples(n int) int {
+	t := 0
+	for _, blk := range addPublicBlocks(n) {
+		t += preOrTriples(blk.end - blk.start)
+	}
+	for i := 1; i <= n; i++ {
+		k := len(prefixBlocks(i))
+		t += preOrTriples(k) + k - 1
+	}
+	return t
+}
+
+// publicBits returns the n least significant bits of v, least significant first. Since they are public, every party
+// uses them as its shares.
+func publicBits(v *big.Int, n int) []*big.Int {
+	bits := make([]*big.Int, n, n)
+	for i := range bits {
+		bits[i] = big.NewInt(int64(v.Bit(i)))
+	}
+	return bits
+}
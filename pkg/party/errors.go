@@ -0,0 +1,25 @@
+package party
+
+import "fmt"
+
+// MissingSharesError is returned by Party.Run when the protocol is stopped, for example by a timeout, while a party is
+// still waiting for shares from other parties.
+type MissingSharesError struct {
+	// Party is the id of the party which was waiting.
+	Party int
+	// Gate is the index of the gate that shares were being waited for.
+	Gate int
+	// Missing are the ids of the parties whose shares had not been received.
+	Missing []int
+	// Err is the reason that the protocol was stopped, typically context.DeadlineExceeded or context.Canceled.
+	Err error
+}
+
+func (e *MissingSharesError) Error() string {
+	return fmt.Sprintf("party %d stopped waiting for shares for gate %d from parties %v: %v", e.Party, e.Gate, e.Missing, e.Err)
+}
+
+// Unwrap returns the reason that the protocol was stopped.
+func (e *MissingSharesError) Unwrap() error {
+	return e.Err
+}
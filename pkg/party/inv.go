@@ -0,0 +1,181 @@
+package party
+
+import (
+	"context"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"math/big"
+	"sort"
+)
+
+// orderDivs returns gates, which are in the order they are evaluated, reordered so that as many inverse and division
+// gates as possible can be evaluated together. Gates are ordered by the number of inverse and division gates among
+// gates which they depend on, and inverse and division gates come after the other gates which depend on the same
+// number, so every gate still follows its inputs.
+func orderDivs(gates []gate.Gate) []gate.Gate {
+	isDiv := func(g gate.Gate) bool {
+		switch g.(type) {
+		case *gate.Inv, *gate.Div:
+			return true
+		}
+		return false
+	}
+
+	divs := make(map[gate.Gate]int)
+	for _, g := range gates {
+		n := 0
+		for _, in := range []gate.Gate{g.First(), g.Second()} {
+			m, ok := divs[in]
+			if !ok {
+				continue
+			}
+			if isDiv(in) {
+				m++
+			}
+			if m > n {
+				n = m
+			}
+		}
+		divs[g] = n
+	}
+
+	res := make([]gate.Gate, len(gates), len(gates))
+	copy(res, gates)
+	sort.SliceStable(res, func(i, j int) bool {
+		if divs[res[i]] != divs[res[j]] {
+			return divs[res[i]] < divs[res[j]]
+		}
+		return !isDiv(res[i]) && isDiv(res[j])
+	})
+	return res
+}
+
+// processDivs evaluates the specified inverse and division gates together, so that they share rounds of communication,
+// where ids are the indexes of the gates. None of the gates may depend on another.
+func (p *Party) processDivs(ctx context.Context, ids []int, gates []gate.Gate) error {
+	nums := make([]*big.Int, len(gates), len(gates))
+	dens := make([]*big.Int, len(gates), len(gates))
+	for k, g := range gates {
+		switch v := g.(type) {
+		case *gate.Inv:
+			dens[k] = v.First().Output()
+		case *gate.Div:
+			nums[k], dens[k] = v.First().Output(), v.Second().Output()
+		}
+	}
+
+	outputs, err := p.divide(ctx, ids, gates, nums, dens)
+	if err != nil {
+		return err
+	}
+	for k, g := range gates {
+		g.SetOutput(outputs[k])
+	}
+	return nil
+}
+
+// divide returns this party's shares of nums[k] / dens[k] for each of gates, where nums and dens are shares, or of
+// 1 / dens[k] if nums[k] is nil. It masks each den with a shared random value r, and opens w = den * r, which reveals
+// nothing about den since r is uniformly random. Then r * w^-1 is a share of den^-1, and similarly num * r * w^-1 is a
+// share of num / den. Every quotient is computed in the same rounds of communication. If w is zero, r is opened to
+// find out whether den is zero, in which case an error wrapping circuit.ErrDivisionByZero is returned, or r is, in
+// which case that quotient is computed again with a new mask.
+func (p *Party) divide(ctx context.Context, ids []int, gates []gate.Gate, nums, dens []*big.Int) ([]*big.Int, error) {
+	outputs := make([]*big.Int, len(gates), len(gates))
+	// pending are the indexes of the quotients which have not been computed yet.
+	pending := make([]int, len(gates), len(gates))
+	for k := range pending {
+		pending[k] = k
+	}
+
+	for attempt := 0; attempt < maxAttempts && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			// The retried quotients need triples which were not counted by TriplesNeeded.
+			n := len(pending)
+			for _, i := range pending {
+				if nums[i] != nil {
+					n++
+				}
+			}
+			if err := p.multiplier.preprocess(ctx, n); err != nil {
+				return nil, err
+			}
+		}
+
+		// 1. Jointly generate a random mask r for each quotient, which no party knows.
+		rs, err := p.randomShares(ctx, p.nextRound(), len(pending))
+		if err != nil {
+			return nil, err
+		}
+
+		// 2. Multiply every den, and every num, by its mask in a single round. The products with dens come first.
+		var fsts, snds []*big.Int
+		for k, i := range pending {
+			fsts = append(fsts, dens[i])
+			snds = append(snds, rs[k])
+		}
+		for k, i := range pending {
+			if nums[i] != nil {
+				fsts = append(fsts, nums[i])
+				snds = append(snds, rs[k])
+			}
+		}
+		products, err := p.multiplier.mul(ctx, p.nextRound(), fsts, snds)
+		if err != nil {
+			return nil, err
+		}
+
+		// 3. Open every w = den * r in a single round, and invert them publicly.
+		ws, err := p.open(ctx, p.nextRound(), p.field, products[:len(pending)])
+		if err != nil {
+			return nil, err
+		}
+		numProducts := products[len(pending):]
+		// zero are the indexes into pending of the quotients for which w is zero.
+		var zero []int
+		for k, i := range pending {
+			masked := rs[k]
+			if nums[i] != nil {
+				masked, numProducts = numProducts[0], numProducts[1:]
+			}
+			w := ws[k]
+			if w.Sign() == 0 {
+				zero = append(zero, k)
+				continue
+			}
+			wInv := p.field.Inv(w)
+			outputs[i] = p.field.Mul(masked, wInv)
+
+			p.logger.Printf("%s opened w = %d, %d × %d^-1 mod %d = %d", p.gatePrefix(ids[i], gates[i].Type()), w, masked, w, p.field.Prime, outputs[i])
+		}
+		if len(zero) == 0 {
+			return outputs, nil
+		}
+
+		// 4. For each w which is zero, either den or r is zero. Opening r reveals which, and reveals nothing else since
+		//    r is not used again. Every such r is opened in a single round.
+		zeroRs := make([]*big.Int, len(zero), len(zero))
+		for z, k := range zero {
+			zeroRs[z] = rs[k]
+		}
+		opened, err := p.open(ctx, p.nextRound(), p.field, zeroRs)
+		if err != nil {
+			return nil, err
+		}
+		var retry []int
+		for z, k := range zero {
+			i := pending[k]
+			if opened[z].Sign() != 0 {
+				return nil, fmt.Errorf("gate %d (%s): %w", ids[i], gates[i].Type(), circuit.ErrDivisionByZero)
+			}
+			retry = append(retry, i)
+
+			p.logger.Printf("%s random mask was zero, retrying", p.gatePrefix(ids[i], gates[i].Type()))
+		}
+		pending = retry
+	}
+
+	i := pending[0]
+	return nil, fmt.Errorf("gate %d (%s): random mask was zero in %d attempts", ids[i], gates[i].Type(), maxAttempts)
+}
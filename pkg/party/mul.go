@@ -0,0 +1,121 @@
+package party
+
+import (
+	"context"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/field"
+	"github.com/sonjoonho/bgw/pkg/poly"
+	"math/big"
+	"strings"
+)
+
+// multiplier is a protocol for multiplying shared values.
+type multiplier interface {
+	// degree returns the degree of the sharing produced by multiplying values shared with polynomials of degree a and
+	// b, or an error if this protocol cannot multiply them.
+	degree(a, b int) (int, error)
+	// preprocess performs any work that does not depend on the inputs, before n more multiplications are evaluated. It
+	// is called before the circuit is evaluated, and again whenever a gate is retried.
+	preprocess(ctx context.Context, n int) error
+	// mul returns this party's shares of the products of the values that fsts[i] and snds[i] are shares of. Every
+	// product is computed in the same round of communication, whose messages are identified by id.
+	mul(ctx context.Context, id int, fsts, snds []*big.Int) ([]*big.Int, error)
+}
+
+// grr multiplies shared values by multiplying shares locally, then reducing the degree of the result by re-sharing it.
+// This is the protocol of Gennaro, Rabin and Rabin. See https://dl.acm.org/doi/10.1145/277697.277716.
+type grr struct {
+	p *Party
+	// field is the field that the shares are in, which is either the prime field or the binary field of p.
+	field field.Finite
+}
+
+// degree returns T, as long as there are enough parties to reconstruct the product of the local shares, which has
+// degree a + b.
+func (m *grr) degree(a, b int) (int, error) {
+	if nParties := m.p.circuit.NParties; !(a+b < nParties) {
+		return 0, fmt.Errorf("cannot multiply sharings of degree %d and %d with %d parties, which requires %d < N", a, b, nParties, a+b)
+	}
+	return m.p.degree, nil
+}
+
+// preprocess does nothing, since every multiplication is evaluated interactively.
+func (m *grr) preprocess(ctx context.Context, n int) error {
+	return nil
+}
+
+func (m *grr) mul(ctx context.Context, id int, fsts, snds []*big.Int) ([]*big.Int, error) {
+	p := m.p
+	// gatePrefix marks this gate in the logging output for readability.
+	gatePrefix := p.gatePrefix(id, "MUL")
+	prime := m.field.Modulus()
+	nParties := p.circuit.NParties
+	n := len(fsts)
+
+	// 1. Each party locally computes d = a * b. This is a share of the product with degree equal to the sum of the
+	//    degrees of the sharings of a and b.
+	// 2. Each party produces a polynomial delta of degree at most degree such delta_i(0) = d^i.
+	polys := make([]*poly.Poly, n, n)
+	for k := range fsts {
+		out := m.field.Mul(fsts[k], snds[k])
+		polys[k] = poly.Random(out, p.degree, m.field)
+
+		p.logger.Printf("%s %d × %d mod %d = %d", gatePrefix, fsts[k], snds[k], prime, out)
+		p.logger.Printf("%s using polynomial %s", gatePrefix, polys[k])
+	}
+
+	// 3. Each party i distributes to party j the value d_{i, j} = delta_i(j). The shares of every product are sent in
+	//    a single message.
+
+	// sentShares are the shares sent from this party. This variable is used for logging only.
+	sentShares := make([][]*big.Int, nParties, nParties)
+	for party := 0; party < nParties; party++ {
+		shares := make([]*big.Int, n, n)
+		for k, po := range polys {
+			shares[k] = po.Eval(point(party))
+		}
+		if err := p.SendShares(ctx, party, id, shares...); err != nil {
+			return nil, err
+		}
+
+		sentShares[party] = shares
+	}
+
+	p.logger.Printf("%s sent shares %v", gatePrefix, sentShares)
+
+	if err := p.awaitShares(ctx, id, p.allParties(), nParties); err != nil {
+		return nil, err
+	}
+	// At this point, all shares for this gate will have been received.
+	// i.e. p.shares[parties][gate] != nil for all parties.
+	received, err := p.receivedShares(id, n)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Printf("%s received shares %v", gatePrefix, p.formatSharesForGate(id))
+
+	// Each party j computes c^j. Since the local products lie on a polynomial of degree less than N, combining every
+	// party's re-shared product with the recombination vector gives a share of the product with degree T.
+	recombination := p.recombinationVector(p.allParties(), m.field)
+	outputs := make([]*big.Int, n, n)
+	for k := range outputs {
+		terms := make([]*big.Int, nParties, nParties)
+
+		// termStrings are the terms of the summation formatted as a string for debugging.
+		termsStrings := make([]string, nParties, nParties)
+		for party := 0; party < nParties; party++ {
+			share := received[party][k]
+			basis := recombination[party]
+			terms[party] = m.field.Mul(share, basis)
+
+			termsStrings[party] = fmt.Sprintf("(%d × %d)", share, basis)
+		}
+		outputs[k] = m.field.Summation(terms)
+
+		summationString := strings.Join(termsStrings, " + ")
+		p.logger.Printf("%s %s mod %d = %d", gatePrefix, summationString, prime, outputs[k])
+	}
+
+	return outputs, nil
+}
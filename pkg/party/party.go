@@ -2,71 +2,92 @@
 package party
 
 import (
+	"context"
 	"fmt"
 	"github.com/sonjoonho/bgw/pkg/circuit"
 	"github.com/sonjoonho/bgw/pkg/field"
 	"github.com/sonjoonho/bgw/pkg/gate"
 	"github.com/sonjoonho/bgw/pkg/poly"
+	"github.com/sonjoonho/bgw/pkg/transport"
 	"log"
+	"math/big"
 	"os"
 	"strings"
+	"time"
 )
 
-// message represents a message used for inter-party communication.
-type message struct {
-	// party is the *source* party.
-	party int
-	gate  int
-	share int
-}
+// defaultBinaryField is the binary field that bits are shared over, unless UseBinaryField is called.
+var defaultBinaryField = field.GF256()
 
 // Party is a party which can communicate with other parties.
 type Party struct {
 	// id is the identifier of this Party. It starts from 0.
 	id int
-	// secret is this party's secret.
-	secret int
-	// ch is a channel through which this Party receives messages.
-	ch chan *message
-	// done is...
-	done chan bool
-	// subs is a slice of send-only channels that this party uses to send message to subscribers. Its capacity is equal
-	// to the number of parties, specified during initialisation.
-	subs []chan<- *message
-	// shares is a buffer for received shares. It maps from Party id to gate.Gate to share.
-	shares []map[int]*int
+	// secrets are this party's secret inputs, indexed by gate.Input.Index.
+	secrets []*big.Int
+	// transport is used to communicate with other parties.
+	transport transport.Transport
+	// shares is a buffer for received shares. It maps from Party id to gate.Gate to the shares received for that gate,
+	// of which there is usually one.
+	shares []map[int][]*big.Int
 	// field is the field that we perform arithmetic over.
 	field field.Field
+	// binary is the binary field that bits are shared over by boolean gates.
+	binary field.Binary
 	// circuit is the circuit that this party evaluates.
 	circuit *circuit.Circuit
 	// degree is the degree of the polynomial in Shamir Secret Sharing.
 	degree int
+	// degrees tracks the degree of the polynomial that the output of each gate is shared with, which can grow as
+	// gates are evaluated. It is populated by checkDegrees before the circuit is evaluated.
+	degrees map[gate.Gate]int
+	// multiplier is the protocol used to evaluate multiplication gates.
+	multiplier multiplier
+	// errorCorrection specifies whether outputs are reconstructed using Reed-Solomon error correction, which tolerates
+	// up to (N-1-T)/2 incorrect output shares at the cost of waiting for a share from every party.
+	errorCorrection bool
+	// faulty are the ids of the parties which sent incorrect output shares. It is only populated if errorCorrection is
+	// enabled.
+	faulty []int
+	// recombination caches recombination vectors. It maps from a field and a set of party ids, formatted as a string,
+	// to the recombination vector for shares from those parties.
+	recombination map[string][]*big.Int
+	// bits caches the shares of the bits of the outputs of gates which have been decomposed.
+	bits map[gate.Gate][]*big.Int
+	// round is the id of the next round of communication used to evaluate a gate which needs several rounds. Ids follow
+	// those used to generate Beaver triples, so they never collide with the id of any other round.
+	round int
 	// logIndentLevel tracks the indentation level for logging.
 	logIndentLevel int
 	// logger is the logger for this party.
 	logger *log.Logger
 }
 
-// New initialises and returns a new Party. nParties specifies the number of parties participating in the protocol,
-// and nGates specifies the number of gates in the circuit.
-func New(id int, secret int, circuit *circuit.Circuit, field field.Field, degree int) *Party {
+// New initialises and returns a new Party, which communicates with other parties using transport.
+func New(id int, secrets []*big.Int, circuit *circuit.Circuit, field field.Field, degree int, transport transport.Transport) *Party {
 	nParties := circuit.NParties
 
 	p := &Party{
-		id:      id,
-		secret:  secret,
-		circuit: circuit,
-		field:   field,
-		ch:      make(chan *message, nParties*nParties),
-		subs:    make([]chan<- *message, nParties, nParties),
-		shares:  make([]map[int]*int, nParties, nParties),
-		degree:  degree,
-		logger:  log.New(os.Stdout, fmt.Sprintf("%03d: ", id), log.Lmicroseconds),
+		id:        id,
+		secrets:   secrets,
+		circuit:   circuit,
+		field:     field,
+		binary:    defaultBinaryField,
+		transport: transport,
+		shares:    make([]map[int][]*big.Int, nParties, nParties),
+		degree:    degree,
+		degrees:   make(map[gate.Gate]int),
+		bits:      make(map[gate.Gate][]*big.Int),
+		// recombination is lazily populated by recombinationVector.
+		recombination: make(map[string][]*big.Int),
+		logger:        log.New(os.Stdout, fmt.Sprintf("%03d: ", id), log.Lmicroseconds),
 	}
 
+	p.multiplier = &grr{p: p, field: p.field}
+
 	// Initialise slices of shares.
 	for i := 0; i < nParties; i++ {
-		p.shares[i] = make(map[int]*int)
+		p.shares[i] = make(map[int][]*big.Int)
 	}
 
 	return p
@@ -77,62 +98,427 @@ func (p *Party) Id() int {
 	return p.id
 }
 
-// SubscribeAll subscribes this Party to all parties.
-func (p *Party) SubscribeAll(parties []*Party) {
-	for _, pty := range parties {
-		p.subs[pty.id] = pty.ch
+// Degrees returns the degree of the polynomial that the output of each gate in the circuit is shared with, in the
+// order that the gates are evaluated (see circuit.Traverse). It is only populated once Run has been called.
+func (p *Party) Degrees() []int {
+	gates := p.circuit.Traverse()
+	degrees := make([]int, len(gates), len(gates))
+	for i, g := range gates {
+		degrees[i] = p.degrees[g]
 	}
+	return degrees
 }
 
-// SendShare sends the specified share to another Party.
-func (p *Party) SendShare(to int, share int, gate int) {
-	ch := p.subs[to]
-	msg := &message{party: p.id, gate: gate, share: share}
-	ch <- msg
+// EnableErrorCorrection makes this Party reconstruct outputs using Reed-Solomon error correction, so that the output is
+// correct even if up to (N-1-T)/2 parties send incorrect output shares. Parties that sent incorrect shares can be
+// retrieved with Faulty once Run has returned.
+func (p *Party) EnableErrorCorrection() {
+	p.errorCorrection = true
 }
 
-// RecvShare receives a share
-func (p *Party) RecvShare() *message {
-	msg := <-p.ch
-	return msg
+// UseBeaverTriples makes this Party multiply using Beaver triples rather than re-sharing every product, which moves
+// most of the communication into an offline phase before any inputs are shared. triples are this party's shares of
+// triples from a trusted dealer (see DealTriples), and there must be at least TriplesNeeded of them, as well as enough
+// for any gates which are retried. If triples is nil, the parties generate triples themselves at the start of Run, and
+// whenever a gate is retried, which requires 2T < N.
+func (p *Party) UseBeaverTriples(triples []Triple) {
+	m := &beaver{p: p, triples: triples}
+	if triples == nil {
+		m.more, m.generates = m.generate, true
+	}
+	p.multiplier = m
+}
+
+// UseDealer makes this Party multiply using Beaver triples dealt by dealer, which deals TriplesNeeded of them at the
+// start of Run, and more whenever a gate is retried.
+func (p *Party) UseDealer(dealer *Dealer) {
+	p.multiplier = &beaver{p: p, more: func(ctx context.Context, n int) ([]Triple, error) {
+		return dealer.Deal(p.id, n), nil
+	}}
+}
+
+// UseBinaryField makes this Party share the bits of boolean gates over binary, which must be a binary field GF(2^k)
+// with 2^k > N. By default, GF(2^8) is used, which supports up to 255 parties.
+func (p *Party) UseBinaryField(binary field.Binary) {
+	p.binary = binary
+}
+
+// Faulty returns the ids of the parties which were identified as sending incorrect output shares, in ascending order.
+// Faults can only be identified if error correction has been enabled.
+func (p *Party) Faulty() []int {
+	return p.faulty
+}
+
+// SendShares sends the specified shares for a gate to another Party in a single message.
+func (p *Party) SendShares(ctx context.Context, to int, gate int, shares ...*big.Int) error {
+	msg := &transport.Message{Party: p.id, Gate: gate, Shares: shares}
+	if err := p.transport.Send(ctx, to, msg); err != nil {
+		return fmt.Errorf("party %d failed to send share for gate %d to party %d: %w", p.id, gate, to, err)
+	}
+	return nil
+}
+
+// RecvShares receives a message from any Party and stores its shares in the share buffer.
+func (p *Party) RecvShares(ctx context.Context) (*transport.Message, error) {
+	msg, err := p.transport.Recv(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("party %d failed to receive share: %w", p.id, err)
+	}
+	// The transport may be connected to an untrusted network, so we cannot assume that the message is well-formed.
+	if msg.Party < 0 || msg.Party >= p.circuit.NParties || len(msg.Shares) == 0 {
+		return nil, fmt.Errorf("party %d received malformed message %+v", p.id, msg)
+	}
+	for _, share := range msg.Shares {
+		if share == nil {
+			return nil, fmt.Errorf("party %d received malformed message %+v", p.id, msg)
+		}
+	}
+
+	p.shares[msg.Party][msg.Gate] = msg.Shares
+	return msg, nil
+}
+
+// awaitShares receives shares until shares for gateIdx have been received from at least n of the specified parties.
+// If ctx is done first, it returns a *MissingSharesError.
+func (p *Party) awaitShares(ctx context.Context, gateIdx int, parties []int, n int) error {
+	for {
+		var missing []int
+		for _, party := range parties {
+			if p.shares[party][gateIdx] == nil {
+				missing = append(missing, party)
+			}
+		}
+		if len(parties)-len(missing) >= n {
+			return nil
+		}
+
+		if _, err := p.RecvShares(ctx); err != nil {
+			if ctx.Err() != nil {
+				return &MissingSharesError{Party: p.id, Gate: gateIdx, Missing: missing, Err: ctx.Err()}
+			}
+			return err
+		}
+	}
 }
 
-// Run runs the BGW protocol for this party.
-func (p *Party) Run() int {
-	p.logger.Printf("Running party %d with secret %d", p.id, p.secret)
+// Run runs the BGW protocol for this party, and returns the value of each output of the circuit in the order of
+// circuit.OutputGates. The value of an output is nil if this party is not one of its recipients. If ctx is done before
+// the protocol finishes, for example because another party has failed, it stops waiting for shares and returns a
+// *MissingSharesError.
+func (p *Party) Run(ctx context.Context) ([]*big.Int, error) {
+	p.logger.Printf("Running party %d with secrets %v", p.id, p.secrets)
 	p.logger.Println("===================================")
 
-	// 2. Run circuit. Note that in this implementation, the initial sharing phase is done every time an input gate is
-	// 	  encountered, not all at once.
+	// 1. Check that this party can evaluate the circuit, before communicating with any other party.
+	if err := p.checkInputs(); err != nil {
+		return nil, err
+	}
+	if err := p.checkDegrees(); err != nil {
+		return nil, err
+	}
+
+	// 2. Perform any preprocessing for the multiplication gates, which does not depend on the inputs.
+	gates := p.circuit.Traverse()
+	p.round = len(gates) + 3
+	start := time.Now()
+	if err := p.multiplier.preprocess(ctx, TriplesNeeded(p.circuit, p.field)); err != nil {
+		return nil, err
+	}
+	online := time.Now()
+	p.logger.Printf("  Offline phase took %v", online.Sub(start))
+
+	// 3. Run circuit, one layer of multiplicative depth at a time. Every multiplication gate in a layer is evaluated in
+	//    a single round of communication, so the number of rounds is the multiplicative depth of the circuit. Note that
+	//    in this implementation, the initial sharing phase is done every time an input gate is encountered, not all at
+	//    once.
+	indexes := make(map[gate.Gate]int)
+	for gIdx, g := range gates {
+		indexes[g] = gIdx
+	}
+	for depth, layer := range p.circuit.Layers() {
+		p.logIndentLevel = 2 * depth
+
+		var muls []*gate.Mul
+		var ands []*gate.And
+		for _, g := range layer {
+			switch v := g.(type) {
+			case *gate.Mul:
+				muls = append(muls, v)
+			case *gate.And:
+				ands = append(ands, v)
+			}
+		}
+		if len(muls) > 0 {
+			// The round is identified by the index of the first multiplication gate in it.
+			if err := p.processMuls(ctx, indexes[muls[0]], muls); err != nil {
+				return nil, err
+			}
+		}
+		if len(ands) > 0 {
+			if err := p.processAnds(ctx, indexes[ands[0]], ands); err != nil {
+				return nil, err
+			}
+		}
+
+		// Inverse and division gates are deferred, so that they can be evaluated together in the same rounds of
+		// communication. They are evaluated once a later gate in the layer uses one of them, or at the end of the
+		// layer, and the gates are ordered so that this happens as rarely as possible.
+		var divIDs []int
+		var divs []gate.Gate
+		deferred := make(map[gate.Gate]bool)
+		processDivs := func() error {
+			if len(divs) == 0 {
+				return nil
+			}
+			err := p.processDivs(ctx, divIDs, divs)
+			divIDs, divs, deferred = nil, nil, make(map[gate.Gate]bool)
+			return err
+		}
+
+		for _, g := range orderDivs(layer[len(muls)+len(ands):]) {
+			if deferred[g.First()] || deferred[g.Second()] {
+				if err := processDivs(); err != nil {
+					return nil, err
+				}
+			}
+
+			switch v := g.(type) {
+			case *gate.Input:
+				if err := p.processInput(ctx, indexes[g], v); err != nil {
+					return nil, err
+				}
+			case *gate.Add:
+				p.processAdd(indexes[g], v)
+			case *gate.Sub:
+				p.processSub(indexes[g], v)
+			case *gate.Neg:
+				p.processNeg(indexes[g], v)
+			case *gate.Const:
+				p.processConst(indexes[g], v)
+			case *gate.AddConst:
+				p.processAddConst(indexes[g], v)
+			case *gate.MulConst:
+				p.processMulConst(indexes[g], v)
+			case *gate.Inv, *gate.Div:
+				divIDs = append(divIDs, indexes[g])
+				divs = append(divs, g)
+				deferred[g] = true
+			case *gate.Random:
+				if err := p.processRandom(ctx, indexes[g], v); err != nil {
+					return nil, err
+				}
+			case *gate.RandomBit:
+				if err := p.processRandomBit(ctx, indexes[g], v); err != nil {
+					return nil, err
+				}
+			case *gate.Equal:
+				if err := p.processEqual(ctx, indexes[g], v); err != nil {
+					return nil, err
+				}
+			case *gate.LessThan:
+				if err := p.processLessThan(ctx, indexes[g], v); err != nil {
+					return nil, err
+				}
+			case *gate.BitDecompose:
+				if err := p.processBitDecompose(ctx, indexes[g], v); err != nil {
+					return nil, err
+				}
+			case *gate.Xor:
+				p.processXor(indexes[g], v)
+			case *gate.Not:
+				p.processNot(indexes[g], v)
+			case *gate.ToBinary:
+				if err := p.processToBinary(ctx, indexes[g], v); err != nil {
+					return nil, err
+				}
+			case *gate.ToArithmetic:
+				if err := p.processToArithmetic(ctx, indexes[g], v); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := processDivs(); err != nil {
+			return nil, err
+		}
+	}
+
+	p.logIndentLevel += 2
+
+	// 4. Create final results. Every output is revealed in a single round, identified by len(gates) since it follows
+	//    the last gate.
+	outputs, err := p.processOutputs(ctx, len(gates), p.circuit.OutputGates())
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Printf("  Online phase took %v", time.Since(online))
+	p.logger.Printf("  Party %d finished with outputs %v", p.id, outputs)
+	p.logger.Println()
+
+	return outputs, nil
+}
+
+// checkInputs returns an error if this party does not have a secret for each of its inputs to the circuit, or if any
+// input of the circuit does not belong to one of the parties.
+func (p *Party) checkInputs() error {
+	for _, g := range p.circuit.Traverse() {
+		if in, ok := g.(*gate.Input); ok && (in.Party < 0 || in.Party >= p.circuit.NParties || in.Index < 0) {
+			return fmt.Errorf("input %s does not belong to one of the %d parties", in.Type(), p.circuit.NParties)
+		}
+	}
+	if n := p.circuit.NInputs()[p.id]; len(p.secrets) != n {
+		return fmt.Errorf("party %d has %d secrets, but the circuit has %d inputs for it", p.id, len(p.secrets), n)
+	}
+	return nil
+}
+
+// checkDegrees computes the degree of the sharing of every gate's output, and returns an error if the circuit cannot be
+// evaluated because a sharing would have too high a degree for the number of parties.
+func (p *Party) checkDegrees() error {
+	if p.degree < 0 {
+		return fmt.Errorf("degree=%d cannot be negative", p.degree)
+	}
+	// Every party needs a distinct non-zero point in the field.
+	if nParties := big.NewInt(int64(p.circuit.NParties)); p.field.Prime.Cmp(nParties) <= 0 {
+		return fmt.Errorf("prime=%d is too small for %d parties, which need distinct non-zero points", p.field.Prime, nParties)
+	}
+
 	gates := p.circuit.Traverse()
 	for gIdx, g := range gates {
+		if err := circuit.CheckDomain(g); err != nil {
+			return fmt.Errorf("gate %d (%s): %v", gIdx, g.Type(), err)
+		}
+		if circuit.IsBinary(g) && p.binary.Size().Cmp(big.NewInt(int64(p.circuit.NParties))) <= 0 {
+			// Every party needs a distinct non-zero point in the binary field.
+			return fmt.Errorf("gate %d (%s): binary field with %d elements is too small for %d parties", gIdx, g.Type(), p.binary.Size(), p.circuit.NParties)
+		}
+
+		var degree int
 		switch v := g.(type) {
 		case *gate.Input:
-			p.logIndentLevel = 0
-			p.processInput(gIdx, v)
-		case *gate.Add:
-			p.logIndentLevel += 2
-			p.processAdd(gIdx, v)
+			degree = p.degree
+		case *gate.Add, *gate.Sub, *gate.Xor:
+			// The sum or difference of two polynomials has the degree of the larger of the two.
+			degree = max(p.degrees[v.First()], p.degrees[v.Second()])
+		case *gate.Neg, *gate.Not:
+			degree = p.degrees[v.First()]
+		case *gate.And:
+			// Bits are always multiplied using grr, since Beaver triples are in the prime field.
+			var err error
+			if degree, err = (&grr{p: p, field: p.binary}).degree(p.degrees[v.First()], p.degrees[v.Second()]); err != nil {
+				return fmt.Errorf("gate %d (%s): %v", gIdx, g.Type(), err)
+			}
+		case *gate.ToBinary, *gate.ToArithmetic:
+			// The input is masked with a random bit shared with degree T and opened, and each party's random bit is
+			// combined with the others using multiplication.
+			if d := max(p.degrees[v.First()], p.degree); !(d < p.circuit.NParties) {
+				return fmt.Errorf("gate %d (%s): cannot open masked values shared with degree %d with %d parties", gIdx, g.Type(), d, p.circuit.NParties)
+			}
+			if _, err := p.multiplier.degree(p.degree, p.degree); err != nil {
+				return fmt.Errorf("gate %d (%s): %v", gIdx, g.Type(), err)
+			}
+			degree = p.degree
 		case *gate.Mul:
-			p.logIndentLevel += 2
-			p.processMul(gIdx, v)
+			var err error
+			if degree, err = p.multiplier.degree(p.degrees[v.First()], p.degrees[v.Second()]); err != nil {
+				return fmt.Errorf("gate %d (%s): %v", gIdx, g.Type(), err)
+			}
+		case *gate.Const:
+			// Every party uses the constant itself as its share, which lies on a polynomial of degree 0.
+			degree = 0
+		case *gate.AddConst, *gate.MulConst:
+			// Adding a constant, or multiplying by one, does not change the degree.
+			degree = p.degrees[v.First()]
+		case *gate.Inv, *gate.Div:
+			// The divisor, and the dividend if there is one, are multiplied by a random value shared with degree T.
+			for _, in := range []gate.Gate{v.First(), v.Second()} {
+				if in == nil {
+					continue
+				}
+				if _, err := p.multiplier.degree(p.degrees[in], p.degree); err != nil {
+					return fmt.Errorf("gate %d (%s): %v", gIdx, g.Type(), err)
+				}
+			}
+			degree = p.degree
+		case *gate.Random:
+			// Every party's random contribution is shared with degree T, and so is their sum.
+			degree = p.degree
+		case *gate.RandomBit:
+			if err := p.checkRandomBits(); err != nil {
+				return fmt.Errorf("gate %d (%s): %v", gIdx, g.Type(), err)
+			}
+			// The random value is squared, then scaled by a public value.
+			if _, err := p.multiplier.degree(p.degree, p.degree); err != nil {
+				return fmt.Errorf("gate %d (%s): %v", gIdx, g.Type(), err)
+			}
+			degree = p.degree
+		case *gate.Equal, *gate.LessThan, *gate.BitDecompose:
+			// The inputs are masked with a random value shared with degree T and opened.
+			if d := max(max(p.degrees[v.First()], p.degrees[v.Second()]), p.degree); !(d < p.circuit.NParties) {
+				return fmt.Errorf("gate %d (%s): cannot open masked values shared with degree %d with %d parties", gIdx, g.Type(), d, p.circuit.NParties)
+			}
+			if err := p.checkCompare(); err != nil {
+				return fmt.Errorf("gate %d (%s): %v", gIdx, g.Type(), err)
+			}
+			// Random bits, and bits which are compared or added, are multiplied.
+			if _, err := p.multiplier.degree(p.degree, p.degree); err != nil {
+				return fmt.Errorf("gate %d (%s): %v", gIdx, g.Type(), err)
+			}
+			if b, ok := v.(*gate.BitDecompose); ok && b.Bit < 0 {
+				return fmt.Errorf("gate %d (%s): bit %d cannot be negative", gIdx, g.Type(), b.Bit)
+			}
+			degree = p.degree
+		default:
+			return fmt.Errorf("gate %d: unrecognised gate type %s", gIdx, g.Type())
 		}
+		p.degrees[g] = degree
 	}
 
-	p.logIndentLevel += 2
+	return p.checkOutputs()
+}
 
-	// 3. Create final result. The final gate will always be the output gate.
-	outputGateIdx := len(gates) - 1
-	outputGate := gates[outputGateIdx]
-	output := p.processOutput(outputGateIdx, outputGate)
+// checkRandomBits returns an error if random bits cannot be generated, which requires an odd prime.
+func (p *Party) checkRandomBits() error {
+	if p.field.Prime.Bit(0) == 0 {
+		return fmt.Errorf("random bits need an odd prime, but prime=%d", p.field.Prime)
+	}
+	return nil
+}
 
-	p.logger.Printf("  Party %d finished with output %d", p.id, output)
-	p.logger.Println()
+// checkCompare returns an error if shared bits cannot be compared or added, which needs random bits, and a prime larger
+// than one more than the largest group of bits whose OR is computed by ors.
+func (p *Party) checkCompare() error {
+	if err := p.checkRandomBits(); err != nil {
+		return err
+	}
+	// The largest groups are the blocks of the prefix ORs of the l+1 bits of a sum, where l is the bit length of the
+	// prime.
+	if m := newPreOrLayout(p.field.Prime.BitLen() + 1).lambda; p.field.Prime.Cmp(big.NewInt(int64(m+1))) <= 0 {
+		return fmt.Errorf("comparisons need a prime larger than %d, but prime=%d", m+1, p.field.Prime)
+	}
+	return nil
+}
+
+// checkOutputs returns an error if an output cannot be revealed to its recipients. It must be called after the degrees
+// have been computed.
+func (p *Party) checkOutputs() error {
+	nParties := p.circuit.NParties
+	for _, out := range p.circuit.OutputGates() {
+		// Each output is reconstructed from one more share than the degree of its sharing.
+		if degree := p.degrees[out.Gate]; !(degree < nParties) {
+			return fmt.Errorf("output %q is shared with degree %d, which cannot be reconstructed by %d parties", out.Name, degree, nParties)
+		}
+		for _, r := range out.Recipients {
+			if r < 0 || r >= nParties {
+				return fmt.Errorf("output %q has recipient %d, which is not one of the %d parties", out.Name, r, nParties)
+			}
+		}
+	}
 
-	return output
+	return nil
 }
 
-func (p *Party) processInput(gateIdx int, gate *gate.Input) {
+func (p *Party) processInput(ctx context.Context, gateIdx int, gate *gate.Input) error {
 	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
 	nParties := p.circuit.NParties
 
@@ -143,20 +529,21 @@ func (p *Party) processInput(gateIdx int, gate *gate.Input) {
 	// If this gate is an input corresponding to this party, we want to send shares to all parties (including itself).
 	// Otherwise, we want to receive shares from all other parties.
 	if gate.Party == p.id {
-		po := poly.Random(p.secret, p.degree, p.field)
+		po := poly.Random(p.secrets[gate.Index], p.degree, p.field)
 
 		// sentShares are the shares sent from this party. This variable is used for logging only.
-		sentShares := make([]int, nParties, nParties)
+		sentShares := make([]*big.Int, nParties, nParties)
 		p.logger.Printf("%s using polynomial %s", gatePrefix, po)
 
 		// Evaluate P(0) and broadcast to each party.
 		for party := 0; party < nParties; party++ {
-			i := party + 1
-			share := po.Eval(i)
+			share := po.Eval(point(party))
 			if party != p.id {
-				p.SendShare(party, share, gateIdx)
+				if err := p.SendShares(ctx, party, gateIdx, share); err != nil {
+					return err
+				}
 			} else {
-				p.shares[party][gateIdx] = &share
+				p.shares[party][gateIdx] = []*big.Int{share}
 			}
 
 			sentShares[party] = share
@@ -165,14 +552,15 @@ func (p *Party) processInput(gateIdx int, gate *gate.Input) {
 		p.logger.Printf("%s sent shares %v", gatePrefix, sentShares)
 	} else {
 		// Receive shares from the specified party.
-		for p.shares[gate.Party][gateIdx] == nil {
-			msg := p.RecvShare()
-			p.shares[msg.party][msg.gate] = &msg.share
-
-			p.logger.Printf("%s received share %d from party %d", gatePrefix, msg.share, msg.party)
+		if err := p.awaitShares(ctx, gateIdx, []int{gate.Party}, 1); err != nil {
+			return err
 		}
+
+		p.logger.Printf("%s received share %d from party %d", gatePrefix, p.shares[gate.Party][gateIdx][0], gate.Party)
 	}
-	gate.SetOutput(*p.shares[gate.Party][gateIdx])
+	gate.SetOutput(p.shares[gate.Party][gateIdx][0])
+
+	return nil
 }
 
 func (p *Party) processAdd(gateIdx int, gate *gate.Add) {
@@ -188,111 +576,324 @@ func (p *Party) processAdd(gateIdx int, gate *gate.Add) {
 	gate.SetOutput(out)
 }
 
-func (p *Party) processMul(gateIdx int, gate *gate.Mul) {
-	// gatePrefix marks this gate in the logging output for readability.
+func (p *Party) processSub(gateIdx int, gate *gate.Sub) {
 	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
 	fst := gate.First().Output()
 	snd := gate.Second().Output()
 	prime := p.field.Prime
 
-	// 1. Each party locally computes d = a * b.
-	out := p.field.Mul(gate.First().Output(), gate.Second().Output())
+	out := p.field.Sub(fst, snd)
 
-	p.logger.Printf("%s %d × %d mod %d = %d", gatePrefix, fst, snd, prime, out)
+	p.logger.Printf("%s %d - %d mod %d = %d", gatePrefix, fst, snd, prime, out)
 
-	// 2. Each party produces a polynomial delta of degree at most degree such delta_i(0) = d^i.
-	nParties := p.circuit.NParties
-	po := poly.Random(out, p.degree, p.field)
+	gate.SetOutput(out)
+}
 
-	p.logger.Printf("%s using polynomial %s", gatePrefix, po)
+func (p *Party) processNeg(gateIdx int, gate *gate.Neg) {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+	fst := gate.First().Output()
+	prime := p.field.Prime
 
-	// 3. Each party i distributes to party j the value d_{i, j} = delta_i(j).
+	// Negating each share gives a share of the negation.
+	out := p.field.Sub(new(big.Int), fst)
 
-	// sentShares are the shares sent from this party. This variable is used for logging only.
-	sentShares := make([]int, nParties, nParties)
-	for party := 0; party < nParties; party++ {
-		i := party + 1
-		share := po.Eval(i)
-		p.SendShare(party, share, gateIdx)
+	p.logger.Printf("%s -%d mod %d = %d", gatePrefix, fst, prime, out)
+
+	gate.SetOutput(out)
+}
+
+func (p *Party) processConst(gateIdx int, gate *gate.Const) {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+
+	// The constant is public, so it is a share of itself.
+	out := p.field.Mod(gate.Value)
+
+	p.logger.Printf("%s %d mod %d = %d", gatePrefix, gate.Value, p.field.Prime, out)
+
+	gate.SetOutput(out)
+}
+
+func (p *Party) processAddConst(gateIdx int, gate *gate.AddConst) {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+	fst := gate.First().Output()
+
+	out := p.field.Add(fst, gate.Value)
+
+	p.logger.Printf("%s %d + %d mod %d = %d", gatePrefix, fst, gate.Value, p.field.Prime, out)
+
+	gate.SetOutput(out)
+}
 
-		sentShares[party] = share
+func (p *Party) processMulConst(gateIdx int, gate *gate.MulConst) {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+	fst := gate.First().Output()
+
+	out := p.field.Mul(fst, gate.Value)
+
+	p.logger.Printf("%s %d × %d mod %d = %d", gatePrefix, fst, gate.Value, p.field.Prime, out)
+
+	gate.SetOutput(out)
+}
+
+// processMuls evaluates the specified multiplication gates in a single round of communication, identified by id.
+func (p *Party) processMuls(ctx context.Context, id int, gates []*gate.Mul) error {
+	fsts := make([]*big.Int, len(gates), len(gates))
+	snds := make([]*big.Int, len(gates), len(gates))
+	for i, g := range gates {
+		fsts[i] = g.First().Output()
+		snds[i] = g.Second().Output()
 	}
 
-	p.logger.Printf("%s sent shares %v", gatePrefix, sentShares)
+	outputs, err := p.multiplier.mul(ctx, id, fsts, snds)
+	if err != nil {
+		return err
+	}
 
-	for party := 0; party < nParties; party++ {
-		for p.shares[party][gateIdx] == nil {
-			msg := p.RecvShare()
-			p.shares[msg.party][msg.gate] = &msg.share
-		}
+	for i, g := range gates {
+		g.SetOutput(outputs[i])
 	}
-	// At this point, all shares for this gate will have been received.
-	// i.e. p.shares[parties][gate] != nil for all parties.
 
-	p.logger.Printf("%s received shares %v", gatePrefix, p.formatSharesForGate(gateIdx))
+	return nil
+}
 
-	// Each party j computes c^j.
-	terms := make([]int, nParties, nParties)
+// processOutputs reveals the specified outputs to their recipients in a single round of communication, identified by
+// id. It returns the value of each output, which is nil for outputs that this party does not receive.
+func (p *Party) processOutputs(ctx context.Context, id int, outputs []circuit.Output) ([]*big.Int, error) {
+	gatePrefix := p.gatePrefix(id, "OUT")
 
-	// termStrings are the terms of the summation formatted as a string for debugging.
-	termsStrings := make([]string, nParties, nParties)
+	nParties := p.circuit.NParties
+
+	// We send each party our shares of the outputs it receives, in order, so that parties which do not receive an
+	// output learn nothing about it.
 	for party := 0; party < nParties; party++ {
-		share := *p.shares[party][gateIdx]
-		basis := poly.Recombination(party, nParties)
-		terms[party] = p.field.Mul(share, basis)
+		var shares []*big.Int
+		for _, out := range outputs {
+			if out.ReceivedBy(party) {
+				shares = append(shares, out.Gate.Output())
+			}
+		}
+		if len(shares) == 0 {
+			continue
+		}
+		if err := p.SendShares(ctx, party, id, shares...); err != nil {
+			return nil, err
+		}
+
+		p.logger.Printf("%s sent shares %v to party %d", gatePrefix, shares, party)
+	}
 
-		termsStrings[party] = fmt.Sprintf("(%d × %d)", share, basis)
+	// received are the outputs that this party receives, and indexes are their indexes in outputs.
+	var received []circuit.Output
+	var indexes []int
+	for k, out := range outputs {
+		if out.ReceivedBy(p.id) {
+			received = append(received, out)
+			indexes = append(indexes, k)
+		}
+	}
+	results := make([]*big.Int, len(outputs), len(outputs))
+	if len(received) == 0 {
+		p.logger.Printf("%s does not receive any outputs", gatePrefix)
+		return results, nil
 	}
-	output := p.field.Summation(terms)
 
-	summationString := strings.Join(termsStrings, " + ")
-	p.logger.Printf("%s %s mod %d = %d", gatePrefix, summationString, prime, output)
+	var values []*big.Int
+	var err error
+	if p.errorCorrection {
+		values, err = p.decodeOutputs(ctx, id, received)
+	} else {
+		values, err = p.reconstructOutputs(ctx, id, received)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	gate.SetOutput(output)
+	for i, k := range indexes {
+		results[k] = values[i]
+	}
+	return results, nil
 }
 
-func (p *Party) processOutput(gateIdx int, gate gate.Gate) int {
-	gatePrefix := p.gatePrefix(gateIdx, "OUT")
+// reconstructOutputs reconstructs the specified outputs from the shares received for id, which contain a share of each
+// of them in order.
+func (p *Party) reconstructOutputs(ctx context.Context, id int, outputs []circuit.Output) ([]*big.Int, error) {
+	gatePrefix := p.gatePrefix(id, "OUT")
+	nParties := p.circuit.NParties
 
+	// Each output is shared with a polynomial of degree T, so it can be reconstructed from any T+1 shares. We use
+	// whichever shares arrive first, so that we do not have to wait for the slowest parties.
+	nShares := 0
+	for _, out := range outputs {
+		nShares = max(nShares, p.degrees[out.Gate]+1)
+	}
+	if err := p.awaitShares(ctx, id, p.allParties(), nShares); err != nil {
+		return nil, err
+	}
+	var responders []int
+	for party := 0; party < nParties && len(responders) < nShares; party++ {
+		if received := p.shares[party][id]; received != nil {
+			if len(received) != len(outputs) {
+				return nil, fmt.Errorf("party %d sent %d shares for gate %d, want %d", party, len(received), id, len(outputs))
+			}
+			responders = append(responders, party)
+		}
+	}
+
+	p.logger.Printf("%s received shares %v", gatePrefix, p.formatSharesForGate(id))
+
+	results := make([]*big.Int, len(outputs), len(outputs))
+	for k, out := range outputs {
+		fld := p.fieldOf(out.Gate)
+		parties := responders[:p.degrees[out.Gate]+1]
+		terms := make([]*big.Int, len(parties), len(parties))
+		termsStrings := make([]string, len(parties), len(parties))
+		recombination := p.recombinationVector(parties, fld)
+		for i, party := range parties {
+			share := p.shares[party][id][k]
+			basis := recombination[i]
+			terms[i] = fld.Mul(basis, share)
+
+			termsStrings[i] = fmt.Sprintf("(%d × %d)", share, basis)
+		}
+		results[k] = fld.Summation(terms)
+
+		summationString := strings.Join(termsStrings, " + ")
+		p.logger.Printf("%s %s: %s mod %d = %d\n", gatePrefix, out.Name, summationString, fld.Modulus(), results[k])
+	}
+
+	return results, nil
+}
+
+// decodeOutputs reconstructs the outputs from the output shares of every party using Reed-Solomon error correction,
+// and records the parties which sent incorrect shares for any output.
+func (p *Party) decodeOutputs(ctx context.Context, id int, outputs []circuit.Output) ([]*big.Int, error) {
+	gatePrefix := p.gatePrefix(id, "OUT")
 	nParties := p.circuit.NParties
 
-	// We broadcast our share to all other parties, and receive shares from all other parties.
-	sentShares := make([]int, nParties, nParties)
+	if err := p.awaitShares(ctx, id, p.allParties(), nParties); err != nil {
+		return nil, err
+	}
+	received, err := p.receivedShares(id, len(outputs))
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Printf("%s received shares %v", gatePrefix, p.formatSharesForGate(id))
+
+	xs := make([]*big.Int, nParties, nParties)
 	for party := 0; party < nParties; party++ {
-		share := gate.Output()
-		// gateIdx + 1 identifies the implicit "output gate".
-		p.SendShare(party, share, gateIdx+1)
+		xs[party] = point(party)
+	}
+
+	faulty := make(map[int]bool)
+	results := make([]*big.Int, len(outputs), len(outputs))
+	for k, out := range outputs {
+		ys := make([]*big.Int, nParties, nParties)
+		for party := 0; party < nParties; party++ {
+			ys[party] = received[party][k]
+		}
+
+		po, errs, err := poly.Decode(xs, ys, p.degrees[out.Gate], p.fieldOf(out.Gate))
+		if err != nil {
+			return nil, fmt.Errorf("party %d failed to decode output %q: %v", p.id, out.Name, err)
+		}
+		// Parties are indexed by their position in xs.
+		for _, party := range errs {
+			faulty[party] = true
+		}
 
-		sentShares[party] = share
+		results[k] = po.Eval(new(big.Int))
+		p.logger.Printf("%s %s: decoded polynomial %s, output = %d\n", gatePrefix, out.Name, po, results[k])
 	}
 
-	p.logger.Printf("%s sent shares %v", gatePrefix, sentShares)
+	p.faulty = nil
+	for party := 0; party < nParties; party++ {
+		if faulty[party] {
+			p.faulty = append(p.faulty, party)
+		}
+	}
+	if len(p.faulty) > 0 {
+		p.logger.Printf("%s parties %v sent incorrect shares", gatePrefix, p.faulty)
+	}
+
+	return results, nil
+}
 
+// receivedShares returns the shares received from every party for the specified gate, indexed by party id, and checks
+// that each party sent n shares.
+func (p *Party) receivedShares(gateIdx int, n int) ([][]*big.Int, error) {
+	nParties := p.circuit.NParties
+	shares := make([][]*big.Int, nParties, nParties)
 	for party := 0; party < nParties; party++ {
-		for p.shares[party][gateIdx+1] == nil {
-			msg := p.RecvShare()
-			p.shares[msg.party][msg.gate] = &msg.share
+		shares[party] = p.shares[party][gateIdx]
+		if len(shares[party]) != n {
+			return nil, fmt.Errorf("party %d sent %d shares for gate %d, want %d", party, len(shares[party]), gateIdx, n)
 		}
 	}
+	return shares, nil
+}
+
+// recombinationVector returns the recombination vector in fld for shares received from the specified parties, in the
+// same order. Vectors are cached since the same set of parties is typically used for every gate.
+func (p *Party) recombinationVector(parties []int, fld field.Finite) []*big.Int {
+	// The type distinguishes a prime field from a binary field whose polynomial has the same value.
+	key := fmt.Sprintf("%T%v%v", fld, fld, parties)
+	if r, ok := p.recombination[key]; ok {
+		return r
+	}
+
+	points := make([]*big.Int, len(parties), len(parties))
+	for i, party := range parties {
+		points[i] = point(party)
+	}
+	r := poly.Recombination(points, fld)
+	p.recombination[key] = r
 
-	p.logger.Printf("%s received shares %v", gatePrefix, p.formatSharesForGate(gateIdx+1))
+	return r
+}
+
+// fieldOf returns the field that the output of g is shared over.
+func (p *Party) fieldOf(g gate.Gate) field.Finite {
+	if circuit.IsBinary(g) {
+		return p.binary
+	}
+	return p.field
+}
 
-	terms := make([]int, nParties, nParties)
-	termsStrings := make([]string, nParties, nParties)
+// allParties returns the ids of every party in the protocol, in ascending order.
+func (p *Party) allParties() []int {
+	nParties := p.circuit.NParties
+	parties := make([]int, nParties, nParties)
 	for party := 0; party < nParties; party++ {
-		share := *p.shares[party][gateIdx+1]
-		basis := poly.Recombination(party, nParties)
-		terms[party] = p.field.Mul(basis, share)
+		parties[party] = party
+	}
+	return parties
+}
 
-		termsStrings[party] = fmt.Sprintf("(%d × %d)", share, basis)
+// max returns the larger of a and b.
+func max(a, b int) int {
+	if a > b {
+		return a
 	}
-	output := p.field.Summation(terms)
+	return b
+}
 
-	prime := p.field.Prime
-	summationString := strings.Join(termsStrings, " + ")
-	p.logger.Printf("%s %s mod %d = %d\n", gatePrefix, summationString, prime, output)
+// point returns the x-coordinate at which shares for party are evaluated. Parties are indexed from 0, but the point 0
+// is reserved for the secret itself.
+func point(party int) *big.Int {
+	return big.NewInt(int64(party + 1))
+}
+
+// maxAttempts is the number of times that evaluating a gate which needs a nonzero random value is attempted before
+// giving up. An attempt is only retried if the random value is zero, which happens with probability 1/p.
+const maxAttempts = 8
 
-	return output
+// nextRound returns a new id for a round of communication used to evaluate a gate which needs several rounds. Every
+// party evaluates the gates in the same order, so they agree on the ids.
+func (p *Party) nextRound() int {
+	id := p.round
+	p.round++
+	return id
 }
 
 // gatePrefix returns a formatted tag representing a gate e.g. [3 | MUL].
@@ -306,7 +907,14 @@ func (p *Party) formatSharesForGate(gateIdx int) string {
 	nParties := p.circuit.NParties
 	shareStrings := make([]string, nParties, nParties)
 	for party := 0; party < nParties; party++ {
-		shareStrings[party] = fmt.Sprint(*p.shares[party][gateIdx])
+		if shares := p.shares[party][gateIdx]; len(shares) == 1 {
+			shareStrings[party] = fmt.Sprint(shares[0])
+		} else if shares != nil {
+			shareStrings[party] = fmt.Sprint(shares)
+		} else {
+			// This share has not been received (yet).
+			shareStrings[party] = "_"
+		}
 	}
 	return "[" + strings.Join(shareStrings, " ") + "]"
 }
@@ -0,0 +1,1385 @@
+package party
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/circuit"
+	"github.com/sonjoonho/bgw/pkg/field"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"github.com/sonjoonho/bgw/pkg/poly"
+	"github.com/sonjoonho/bgw/pkg/transport"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// corruptTransport is a Transport which adds 1 to the shares of every message that it sends for a particular gate.
+type corruptTransport struct {
+	transport.Transport
+	gate int
+}
+
+func (t *corruptTransport) Send(ctx context.Context, to int, msg *transport.Message) error {
+	if msg.Gate == t.gate {
+		shares := make([]*big.Int, len(msg.Shares), len(msg.Shares))
+		for i, share := range msg.Shares {
+			shares[i] = new(big.Int).Add(share, big.NewInt(1))
+		}
+		msg = &transport.Message{Party: msg.Party, Gate: msg.Gate, Shares: shares}
+	}
+	return t.Transport.Send(ctx, to, msg)
+}
+
+// recordingTransport is a Transport which records the gates of the messages that it sends.
+type recordingTransport struct {
+	transport.Transport
+	mu    sync.Mutex
+	gates map[int]bool
+}
+
+func (t *recordingTransport) Send(ctx context.Context, to int, msg *transport.Message) error {
+	t.mu.Lock()
+	t.gates[msg.Gate] = true
+	t.mu.Unlock()
+	return t.Transport.Send(ctx, to, msg)
+}
+
+// textbook is the example circuit from Smart (p. 445).
+func textbook() *circuit.Circuit {
+	return &circuit.Circuit{
+		NParties: 6,
+		Root: gate.NewAdd(
+			gate.NewAdd(
+				gate.NewMul(
+					&gate.Input{Party: 0},
+					&gate.Input{Party: 1},
+				),
+				gate.NewMul(
+					&gate.Input{Party: 2},
+					&gate.Input{Party: 3},
+				),
+			), gate.NewMul(
+				&gate.Input{Party: 4},
+				&gate.Input{Party: 5},
+			),
+		),
+	}
+}
+
+// shared is a circuit which uses the output of a multiplication gate twice, computing (x_0 x_1 + x_2) x_0 x_1.
+func shared() *circuit.Circuit {
+	mul := gate.NewMul(&gate.Input{Party: 0}, &gate.Input{Party: 1})
+	return &circuit.Circuit{
+		NParties: 3,
+		Root:     gate.NewMul(gate.NewAdd(mul, &gate.Input{Party: 2}), mul),
+	}
+}
+
+// runAll runs every party concurrently, and returns their results once they have all finished.
+func runAll(parties []*Party) ([][]*big.Int, []error) {
+	results := make([][]*big.Int, len(parties), len(parties))
+	errs := make([]error, len(parties), len(parties))
+	var wg sync.WaitGroup
+	for i, p := range parties {
+		wg.Add(1)
+		go func(i int, p *Party) {
+			defer wg.Done()
+			results[i], errs[i] = p.Run(context.Background())
+		}(i, p)
+	}
+	wg.Wait()
+	return results, errs
+}
+
+// secretsFor returns the secrets of each party for its inputs to c, where all has at least as many secrets for each
+// party. Parties without an input to c have no secrets.
+func secretsFor(c *circuit.Circuit, all [][]*big.Int) [][]*big.Int {
+	nInputs := c.NInputs()
+	res := make([][]*big.Int, c.NParties, c.NParties)
+	for i := range res {
+		res[i] = all[i][:nInputs[i]]
+	}
+	return res
+}
+
+func TestParty_ErrorCorrection(t *testing.T) {
+	fld := field.New(field.Int(1000003))
+	secrets := field.Ints(20, 40, 21, 31, 1, 71, 3)
+	c := &circuit.Circuit{
+		NParties: 7,
+		Root: gate.NewAdd(
+			gate.NewAdd(
+				gate.NewMul(
+					&gate.Input{Party: 0},
+					&gate.Input{Party: 1},
+				),
+				gate.NewMul(
+					&gate.Input{Party: 2},
+					&gate.Input{Party: 3},
+				),
+			), gate.NewMul(
+				&gate.Input{Party: 4},
+				gate.NewAdd(
+					&gate.Input{Party: 5},
+					&gate.Input{Party: 6},
+				),
+			),
+		),
+	}
+	want := field.Int(20*40 + 21*31 + 1*(71+3))
+	// With N = 7 and T = 2, up to (N-1-T)/2 = 2 faulty parties can be identified.
+	degree := 2
+	faulty := []int{1, 4}
+
+	// The output shares are sent for the implicit output gate, which follows the last gate in the circuit.
+	outputGateIdx := len(c.Traverse())
+	transports := make([]transport.Transport, c.NParties, c.NParties)
+	for i, t := range transport.NewChannels(c.NParties) {
+		transports[i] = t
+	}
+	for _, i := range faulty {
+		transports[i] = &corruptTransport{Transport: transports[i], gate: outputGateIdx}
+	}
+
+	parties := make([]*Party, c.NParties, c.NParties)
+	for i := range parties {
+		parties[i] = New(i, []*big.Int{secrets[i]}, c.Copy(), fld, degree, transports[i])
+		parties[i].EnableErrorCorrection()
+	}
+
+	results, errs := runAll(parties)
+
+	for i, p := range parties {
+		if errs[i] != nil {
+			t.Errorf("party %d: Run() failed with %v", i, errs[i])
+			continue
+		}
+		if results[i][0].Cmp(want) != 0 {
+			t.Errorf("party %d: Run() = %d, want [%d]", i, results[i], want)
+		}
+		if got := p.Faulty(); !reflect.DeepEqual(got, faulty) {
+			t.Errorf("party %d: Faulty() = %v, want %v", i, got, faulty)
+		}
+	}
+}
+
+func TestParty_TCP(t *testing.T) {
+	fld := field.New(field.Int(101))
+	secrets := field.Ints(20, 40, 21, 31, 1, 71)
+	c := textbook()
+	want := field.Int(7)
+
+	listeners := make([]net.Listener, c.NParties, c.NParties)
+	addrs := make([]string, c.NParties, c.NParties)
+	for i := range listeners {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("net.Listen() failed with %v", err)
+		}
+		listeners[i] = l
+		addrs[i] = l.Addr().String()
+	}
+
+	// Every party must be connecting at the same time, as they wait for each other.
+	parties := make([]*Party, c.NParties, c.NParties)
+	transports := make([]*transport.TCP, c.NParties, c.NParties)
+	var wg sync.WaitGroup
+	for i := range parties {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tr, err := transport.NewTCP(i, listeners[i], addrs)
+			if err != nil {
+				t.Errorf("party %d: transport.NewTCP() failed with %v", i, err)
+				return
+			}
+			transports[i] = tr
+			parties[i] = New(i, []*big.Int{secrets[i]}, c.Copy(), fld, 2, tr)
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	results, errs := runAll(parties)
+	for i := range parties {
+		if errs[i] != nil {
+			t.Errorf("party %d: Run() failed with %v", i, errs[i])
+		} else if results[i][0].Cmp(want) != 0 {
+			t.Errorf("party %d: Run() = %d, want [%d]", i, results[i], want)
+		}
+	}
+
+	for i, tr := range transports {
+		wg.Add(1)
+		go func(i int, tr *transport.TCP) {
+			defer wg.Done()
+			if err := tr.Close(); err != nil {
+				t.Errorf("party %d: Close() failed with %v", i, err)
+			}
+		}(i, tr)
+	}
+	wg.Wait()
+}
+
+func TestParty_Timeout(t *testing.T) {
+	fld := field.New(field.Int(101))
+	secrets := field.Ints(20, 40, 21, 31, 1, 71)
+	c := textbook()
+	// absent never runs, so every other party gets stuck waiting for its input.
+	absent := 3
+
+	// Every input is shared before any multiplication gate is evaluated, so parties get stuck waiting for the input of
+	// absent.
+	wantGate := -1
+	for i, g := range c.Traverse() {
+		if in, ok := g.(*gate.Input); ok && in.Party == absent {
+			wantGate = i
+			break
+		}
+	}
+
+	transports := transport.NewChannels(c.NParties)
+	var parties []*Party
+	for i := 0; i < c.NParties; i++ {
+		if i != absent {
+			parties = append(parties, New(i, []*big.Int{secrets[i]}, c.Copy(), fld, 2, transports[i]))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	results := make([][]*big.Int, len(parties), len(parties))
+	errs := make([]error, len(parties), len(parties))
+	var wg sync.WaitGroup
+	for i, p := range parties {
+		wg.Add(1)
+		go func(i int, p *Party) {
+			defer wg.Done()
+			results[i], errs[i] = p.Run(ctx)
+		}(i, p)
+	}
+	wg.Wait()
+
+	for i, p := range parties {
+		var missingErr *MissingSharesError
+		if !errors.As(errs[i], &missingErr) {
+			t.Errorf("party %d: Run() = %v, %v, want *MissingSharesError", p.id, results[i], errs[i])
+			continue
+		}
+		if !errors.Is(errs[i], context.DeadlineExceeded) {
+			t.Errorf("party %d: Run() failed with %v, want %v", p.id, errs[i], context.DeadlineExceeded)
+		}
+		if missingErr.Gate != wantGate || !reflect.DeepEqual(missingErr.Missing, []int{absent}) {
+			t.Errorf("party %d: Run() failed waiting for gate %d from parties %v, want gate %d from parties %v", p.id, missingErr.Gate, missingErr.Missing, wantGate, []int{absent})
+		}
+	}
+}
+
+func TestParty_Degrees(t *testing.T) {
+	fld := field.New(field.Int(101))
+	secrets := field.Ints(20, 40, 21, 31, 1, 71)
+
+	tests := []struct {
+		name    string
+		circuit *circuit.Circuit
+		degree  int
+		// prime is the prime of the field, or 0 to use 101.
+		prime   int
+		wantErr bool
+	}{{
+		name:    "Multiplication with 2T < N",
+		circuit: textbook(),
+		degree:  2,
+	}, {
+		name:    "Multiplication without 2T < N",
+		circuit: textbook(),
+		degree:  3,
+		wantErr: true,
+	}, {
+		// Without multiplication, the degree only needs to satisfy T < N.
+		name: "Addition with T < N",
+		circuit: &circuit.Circuit{
+			NParties: 6,
+			Root: gate.NewAdd(
+				gate.NewAdd(&gate.Input{Party: 0}, &gate.Input{Party: 1}),
+				gate.NewAdd(&gate.Input{Party: 4}, &gate.Input{Party: 5}),
+			),
+		},
+		degree: 5,
+	}, {
+		// The parties' points 1, ..., 6 are not distinct modulo 5.
+		name:    "Prime no larger than N",
+		circuit: textbook(),
+		degree:  2,
+		prime:   5,
+		wantErr: true,
+	}, {
+		// Random bits are generated using square roots, which needs an odd prime.
+		name:    "Random bit with an even prime",
+		circuit: &circuit.Circuit{NParties: 1, Root: gate.NewRandomBit()},
+		degree:  0,
+		prime:   2,
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fld := fld
+			if tc.prime != 0 {
+				fld = field.New(field.Int(tc.prime))
+			}
+			c := tc.circuit
+			transports := transport.NewChannels(c.NParties)
+			parties := make([]*Party, c.NParties, c.NParties)
+			for i := range parties {
+				// Some parties have no inputs to the circuit, so they must not have a secret.
+				mine := []*big.Int{secrets[i]}[:c.NInputs()[i]]
+				parties[i] = New(i, mine, c.Copy(), fld, tc.degree, transports[i])
+			}
+
+			_, errs := runAll(parties)
+			for i, err := range errs {
+				if gotErr := err != nil; gotErr != tc.wantErr {
+					t.Fatalf("party %d: Run() failed with %v, want error %t", i, err, tc.wantErr)
+				}
+			}
+			if tc.wantErr {
+				return
+			}
+
+			// The shares of every gate's output should lie on a polynomial of the tracked degree, which we check by
+			// interpolating the first degree+1 shares and evaluating the result at the remaining points.
+			degrees := parties[0].Degrees()
+			for gIdx, degree := range degrees {
+				xs := make([]*big.Int, c.NParties, c.NParties)
+				ys := make([]*big.Int, c.NParties, c.NParties)
+				for i, p := range parties {
+					if got := p.Degrees()[gIdx]; got != degree {
+						t.Errorf("party %d: Degrees()[%d] = %d, want %d", i, gIdx, got, degree)
+					}
+					xs[i] = point(i)
+					ys[i] = p.circuit.Traverse()[gIdx].Output()
+				}
+
+				po := poly.Interpolate(xs[:degree+1], ys[:degree+1], fld)
+				for i := degree + 1; i < c.NParties; i++ {
+					if got := po.Eval(xs[i]); got.Cmp(ys[i]) != 0 {
+						t.Errorf("gate %d: shares %v do not lie on a polynomial of degree %d", gIdx, ys, degree)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParty_Beaver(t *testing.T) {
+	fld := field.New(field.Int(101))
+	secrets := field.Ints(20, 40, 21, 31, 1, 71)
+	c := textbook()
+	want := field.Int(7)
+	// textbook has three multiplication gates.
+	nMuls := 3
+
+	tests := []struct {
+		name string
+		// dealt is the number of triples dealt to each party, or -1 if the parties generate them.
+		dealt   int
+		degree  int
+		wantErr bool
+	}{{
+		name:   "Dealer",
+		dealt:  nMuls,
+		degree: 2,
+	}, {
+		// With a dealer, multiplication only needs T < N.
+		name:   "Dealer without 2T < N",
+		dealt:  nMuls,
+		degree: 3,
+	}, {
+		name:    "Dealer with too few triples",
+		dealt:   nMuls - 1,
+		degree:  2,
+		wantErr: true,
+	}, {
+		name:   "Generated",
+		dealt:  -1,
+		degree: 2,
+	}, {
+		name:    "Generated without 2T < N",
+		dealt:   -1,
+		degree:  3,
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var triples [][]Triple
+			if tc.dealt >= 0 {
+				triples = DealTriples(tc.dealt, c.NParties, tc.degree, fld)
+			}
+
+			transports := transport.NewChannels(c.NParties)
+			parties := make([]*Party, c.NParties, c.NParties)
+			for i := range parties {
+				parties[i] = New(i, []*big.Int{secrets[i]}, c.Copy(), fld, tc.degree, transports[i])
+				var mine []Triple
+				if triples != nil {
+					mine = triples[i]
+				}
+				parties[i].UseBeaverTriples(mine)
+			}
+
+			results, errs := runAll(parties)
+			for i := range parties {
+				if gotErr := errs[i] != nil; gotErr != tc.wantErr {
+					t.Errorf("party %d: Run() failed with %v, want error %t", i, errs[i], tc.wantErr)
+				} else if !tc.wantErr && results[i][0].Cmp(want) != 0 {
+					t.Errorf("party %d: Run() = %d, want [%d]", i, results[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParty_TriplesNeeded(t *testing.T) {
+	// With a large prime, no gate is retried, so every triple dealt is used.
+	fld := field.New(field.Int(2147483647))
+	secrets := [][]*big.Int{field.Ints(20), field.Ints(40), field.Ints(21), field.Ints(31), field.Ints(1)}
+	x, y, z := &gate.Input{Party: 0}, &gate.Input{Party: 1}, &gate.Input{Party: 2}
+	c := &circuit.Circuit{
+		NParties: len(secrets),
+		Outputs: []circuit.Output{
+			{Name: "product", Gate: gate.NewMul(x, y)},
+			{Name: "quotient", Gate: gate.NewAdd(gate.NewDiv(x, y), gate.NewInv(z))},
+			{Name: "equal", Gate: gate.NewEqual(x, y)},
+			// The bits of x are only decomposed once.
+			{Name: "less", Gate: gate.NewLessThan(x, y)},
+			{Name: "bit", Gate: gate.NewBitDecompose(x, 2)},
+			{Name: "coin", Gate: gate.NewToArithmetic(gate.NewNot(gate.NewToBinary(gate.NewRandomBit())))},
+		},
+	}
+	want, err := c.ComputeExpected(secretsFor(c, secrets), fld)
+	if err != nil {
+		t.Fatalf("ComputeExpected() failed with %v", err)
+	}
+
+	n := TriplesNeeded(c, fld)
+	triples := DealTriples(n, c.NParties, 2, fld)
+	transports := transport.NewChannels(c.NParties)
+	parties := make([]*Party, c.NParties, c.NParties)
+	for i := range parties {
+		parties[i] = New(i, secretsFor(c, secrets)[i], c.Copy(), fld, 2, transports[i])
+		parties[i].UseBeaverTriples(triples[i])
+	}
+
+	results, errs := runAll(parties)
+	for i, p := range parties {
+		if errs[i] != nil {
+			t.Errorf("party %d: Run() failed with %v", i, errs[i])
+			continue
+		}
+		for k := range want {
+			if want[k] != nil && results[i][k].Cmp(want[k]) != 0 {
+				t.Errorf("party %d: Run() = %d, want %d", i, results[i], want)
+				break
+			}
+		}
+		if left := len(p.multiplier.(*beaver).triples); left != 0 {
+			t.Errorf("party %d: %d of the %d triples from TriplesNeeded() were not used", i, left, n)
+		}
+	}
+}
+
+func TestParty_Rounds(t *testing.T) {
+	fld := field.New(field.Int(1000003))
+
+	// product returns a balanced tree of multiplication gates over the inputs of parties [from, to).
+	var product func(from, to int) gate.Gate
+	product = func(from, to int) gate.Gate {
+		if to-from == 1 {
+			return &gate.Input{Party: from}
+		}
+		mid := (from + to) / 2
+		return gate.NewMul(product(from, mid), product(mid, to))
+	}
+
+	tests := []struct {
+		name    string
+		circuit *circuit.Circuit
+		// wantRounds is the number of rounds of communication for multiplication gates.
+		wantRounds int
+		// wantOtherRounds is the number of rounds of communication for gates which need several, such as inverses.
+		wantOtherRounds int
+	}{{
+		name:       "Textbook example",
+		circuit:    textbook(),
+		wantRounds: 1,
+	}, {
+		name:       "Balanced product",
+		circuit:    &circuit.Circuit{NParties: 8, Root: product(0, 8)},
+		wantRounds: 3,
+	}, {
+		name: "Chained product",
+		circuit: &circuit.Circuit{
+			NParties: 3,
+			Root:     gate.NewMul(gate.NewMul(&gate.Input{Party: 0}, &gate.Input{Party: 1}), &gate.Input{Party: 2}),
+		},
+		wantRounds: 2,
+	}, {
+		// The shared multiplication gate is only evaluated once.
+		name:       "Shared multiplication",
+		circuit:    shared(),
+		wantRounds: 2,
+	}, {
+		// Independent inverse and division gates share the rounds to mask, multiply and open their denominators.
+		name: "Independent divisions",
+		circuit: &circuit.Circuit{
+			NParties: 4,
+			Root: gate.NewAdd(gate.NewAdd(gate.NewInv(&gate.Input{Party: 0}), gate.NewDiv(&gate.Input{Party: 1}, &gate.Input{Party: 2})),
+				gate.NewInv(&gate.Input{Party: 3})),
+		},
+		wantOtherRounds: 3,
+	}, {
+		name: "Dependent divisions",
+		circuit: &circuit.Circuit{
+			NParties: 3,
+			Root:     gate.NewDiv(gate.NewInv(&gate.Input{Party: 0}), gate.NewAdd(&gate.Input{Party: 1}, &gate.Input{Party: 2})),
+		},
+		wantOtherRounds: 6,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.circuit
+			secrets := make([][]*big.Int, c.NParties, c.NParties)
+			for i := range secrets {
+				secrets[i] = field.Ints(i + 2)
+			}
+			expected, err := c.ComputeExpected(secrets, fld)
+			if err != nil {
+				t.Fatalf("ComputeExpected() failed with %v", err)
+			}
+			want := expected[0]
+
+			channels := transport.NewChannels(c.NParties)
+			recorders := make([]*recordingTransport, c.NParties, c.NParties)
+			parties := make([]*Party, c.NParties, c.NParties)
+			for i := range parties {
+				recorders[i] = &recordingTransport{Transport: channels[i], gates: make(map[int]bool)}
+				parties[i] = New(i, secrets[i], c.Copy(), fld, (c.NParties-1)/2, recorders[i])
+			}
+
+			results, errs := runAll(parties)
+			for i, p := range parties {
+				if errs[i] != nil {
+					t.Errorf("party %d: Run() failed with %v", i, errs[i])
+					continue
+				}
+				if results[i][0].Cmp(want) != 0 {
+					t.Errorf("party %d: Run() = %d, want [%d]", i, results[i], want)
+				}
+
+				// Every party sends messages for its inputs and the output, and for each round of multiplication.
+				gates := p.circuit.Traverse()
+				rounds, otherRounds := 0, 0
+				for g := range recorders[i].gates {
+					if g < len(gates) && gates[g].Type() == "MUL" {
+						rounds++
+					}
+					// The rounds after the output and the two rounds used to generate Beaver triples are used by gates
+					// which need several.
+					if g > len(gates)+2 {
+						otherRounds++
+					}
+				}
+				if rounds != tc.wantRounds {
+					t.Errorf("party %d: multiplied in %d rounds, want %d", i, rounds, tc.wantRounds)
+				}
+				if otherRounds != tc.wantOtherRounds {
+					t.Errorf("party %d: used %d other rounds, want %d", i, otherRounds, tc.wantOtherRounds)
+				}
+			}
+		})
+	}
+}
+
+func TestParty_MultipleOutputs(t *testing.T) {
+	fld := field.New(field.Int(1000003))
+	secrets := field.Ints(3, 1, 4, 1, 5, 9, 2)
+	nParties := len(secrets)
+
+	var sum, squares gate.Gate
+	for i := 0; i < nParties; i++ {
+		in := &gate.Input{Party: i}
+		if i == 0 {
+			sum, squares = in, gate.NewMul(in, in)
+			continue
+		}
+		sum = gate.NewAdd(sum, in)
+		squares = gate.NewAdd(squares, gate.NewMul(in, in))
+	}
+	c := &circuit.Circuit{
+		NParties: nParties,
+		Outputs: []circuit.Output{
+			{Name: "sum", Gate: sum},
+			{Name: "sum of squares", Gate: squares},
+			{Name: "square of sum", Gate: gate.NewMul(sum, sum)},
+		},
+	}
+	want := field.Ints(25, 137, 625)
+
+	for _, errorCorrection := range []bool{false, true} {
+		t.Run(fmt.Sprintf("errorCorrection=%t", errorCorrection), func(t *testing.T) {
+			// Corrupt output shares can only be tolerated with error correction.
+			var faulty []int
+			if errorCorrection {
+				faulty = []int{2}
+			}
+
+			transports := make([]transport.Transport, nParties, nParties)
+			for i, t := range transport.NewChannels(nParties) {
+				transports[i] = t
+			}
+			for _, i := range faulty {
+				transports[i] = &corruptTransport{Transport: transports[i], gate: len(c.Traverse())}
+			}
+
+			parties := make([]*Party, nParties, nParties)
+			for i := range parties {
+				parties[i] = New(i, []*big.Int{secrets[i]}, c.Copy(), fld, 2, transports[i])
+				if errorCorrection {
+					parties[i].EnableErrorCorrection()
+				}
+			}
+
+			results, errs := runAll(parties)
+			for i, p := range parties {
+				if errs[i] != nil {
+					t.Errorf("party %d: Run() failed with %v", i, errs[i])
+					continue
+				}
+				if fmt.Sprint(results[i]) != fmt.Sprint(want) {
+					t.Errorf("party %d: Run() = %d, want %d", i, results[i], want)
+				}
+				if got := p.Faulty(); !reflect.DeepEqual(got, faulty) {
+					t.Errorf("party %d: Faulty() = %v, want %v", i, got, faulty)
+				}
+			}
+		})
+	}
+}
+
+func TestParty_PrivateOutputs(t *testing.T) {
+	fld := field.New(field.Int(1000003))
+	secrets := field.Ints(3, 10, 20, 30, 40)
+	nParties := len(secrets)
+
+	var total gate.Gate = &gate.Input{Party: 1}
+	for i := 2; i < nParties; i++ {
+		total = gate.NewAdd(total, &gate.Input{Party: i})
+	}
+	c := &circuit.Circuit{
+		NParties: nParties,
+		Outputs: []circuit.Output{
+			{Name: "score", Gate: gate.NewMul(&gate.Input{Party: 0}, total), Recipients: []int{0}},
+			{Name: "total", Gate: total, Recipients: []int{1, 3}},
+			{Name: "public", Gate: &gate.Input{Party: 4}},
+		},
+	}
+	want := field.Ints(300, 100, 40)
+	// Output shares are sent for the round following the last gate.
+	outputIdx := len(c.Traverse())
+
+	for _, errorCorrection := range []bool{false, true} {
+		t.Run(fmt.Sprintf("errorCorrection=%t", errorCorrection), func(t *testing.T) {
+			transports := transport.NewChannels(nParties)
+			parties := make([]*Party, nParties, nParties)
+			for i := range parties {
+				parties[i] = New(i, []*big.Int{secrets[i]}, c.Copy(), fld, 2, transports[i])
+				if errorCorrection {
+					parties[i].EnableErrorCorrection()
+				}
+			}
+
+			results, errs := runAll(parties)
+			for i, p := range parties {
+				if errs[i] != nil {
+					t.Errorf("party %d: Run() failed with %v", i, errs[i])
+					continue
+				}
+
+				// nReceived is the number of outputs that party i receives.
+				nReceived := 0
+				for k, out := range c.Outputs {
+					var wantOutput *big.Int
+					if out.ReceivedBy(i) {
+						wantOutput = want[k]
+						nReceived++
+					}
+					if got := results[i][k]; fmt.Sprint(got) != fmt.Sprint(wantOutput) {
+						t.Errorf("party %d: Run()[%d] = %v, want %v", i, k, got, wantOutput)
+					}
+				}
+
+				// Parties should only have received shares of the outputs that they receive.
+				for sender := range parties {
+					if got := len(p.shares[sender][outputIdx]); got != 0 && got != nReceived {
+						t.Errorf("party %d received %d output shares from party %d, want %d", i, got, sender, nReceived)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParty_InputErrors(t *testing.T) {
+	fld := field.New(field.Int(101))
+	tests := []struct {
+		name    string
+		root    gate.Gate
+		secrets [][]*big.Int
+	}{{
+		name:    "Input of a party which does not exist",
+		root:    gate.NewAdd(&gate.Input{Party: 0}, &gate.Input{Party: 3}),
+		secrets: [][]*big.Int{field.Ints(1), {}, {}},
+	}, {
+		name:    "Input with a negative index",
+		root:    gate.NewAdd(&gate.Input{Party: 0}, &gate.Input{Party: 1, Index: -1}),
+		secrets: [][]*big.Int{field.Ints(1), {}, {}},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &circuit.Circuit{NParties: len(tc.secrets), Root: tc.root}
+			transports := transport.NewChannels(c.NParties)
+			parties := make([]*Party, c.NParties, c.NParties)
+			for i := range parties {
+				parties[i] = New(i, tc.secrets[i], c.Copy(), fld, 1, transports[i])
+			}
+
+			// Every party should return an error before communicating, rather than panicking.
+			_, errs := runAll(parties)
+			for i := range parties {
+				if errs[i] == nil {
+					t.Errorf("party %d: Run() succeeded, want error", i)
+				}
+			}
+		})
+	}
+}
+
+func TestParty_Constants(t *testing.T) {
+	fld := field.New(field.Int(101))
+	secrets := [][]*big.Int{field.Ints(20), field.Ints(40), field.Ints(21)}
+	nParties := len(secrets)
+
+	x, y, z := &gate.Input{Party: 0}, &gate.Input{Party: 1}, &gate.Input{Party: 2}
+	c := &circuit.Circuit{
+		NParties: nParties,
+		Outputs: []circuit.Output{
+			// 3 * (x + y) + 7 is evaluated without any communication.
+			{Name: "affine", Gate: gate.NewAddConst(gate.NewMulConst(gate.NewAdd(x, y), field.Int(3)), field.Int(7))},
+			// z - 100 + 5 * 2 wraps around the prime.
+			{Name: "negative", Gate: gate.NewAdd(gate.NewAddConst(z, field.Int(-100)), gate.NewMul(gate.NewConst(field.Int(5)), gate.NewConst(field.Int(2))))},
+			{Name: "constant", Gate: gate.NewConst(field.Int(1234))},
+		},
+	}
+	want := field.Ints((3*(20+40)+7)%101, (21-100+10+101)%101, 1234%101)
+
+	if expected, err := c.ComputeExpected(secrets, fld); err != nil || fmt.Sprint(expected) != fmt.Sprint(want) {
+		t.Fatalf("ComputeExpected(%v) = %d, %v, want %d", secrets, expected, err, want)
+	}
+
+	channels := transport.NewChannels(nParties)
+	recorders := make([]*recordingTransport, nParties, nParties)
+	parties := make([]*Party, nParties, nParties)
+	for i := range parties {
+		recorders[i] = &recordingTransport{Transport: channels[i], gates: make(map[int]bool)}
+		parties[i] = New(i, secrets[i], c.Copy(), fld, 1, recorders[i])
+	}
+
+	results, errs := runAll(parties)
+	for i, p := range parties {
+		if errs[i] != nil {
+			t.Errorf("party %d: Run() failed with %v", i, errs[i])
+			continue
+		}
+		if fmt.Sprint(results[i]) != fmt.Sprint(want) {
+			t.Errorf("party %d: Run() = %d, want %d", i, results[i], want)
+		}
+
+		// The only communication should be for inputs, the multiplication of the two constants and the outputs.
+		gates := p.circuit.Traverse()
+		for g := range recorders[i].gates {
+			if g < len(gates) && gates[g].Type() != "MUL" {
+				if _, ok := gates[g].(*gate.Input); !ok {
+					t.Errorf("party %d sent shares for gate %d (%s)", i, g, gates[g].Type())
+				}
+			}
+		}
+	}
+}
+
+func TestParty_SubNeg(t *testing.T) {
+	fld := field.New(field.Int(101))
+	secrets := [][]*big.Int{field.Ints(20), field.Ints(40), field.Ints(0), field.Ints(100)}
+	x, y, zero, largest := &gate.Input{Party: 0}, &gate.Input{Party: 1}, &gate.Input{Party: 2}, &gate.Input{Party: 3}
+
+	tests := []struct {
+		name string
+		root gate.Gate
+		want *big.Int
+	}{{
+		name: "Difference",
+		root: gate.NewSub(y, x),
+		want: field.Int(20),
+	}, {
+		// 20 - 40 = -20, which wraps around to 81.
+		name: "Negative difference",
+		root: gate.NewSub(x, y),
+		want: field.Int(81),
+	}, {
+		name: "Negation",
+		root: gate.NewNeg(x),
+		want: field.Int(81),
+	}, {
+		// -0 is 0, rather than the prime.
+		name: "Negation of zero",
+		root: gate.NewNeg(zero),
+		want: field.Int(0),
+	}, {
+		// 0 - 100 = -100, which wraps around to 1.
+		name: "Subtraction of the largest element",
+		root: gate.NewSub(zero, largest),
+		want: field.Int(1),
+	}, {
+		// -(20 - 40) * (0 - 100) = 20 * -100 = -2000, which wraps around to 20.
+		name: "Product of differences",
+		root: gate.NewMul(gate.NewNeg(gate.NewSub(x, y)), gate.NewSub(zero, largest)),
+		want: field.Int(20),
+	}, {
+		name: "Double negation",
+		root: gate.NewNeg(gate.NewNeg(largest)),
+		want: field.Int(100),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &circuit.Circuit{NParties: len(secrets), Root: tc.root}
+			inputs := secretsFor(c, secrets)
+
+			if got, err := c.ComputeExpected(secrets, fld); err != nil || got[0].Cmp(tc.want) != 0 {
+				t.Errorf("ComputeExpected() = %d, %v, want [%d]", got, err, tc.want)
+			}
+
+			transports := transport.NewChannels(c.NParties)
+			parties := make([]*Party, c.NParties, c.NParties)
+			for i := range parties {
+				parties[i] = New(i, inputs[i], c.Copy(), fld, 1, transports[i])
+			}
+
+			results, errs := runAll(parties)
+			for i := range parties {
+				if errs[i] != nil {
+					t.Errorf("party %d: Run() failed with %v", i, errs[i])
+				} else if results[i][0].Cmp(tc.want) != 0 {
+					t.Errorf("party %d: Run() = %d, want [%d]", i, results[i], tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParty_Div(t *testing.T) {
+	fld := field.New(field.Int(101))
+	secrets := [][]*big.Int{field.Ints(20), field.Ints(40), field.Ints(0), field.Ints(7), field.Ints(3)}
+	x, y, zero, a, b := &gate.Input{Party: 0}, &gate.Input{Party: 1}, &gate.Input{Party: 2}, &gate.Input{Party: 3}, &gate.Input{Party: 4}
+
+	tests := []struct {
+		name string
+		root gate.Gate
+		want *big.Int
+		// wantErr is whether every party should fail because the circuit divides by zero.
+		wantErr bool
+	}{{
+		// 20 * 96 = 1920 = 19 * 101 + 1.
+		name: "Inverse",
+		root: gate.NewInv(x),
+		want: field.Int(96),
+	}, {
+		name: "Division",
+		root: gate.NewDiv(y, x),
+		want: field.Int(2),
+	}, {
+		// 20 / 40 is the inverse of 2, which is 51.
+		name: "Division without an integer result",
+		root: gate.NewDiv(x, y),
+		want: field.Int(51),
+	}, {
+		name: "Division of products",
+		root: gate.NewDiv(gate.NewMul(x, a), gate.NewMul(a, b)),
+		want: fld.Div(field.Int(20), field.Int(3)),
+	}, {
+		// (20 + 40 + 3) / 3 = 21.
+		name: "Average",
+		root: gate.NewDiv(gate.NewAdd(gate.NewAdd(x, y), b), gate.NewConst(field.Int(3))),
+		want: field.Int(21),
+	}, {
+		// (7^-1)^-1 * 3 = 21.
+		name: "Inverse of inverse",
+		root: gate.NewMul(gate.NewInv(gate.NewInv(a)), b),
+		want: field.Int(21),
+	}, {
+		name: "Zero dividend",
+		root: gate.NewDiv(zero, x),
+		want: field.Int(0),
+	}, {
+		name:    "Inverse of zero",
+		root:    gate.NewInv(zero),
+		wantErr: true,
+	}, {
+		name:    "Division by zero",
+		root:    gate.NewDiv(x, gate.NewSub(a, a)),
+		wantErr: true,
+	}}
+
+	for _, beaver := range []bool{false, true} {
+		for _, tc := range tests {
+			t.Run(fmt.Sprintf("%s/beaver=%t", tc.name, beaver), func(t *testing.T) {
+				c := &circuit.Circuit{NParties: len(secrets), Root: tc.root}
+				inputs := secretsFor(c, secrets)
+
+				got, err := c.ComputeExpected(secrets, fld)
+				if tc.wantErr {
+					if !errors.Is(err, circuit.ErrDivisionByZero) {
+						t.Errorf("ComputeExpected() = %d, %v, want %v", got, err, circuit.ErrDivisionByZero)
+					}
+				} else if err != nil || got[0].Cmp(tc.want) != 0 {
+					t.Errorf("ComputeExpected() = %d, %v, want [%d]", got, err, tc.want)
+				}
+
+				transports := transport.NewChannels(c.NParties)
+				parties := make([]*Party, c.NParties, c.NParties)
+				for i := range parties {
+					parties[i] = New(i, inputs[i], c.Copy(), fld, 2, transports[i])
+					if beaver {
+						parties[i].UseBeaverTriples(nil)
+					}
+				}
+
+				results, errs := runAll(parties)
+				for i := range parties {
+					switch {
+					case tc.wantErr:
+						if !errors.Is(errs[i], circuit.ErrDivisionByZero) {
+							t.Errorf("party %d: Run() = %d, %v, want %v", i, results[i], errs[i], circuit.ErrDivisionByZero)
+						}
+					case errs[i] != nil:
+						t.Errorf("party %d: Run() failed with %v", i, errs[i])
+					case results[i][0].Cmp(tc.want) != 0:
+						t.Errorf("party %d: Run() = %d, want [%d]", i, results[i], tc.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParty_Random(t *testing.T) {
+	const (
+		nParties = 3
+		// Each run has nOutputs random outputs, so there are nRuns * nOutputs samples in total.
+		nRuns    = 20
+		nOutputs = 25
+		nSamples = nRuns * nOutputs
+	)
+
+	tests := []struct {
+		name    string
+		newGate func() gate.Gate
+		// nValues is the number of values that the gate can take, or 0 if it can take any value in the field.
+		nValues int
+	}{{
+		name:    "Random",
+		newGate: gate.NewRandom,
+	}, {
+		name:    "Random bit",
+		newGate: gate.NewRandomBit,
+		nValues: 2,
+	}}
+
+	// Every prime is larger than the number of parties, so each party has a distinct non-zero point.
+	for _, prime := range []int{5, 7, 11} {
+		for _, tc := range tests {
+			t.Run(fmt.Sprintf("%s/p=%d", tc.name, prime), func(t *testing.T) {
+				fld := field.New(field.Int(prime))
+				nValues := tc.nValues
+				if nValues == 0 {
+					nValues = prime
+				}
+
+				outputs := make([]circuit.Output, nOutputs, nOutputs)
+				for k := range outputs {
+					outputs[k] = circuit.Output{Name: fmt.Sprint(k), Gate: tc.newGate()}
+				}
+				c := &circuit.Circuit{NParties: nParties, Outputs: outputs}
+
+				if got, err := c.ComputeExpected(make([][]*big.Int, nParties, nParties), fld); err != nil || got[0] != nil {
+					t.Errorf("ComputeExpected() = %d, %v, want nil outputs", got, err)
+				}
+
+				counts := make([]int, nValues, nValues)
+				for run := 0; run < nRuns; run++ {
+					transports := transport.NewChannels(nParties)
+					parties := make([]*Party, nParties, nParties)
+					for i := range parties {
+						parties[i] = New(i, nil, c.Copy(), fld, 1, transports[i])
+					}
+
+					results, errs := runAll(parties)
+					for i := range parties {
+						if errs[i] != nil {
+							t.Fatalf("party %d: Run() failed with %v", i, errs[i])
+						}
+						if fmt.Sprint(results[i]) != fmt.Sprint(results[0]) {
+							t.Fatalf("party %d: Run() = %d, but party 0 returned %d", i, results[i], results[0])
+						}
+					}
+					for _, v := range results[0] {
+						if v.Sign() < 0 || v.Cmp(field.Int(nValues)) >= 0 {
+							t.Fatalf("Run() returned %d, want a value in [0, %d)", v, nValues)
+						}
+						counts[v.Int64()]++
+					}
+				}
+
+				// Each count is binomially distributed, and is very unlikely to be more than 6 standard deviations from
+				// its mean if the values are uniform.
+				mean := float64(nSamples) / float64(nValues)
+				stddev := math.Sqrt(mean * (1 - 1/float64(nValues)))
+				for v, count := range counts {
+					if math.Abs(float64(count)-mean) > 6*stddev {
+						t.Errorf("%d occurred %d times in %d samples, want %.0f ± %.0f", v, count, nSamples, mean, 6*stddev)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParty_Compare(t *testing.T) {
+	fld := field.New(field.Int(101))
+	secrets := [][]*big.Int{field.Ints(20), field.Ints(40), field.Ints(20), field.Ints(100), field.Ints(0)}
+	x, y, z, largest, zero := &gate.Input{Party: 0}, &gate.Input{Party: 1}, &gate.Input{Party: 2}, &gate.Input{Party: 3}, &gate.Input{Party: 4}
+
+	// bits reconstructs y from its 7 bits, which are all decomposed at once.
+	var bits gate.Gate = gate.NewBitDecompose(y, 0)
+	for i := 1; i < 7; i++ {
+		bits = gate.NewAdd(bits, gate.NewMulConst(gate.NewBitDecompose(y, i), field.Int(1<<i)))
+	}
+
+	tests := []struct {
+		name string
+		root gate.Gate
+		want *big.Int
+	}{{
+		name: "Equal",
+		root: gate.NewEqual(x, z),
+		want: field.Int(1),
+	}, {
+		name: "Not equal",
+		root: gate.NewEqual(x, y),
+		want: field.Int(0),
+	}, {
+		name: "Equal to zero",
+		root: gate.NewEqual(zero, gate.NewConst(field.Int(0))),
+		want: field.Int(1),
+	}, {
+		name: "Less than",
+		root: gate.NewLessThan(x, y),
+		want: field.Int(1),
+	}, {
+		name: "Greater than",
+		root: gate.NewLessThan(y, x),
+		want: field.Int(0),
+	}, {
+		name: "Less than itself",
+		root: gate.NewLessThan(x, z),
+		want: field.Int(0),
+	}, {
+		name: "Largest element",
+		root: gate.NewLessThan(zero, largest),
+		want: field.Int(1),
+	}, {
+		// 20 - 40 wraps around to 81, which is not less than 40.
+		name: "Negative difference",
+		root: gate.NewLessThan(gate.NewSub(x, y), y),
+		want: field.Int(0),
+	}, {
+		// max(x, y) = x + (x < y) * (y - x).
+		name: "Maximum",
+		root: gate.NewAdd(x, gate.NewMul(gate.NewLessThan(x, y), gate.NewSub(y, x))),
+		want: field.Int(40),
+	}, {
+		// 40 = 0b0101000.
+		name: "Bit",
+		root: gate.NewBitDecompose(y, 3),
+		want: field.Int(1),
+	}, {
+		name: "Bits",
+		root: bits,
+		want: field.Int(40),
+	}, {
+		// 100 = 0b1100100 has 7 bits, and the field has no larger elements.
+		name: "Bit beyond the bit length",
+		root: gate.NewBitDecompose(largest, 7),
+		want: field.Int(0),
+	}}
+
+	for _, beaver := range []bool{false, true} {
+		for _, tc := range tests {
+			t.Run(fmt.Sprintf("%s/beaver=%t", tc.name, beaver), func(t *testing.T) {
+				c := &circuit.Circuit{NParties: len(secrets), Root: tc.root}
+				inputs := secretsFor(c, secrets)
+
+				if got, err := c.ComputeExpected(secrets, fld); err != nil || got[0].Cmp(tc.want) != 0 {
+					t.Errorf("ComputeExpected() = %d, %v, want [%d]", got, err, tc.want)
+				}
+
+				transports := transport.NewChannels(c.NParties)
+				parties := make([]*Party, c.NParties, c.NParties)
+				for i := range parties {
+					parties[i] = New(i, inputs[i], c.Copy(), fld, 2, transports[i])
+					if beaver {
+						parties[i].UseBeaverTriples(nil)
+					}
+				}
+
+				results, errs := runAll(parties)
+				for i := range parties {
+					if errs[i] != nil {
+						t.Errorf("party %d: Run() failed with %v", i, errs[i])
+					} else if results[i][0].Cmp(tc.want) != 0 {
+						t.Errorf("party %d: Run() = %d, want [%d]", i, results[i], tc.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParty_CompareRounds(t *testing.T) {
+	// Random values are almost never rejected with Mersenne primes, so no gate is retried.
+	primes := []string{"0x7fffffff", "0x1fffffffffffffff"}
+	x, y := &gate.Input{Party: 0}, &gate.Input{Party: 1}
+	secrets := [][]*big.Int{field.Ints(1234), field.Ints(5678), nil}
+	c := &circuit.Circuit{
+		NParties: 3,
+		Outputs: []circuit.Output{
+			{Name: "less", Gate: gate.NewLessThan(x, y)},
+			{Name: "equal", Gate: gate.NewEqual(x, y)},
+			{Name: "bit", Gate: gate.NewBitDecompose(y, 1)},
+		},
+	}
+	want := field.Ints(1, 0, 1)
+
+	// The number of rounds of communication does not depend on the bit length of the prime.
+	var wantRounds int
+	for k, prime := range primes {
+		fld, err := field.Parse(prime)
+		if err != nil {
+			t.Fatalf("field.Parse(%q) failed with %v", prime, err)
+		}
+		channels := transport.NewChannels(c.NParties)
+		recorders := make([]*recordingTransport, c.NParties, c.NParties)
+		parties := make([]*Party, c.NParties, c.NParties)
+		for i := range parties {
+			recorders[i] = &recordingTransport{Transport: channels[i], gates: make(map[int]bool)}
+			parties[i] = New(i, secrets[i], c.Copy(), fld, 1, recorders[i])
+		}
+
+		results, errs := runAll(parties)
+		for i := range parties {
+			if errs[i] != nil {
+				t.Fatalf("prime=%s: party %d: Run() failed with %v", prime, i, errs[i])
+			}
+			if fmt.Sprint(results[i]) != fmt.Sprint(want) {
+				t.Errorf("prime=%s: party %d: Run() = %d, want %d", prime, i, results[i], want)
+			}
+		}
+		rounds := len(recorders[0].gates)
+		if k == 0 {
+			wantRounds = rounds
+		} else if rounds != wantRounds {
+			t.Errorf("prime=%s: compared in %d rounds, want %d as with prime=%s", prime, rounds, wantRounds, primes[0])
+		}
+	}
+}
+
+func TestParty_Boolean(t *testing.T) {
+	fld := field.New(field.Int(101))
+	secrets := [][]*big.Int{field.Ints(1), field.Ints(0), field.Ints(1), field.Ints(20), field.Ints(0)}
+	a, b, c := gate.NewToBinary(&gate.Input{Party: 0}), gate.NewToBinary(&gate.Input{Party: 1}), gate.NewToBinary(&gate.Input{Party: 2})
+
+	tests := []struct {
+		name string
+		root gate.Gate
+		want *big.Int
+	}{{
+		name: "Xor",
+		root: gate.NewXor(a, b),
+		want: field.Int(1),
+	}, {
+		name: "Xor with itself",
+		root: gate.NewXor(a, c),
+		want: field.Int(0),
+	}, {
+		name: "And",
+		root: gate.NewAnd(a, c),
+		want: field.Int(1),
+	}, {
+		name: "And with zero",
+		root: gate.NewAnd(a, b),
+		want: field.Int(0),
+	}, {
+		name: "Not",
+		root: gate.NewNot(b),
+		want: field.Int(1),
+	}, {
+		// a OR b = NOT (NOT a AND NOT b).
+		name: "Or",
+		root: gate.NewNot(gate.NewAnd(gate.NewNot(a), gate.NewNot(b))),
+		want: field.Int(1),
+	}, {
+		name: "Round trip",
+		root: gate.NewToArithmetic(a),
+		want: field.Int(1),
+	}, {
+		// The prime field counts the bits that are set.
+		name: "Mixed",
+		root: gate.NewAdd(
+			gate.NewToArithmetic(gate.NewAnd(a, c)),
+			gate.NewMulConst(gate.NewToArithmetic(gate.NewNot(b)), field.Int(10)),
+		),
+		want: field.Int(11),
+	}}
+
+	for _, beaver := range []bool{false, true} {
+		for _, tc := range tests {
+			t.Run(fmt.Sprintf("%s/beaver=%t", tc.name, beaver), func(t *testing.T) {
+				c := &circuit.Circuit{NParties: len(secrets), Root: tc.root}
+				inputs := secretsFor(c, secrets)
+
+				if got, err := c.ComputeExpected(secrets, fld); err != nil || got[0].Cmp(tc.want) != 0 {
+					t.Errorf("ComputeExpected() = %d, %v, want [%d]", got, err, tc.want)
+				}
+
+				transports := transport.NewChannels(c.NParties)
+				parties := make([]*Party, c.NParties, c.NParties)
+				for i := range parties {
+					parties[i] = New(i, inputs[i], c.Copy(), fld, 2, transports[i])
+					if beaver {
+						parties[i].UseBeaverTriples(nil)
+					}
+				}
+
+				results, errs := runAll(parties)
+				for i := range parties {
+					if errs[i] != nil {
+						t.Errorf("party %d: Run() failed with %v", i, errs[i])
+					} else if results[i][0].Cmp(tc.want) != 0 {
+						t.Errorf("party %d: Run() = %d, want [%d]", i, results[i], tc.want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParty_BooleanErrors(t *testing.T) {
+	// The prime is large enough that no random value has to be generated again.
+	fld := field.New(field.Int(1000003))
+	secrets := [][]*big.Int{field.Ints(1), field.Ints(20), field.Ints(0)}
+	x, y := &gate.Input{Party: 0}, &gate.Input{Party: 1}
+
+	tests := []struct {
+		name   string
+		root   gate.Gate
+		binary field.Binary
+		// wantErr is a substring of the error which every party should fail with.
+		wantErr string
+		// wantRounds is the number of rounds of communication after the inputs are shared, if it is not zero.
+		wantRounds int
+	}{{
+		name:    "Prime input to a boolean gate",
+		root:    gate.NewXor(gate.NewToBinary(x), y),
+		binary:  field.GF256(),
+		wantErr: "must be converted using ToBinary",
+	}, {
+		name:    "Binary input to an arithmetic gate",
+		root:    gate.NewAdd(gate.NewToBinary(x), y),
+		binary:  field.GF256(),
+		wantErr: "must be converted using ToArithmetic",
+	}, {
+		// The input is checked before the masked input is opened, so nothing else about it is revealed. Generating
+		// the random bit takes 3 rounds, generating the random non-zero value takes 3, and checking the input takes
+		// 3, so there is no round to open the masked input.
+		name:       "Converting a value which is not a bit",
+		root:       gate.NewToBinary(y),
+		binary:     field.GF256(),
+		wantErr:    "input is not a bit",
+		wantRounds: 9,
+	}, {
+		// GF(2) has no point for each of the parties.
+		name:    "Binary field too small",
+		root:    gate.NewToBinary(x),
+		binary:  field.NewBinary(field.Int(0b11)),
+		wantErr: "binary field with 2 elements is too small",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &circuit.Circuit{NParties: len(secrets), Root: tc.root}
+			inputs := secretsFor(c, secrets)
+
+			channels := transport.NewChannels(c.NParties)
+			recorders := make([]*recordingTransport, c.NParties, c.NParties)
+			parties := make([]*Party, c.NParties, c.NParties)
+			for i := range parties {
+				recorders[i] = &recordingTransport{Transport: channels[i], gates: make(map[int]bool)}
+				parties[i] = New(i, inputs[i], c.Copy(), fld, 1, recorders[i])
+				parties[i].UseBinaryField(tc.binary)
+			}
+
+			_, errs := runAll(parties)
+			for i := range parties {
+				if errs[i] == nil || !strings.Contains(errs[i].Error(), tc.wantErr) {
+					t.Errorf("party %d: Run() failed with %v, want error containing %q", i, errs[i], tc.wantErr)
+				}
+				if tc.wantRounds == 0 {
+					continue
+				}
+				// Rounds after the output and the two rounds used to generate Beaver triples follow the inputs.
+				rounds := 0
+				for g := range recorders[i].gates {
+					if g > len(c.Traverse())+2 {
+						rounds++
+					}
+				}
+				if rounds != tc.wantRounds {
+					t.Errorf("party %d: communicated in %d rounds, want %d", i, rounds, tc.wantRounds)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package party
+
+import (
+	"context"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/poly"
+	"math/big"
+)
+
+// This file implements the constant-round protocols of Damgård, Fitzi, Kiltz, Nielsen and Toft, which are used to
+// compare and add shared bits. See https://link.springer.com/chapter/10.1007/11681878_15.
+
+// mask is this party's shares of the random values which hide one element of a prefix product. For the ith element,
+// inv is a share of 1/r_i, and w is a share of r_i/r_{i-1}, or of r_0 for the first element, where every r_i is a
+// uniformly random non-zero value.
+type mask struct {
+	w, inv *big.Int
+}
+
+// prefixMasks returns this party's shares of the masks for prefix products of vectors with the specified sizes. They
+// do not depend on the values which are multiplied, so the masks for every vector are generated in the same four
+// rounds of communication, and the r_i which are zero are generated again. This is the protocol of Bar-Ilan and
+// Beaver: the parties generate random values r_i and s_i, and open r_i s_i, which reveals nothing about r_i as long as
+// it is non-zero, in which case s_i/(r_i s_i) is a share of 1/r_i.
+// See https://dl.acm.org/doi/10.1145/72981.72995.
+func (p *Party) prefixMasks(ctx context.Context, sizes []int) ([][]mask, error) {
+	total := 0
+	for _, n := range sizes {
+		total += n
+	}
+	rs := make([]*big.Int, total, total)
+	invs := make([]*big.Int, total, total)
+	// pending are the indexes of the values of r which have not been generated yet.
+	pending := make([]int, total, total)
+	for k := range pending {
+		pending[k] = k
+	}
+	// Up to 2/p of the values are zero each time, so they are attempted as many times as random values less than p.
+	for attempt := 0; attempt < 4*maxAttempts && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			// The retried values need triples which were not counted by TriplesNeeded.
+			if err := p.multiplier.preprocess(ctx, len(pending)); err != nil {
+				return nil, err
+			}
+		}
+		n := len(pending)
+		random, err := p.randomShares(ctx, p.nextRound(), 2*n)
+		if err != nil {
+			return nil, err
+		}
+		products, err := p.multiplier.mul(ctx, p.nextRound(), random[:n], random[n:])
+		if err != nil {
+			return nil, err
+		}
+		opened, err := p.open(ctx, p.nextRound(), p.field, products)
+		if err != nil {
+			return nil, err
+		}
+
+		var retry []int
+		for k, i := range pending {
+			if opened[k].Sign() == 0 {
+				retry = append(retry, i)
+				continue
+			}
+			rs[i] = random[k]
+			invs[i] = p.field.Div(random[n+k], opened[k])
+		}
+		pending = retry
+	}
+	if len(pending) > 0 {
+		return nil, fmt.Errorf("random value was zero in %d attempts", 4*maxAttempts)
+	}
+
+	// w_i = r_i/r_{i-1} is computed for every element but the first of each vector in a single round.
+	var fsts, snds []*big.Int
+	offset := 0
+	for _, n := range sizes {
+		for i := 1; i < n; i++ {
+			fsts = append(fsts, rs[offset+i])
+			snds = append(snds, invs[offset+i-1])
+		}
+		offset += n
+	}
+	var ws []*big.Int
+	if len(fsts) > 0 {
+		var err error
+		if ws, err = p.multiplier.mul(ctx, p.nextRound(), fsts, snds); err != nil {
+			return nil, err
+		}
+	}
+
+	masks := make([][]mask, len(sizes), len(sizes))
+	offset = 0
+	for v, n := range sizes {
+		masks[v] = make([]mask, n, n)
+		for i := range masks[v] {
+			if i == 0 {
+				masks[v][i] = mask{w: rs[offset], inv: invs[offset]}
+			} else {
+				masks[v][i] = mask{w: ws[0], inv: invs[offset+i]}
+				ws = ws[1:]
+			}
+		}
+		offset += n
+	}
+	return masks, nil
+}
+
+// prefixMasksTriples returns the number of multiplications used by prefixMasks for a vector of n elements, if no
+// random value has to be generated again.
+func prefixMasksTriples(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return 2*n - 1
+}
+
+// preMul returns this party's shares of the prefix products of each vector in vecs, whose elements must be non-zero,
+// where masks are from prefixMasks. Every product is computed in two rounds of communication, regardless of the length
+// of the vectors. The parties open m_i = w_i a_i, which is uniformly random since r_i is, and m_0 m_1 ... m_i is
+// r_i a_0 a_1 ... a_i, so multiplying it by the shares of 1/r_i gives shares of the product.
+func (p *Party) preMul(ctx context.Context, vecs [][]*big.Int, masks [][]mask) ([][]*big.Int, error) {
+	var ws, as []*big.Int
+	for v, vec := range vecs {
+		for i, a := range vec {
+			ws = append(ws, masks[v][i].w)
+			as = append(as, a)
+		}
+	}
+	if len(as) == 0 {
+		return make([][]*big.Int, len(vecs), len(vecs)), nil
+	}
+	products, err := p.multiplier.mul(ctx, p.nextRound(), ws, as)
+	if err != nil {
+		return nil, err
+	}
+	opened, err := p.open(ctx, p.nextRound(), p.field, products)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([][]*big.Int, len(vecs), len(vecs))
+	for v, vec := range vecs {
+		res[v] = make([]*big.Int, len(vec), len(vec))
+		prefix := big.NewInt(1)
+		for i := range vec {
+			prefix = p.field.Mul(prefix, opened[0])
+			opened = opened[1:]
+			res[v][i] = p.field.Mul(prefix, masks[v][i].inv)
+		}
+	}
+	return res, nil
+}
+
+// ors returns this party's shares of the OR of each group of shared bits, where masks are from prefixMasks with the
+// sizes returned by orMaskSizes. This is unbounded fan-in OR, which takes the two rounds of communication of preMul,
+// however large the groups are. For a group of m bits, y = 1 + sum of the bits is in [1, m+1], and the OR is f(y),
+// where f is the polynomial of degree m with f(1) = 0 and f(y) = 1 otherwise. This is evaluated using the shares of
+// y, y^2, ..., y^m, which are the prefix products of m copies of y. The prime must be larger than m+1, so that y is
+// non-zero, which is checked by checkCompare.
+func (p *Party) ors(ctx context.Context, groups [][]*big.Int, masks [][]mask) ([]*big.Int, error) {
+	vecs := make([][]*big.Int, len(groups), len(groups))
+	for g, bits := range groups {
+		if len(bits) < 2 {
+			continue
+		}
+		y := p.field.Add(big.NewInt(1), p.field.Summation(bits))
+		vecs[g] = make([]*big.Int, len(bits), len(bits))
+		for i := range vecs[g] {
+			vecs[g][i] = y
+		}
+	}
+	powers, err := p.preMul(ctx, vecs, masks)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*big.Int, len(groups), len(groups))
+	for g, bits := range groups {
+		switch len(bits) {
+		case 0:
+			res[g] = new(big.Int)
+		case 1:
+			res[g] = bits[0]
+		default:
+			coeffs := p.orPoly(len(bits)).Coeffs
+			terms := make([]*big.Int, len(coeffs), len(coeffs))
+			terms[0] = coeffs[0]
+			for k := 1; k < len(coeffs); k++ {
+				terms[k] = p.field.Mul(coeffs[k], powers[g][k-1])
+			}
+			res[g] = p.field.Summation(terms)
+		}
+	}
+	return res, nil
+}
+
+// orPoly returns the polynomial f of degree m with f(1) = 0 and f(y) = 1 for y in [2, m+1].
+func (p *Party) orPoly(m int) *poly.Poly {
+	xs := make([]*big.Int, m+1, m+1)
+	ys := make([]*big.Int, m+1, m+1)
+	for i := range xs {
+		xs[i] = big.NewInt(int64(i + 1))
+		ys[i] = big.NewInt(1)
+	}
+	ys[0] = new(big.Int)
+	return poly.Interpolate(xs, ys, p.field)
+}
+
+// orMaskSizes returns the sizes of the masks needed by ors for groups of the specified sizes. A group of fewer than
+// two bits is its own OR, so it needs none.
+func orMaskSizes(groups []int) []int {
+	sizes := make([]int, len(groups), len(groups))
+	for g, m := range groups {
+		if m >= 2 {
+			sizes[g] = m
+		}
+	}
+	return sizes
+}
+
+// orTriples returns the number of multiplications used by ors for a group of m bits, including its masks.
+func orTriples(m int) int {
+	if m < 2 {
+		return 0
+	}
+	return prefixMasksTriples(m) + m
+}
+
+// preOrLayout is how preOr splits a vector of n bits into blocks of lambda bits, the last of which may be shorter.
+type preOrLayout struct {
+	n, lambda, nBlocks int
+}
+
+// newPreOrLayout returns the layout of a vector of n bits, which has blocks of ceil(sqrt(n)) bits.
+func newPreOrLayout(n int) preOrLayout {
+	lambda := 1
+	for lambda*lambda < n {
+		lambda++
+	}
+	return preOrLayout{n: n, lambda: lambda, nBlocks: (n + lambda - 1) / lambda}
+}
+
+// block returns the start and end of block b.
+func (l preOrLayout) block(b int) (int, int) {
+	end := (b + 1) * l.lambda
+	if end > l.n {
+		end = l.n
+	}
+	return b * l.lambda, end
+}
+
+// groups returns the sizes of the groups which preOr computes the ORs of in each of its three steps.
+func (l preOrLayout) groups() [3][]int {
+	var steps [3][]int
+	for b := 0; b < l.nBlocks; b++ {
+		start, end := l.block(b)
+		steps[0] = append(steps[0], end-start)
+		steps[1] = append(steps[1], b+1)
+	}
+	for j := 0; j < l.lambda; j++ {
+		steps[2] = append(steps[2], j+1)
+	}
+	return steps
+}
+
+// preOr returns this party's shares of the prefix ORs of each vector of shared bits in vecs, where the ith prefix OR
+// is the OR of the bits at indexes 0 to i. Every vector is computed in the same twelve rounds of communication,
+// regardless of its length, using O(n) multiplications for n bits. The bits are split into blocks of about sqrt(n)
+// bits. The first block which contains a 1 is found from the prefix ORs of the ORs of the blocks, and the prefix ORs
+// within that block are combined with the prefix ORs of the blocks.
+func (p *Party) preOr(ctx context.Context, vecs [][]*big.Int) ([][]*big.Int, error) {
+	res := make([][]*big.Int, len(vecs), len(vecs))
+	// layouts are the layouts of the vectors with more than one bit. A single bit is its own prefix OR.
+	var layouts []preOrLayout
+	var bits [][]*big.Int
+	for v, vec := range vecs {
+		if len(vec) <= 1 {
+			res[v] = append([]*big.Int(nil), vec...)
+			continue
+		}
+		layouts = append(layouts, newPreOrLayout(len(vec)))
+		bits = append(bits, vec)
+	}
+	if len(layouts) == 0 {
+		return res, nil
+	}
+
+	// The masks of every step are generated at once, since they do not depend on the bits.
+	var steps [3][]int
+	for _, l := range layouts {
+		groups := l.groups()
+		for s := range steps {
+			steps[s] = append(steps[s], groups[s]...)
+		}
+	}
+	var sizes []int
+	for _, step := range steps {
+		sizes = append(sizes, orMaskSizes(step)...)
+	}
+	allMasks, err := p.prefixMasks(ctx, sizes)
+	if err != nil {
+		return nil, err
+	}
+	var masks [3][][]mask
+	for s, step := range steps {
+		masks[s], allMasks = allMasks[:len(step)], allMasks[len(step):]
+	}
+
+	// 1. x_b is the OR of block b.
+	var groups [][]*big.Int
+	for v, l := range layouts {
+		for b := 0; b < l.nBlocks; b++ {
+			start, end := l.block(b)
+			groups = append(groups, bits[v][start:end])
+		}
+	}
+	xs, err := p.ors(ctx, groups, masks[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. y_b is the OR of x_0, ..., x_b, so f_b = y_b - y_{b-1} is 1 exactly for the first block which contains a 1.
+	groups = nil
+	offset := 0
+	for _, l := range layouts {
+		for b := 0; b < l.nBlocks; b++ {
+			groups = append(groups, xs[offset:offset+b+1])
+		}
+		offset += l.nBlocks
+	}
+	ys, err := p.ors(ctx, groups, masks[1])
+	if err != nil {
+		return nil, err
+	}
+	// prevs are y_{b-1}, which is 0 for the first block.
+	prevs := make([]*big.Int, len(ys), len(ys))
+	fs := make([]*big.Int, len(ys), len(ys))
+	offset = 0
+	for _, l := range layouts {
+		for b := 0; b < l.nBlocks; b++ {
+			prevs[offset+b] = new(big.Int)
+			if b > 0 {
+				prevs[offset+b] = ys[offset+b-1]
+			}
+			fs[offset+b] = p.field.Sub(ys[offset+b], prevs[offset+b])
+		}
+		offset += l.nBlocks
+	}
+
+	// 3. c_j = sum of f_b a_{b,j} is bit j of the first block which contains a 1, and b_j is the OR of c_0, ..., c_j.
+	var fsts, snds []*big.Int
+	offset = 0
+	for v, l := range layouts {
+		for b := 0; b < l.nBlocks; b++ {
+			start, end := l.block(b)
+			for _, bit := range bits[v][start:end] {
+				fsts = append(fsts, fs[offset+b])
+				snds = append(snds, bit)
+			}
+		}
+		offset += l.nBlocks
+	}
+	products, err := p.multiplier.mul(ctx, p.nextRound(), fsts, snds)
+	if err != nil {
+		return nil, err
+	}
+	groups = nil
+	for _, l := range layouts {
+		cs := make([]*big.Int, l.lambda, l.lambda)
+		for j := range cs {
+			cs[j] = new(big.Int)
+		}
+		for b := 0; b < l.nBlocks; b++ {
+			start, end := l.block(b)
+			for j := 0; j < end-start; j++ {
+				cs[j] = p.field.Add(cs[j], products[0])
+				products = products[1:]
+			}
+		}
+		for j := range cs {
+			groups = append(groups, cs[:j+1])
+		}
+	}
+	bs, err := p.ors(ctx, groups, masks[2])
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. The prefix OR of bit j of block b is b_j if b is the first block which contains a 1, 1 if it is after it, and
+	//    0 if it is before it, which is f_b b_j + y_{b-1}.
+	fsts, snds = fsts[:0], snds[:0]
+	offset, bOffset := 0, 0
+	for _, l := range layouts {
+		for b := 0; b < l.nBlocks; b++ {
+			start, end := l.block(b)
+			for j := 0; j < end-start; j++ {
+				fsts = append(fsts, fs[offset+b])
+				snds = append(snds, bs[bOffset+j])
+			}
+		}
+		offset += l.nBlocks
+		bOffset += l.lambda
+	}
+	if products, err = p.multiplier.mul(ctx, p.nextRound(), fsts, snds); err != nil {
+		return nil, err
+	}
+	offset = 0
+	k := 0
+	for v, vec := range vecs {
+		if len(vec) <= 1 {
+			continue
+		}
+		l := layouts[k]
+		k++
+		res[v] = make([]*big.Int, 0, len(vec))
+		for b := 0; b < l.nBlocks; b++ {
+			start, end := l.block(b)
+			for j := start; j < end; j++ {
+				res[v] = append(res[v], p.field.Add(products[0], prevs[offset+b]))
+				products = products[1:]
+			}
+		}
+		offset += l.nBlocks
+	}
+	return res, nil
+}
+
+// preOrTriples returns the number of multiplications used by preOr for a vector of n bits, if no random value has to
+// be generated again.
+func preOrTriples(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	// Each bit is multiplied twice, once to select the first block which contains a 1, and once to combine the prefix
+	// ORs within it with those of the blocks.
+	t := 2 * n
+	for _, step := range newPreOrLayout(n).groups() {
+		for _, m := range step {
+			t += orTriples(m)
+		}
+	}
+	return t
+}
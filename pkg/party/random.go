@@ -0,0 +1,198 @@
+package party
+
+import (
+	"context"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/field"
+	"github.com/sonjoonho/bgw/pkg/gate"
+	"github.com/sonjoonho/bgw/pkg/poly"
+	"math/big"
+)
+
+func (p *Party) processRandom(ctx context.Context, gateIdx int, gate *gate.Random) error {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+
+	id := p.nextRound()
+	rs, err := p.randomShares(ctx, id, 1)
+	if err != nil {
+		return err
+	}
+
+	p.logger.Printf("%s received random shares %v", gatePrefix, p.formatSharesForGate(id))
+
+	gate.SetOutput(rs[0])
+	return nil
+}
+
+func (p *Party) processRandomBit(ctx context.Context, gateIdx int, gate *gate.RandomBit) error {
+	gatePrefix := p.gatePrefix(gateIdx, gate.Type())
+
+	bits, err := p.randomBits(ctx, 1)
+	if err != nil {
+		return fmt.Errorf("gate %d (%s): %v", gateIdx, gate.Type(), err)
+	}
+
+	p.logger.Printf("%s generated random bit share %d", gatePrefix, bits[0])
+
+	gate.SetOutput(bits[0])
+	return nil
+}
+
+// randomBits returns this party's shares of n uniformly random bits. For each bit, the parties generate a random value
+// r and open r^2, which reveals nothing about which square root of it r is. Then for the square root s of r^2 which is
+// at most (p-1)/2, r/s is 1 or -1 with equal probability, and (r/s + 1)/2 is a random bit. Every bit is generated in
+// the same rounds of communication, and the bits for which r is zero are generated again. The prime must be odd, which
+// is checked by checkRandomBits. See https://link.springer.com/chapter/10.1007/11681878_15.
+func (p *Party) randomBits(ctx context.Context, n int) ([]*big.Int, error) {
+	two := big.NewInt(2)
+	// half is (p-1)/2, the largest of the canonical square roots.
+	half := new(big.Int).Rsh(p.field.Prime, 1)
+	bits := make([]*big.Int, n, n)
+	// pending are the indexes of the bits which have not been generated yet.
+	pending := make([]int, n, n)
+	for k := range pending {
+		pending[k] = k
+	}
+	for attempt := 0; attempt < maxAttempts && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			// The retried bits need triples which were not counted by TriplesNeeded.
+			if err := p.multiplier.preprocess(ctx, len(pending)); err != nil {
+				return nil, err
+			}
+		}
+		rs, err := p.randomShares(ctx, p.nextRound(), len(pending))
+		if err != nil {
+			return nil, err
+		}
+		squares, err := p.multiplier.mul(ctx, p.nextRound(), rs, rs)
+		if err != nil {
+			return nil, err
+		}
+		opened, err := p.open(ctx, p.nextRound(), p.field, squares)
+		if err != nil {
+			return nil, err
+		}
+
+		var retry []int
+		for k, i := range pending {
+			if opened[k].Sign() == 0 {
+				retry = append(retry, i)
+				continue
+			}
+			s := p.field.Sqrt(opened[k])
+			if s == nil {
+				return nil, fmt.Errorf("%d has no square root, so %d is not an odd prime", opened[k], p.field.Prime)
+			}
+			if s.Cmp(half) > 0 {
+				s = p.field.Sub(new(big.Int), s)
+			}
+			// sign is a share of r/s, which is 1 or -1.
+			sign := p.field.Mul(rs[k], p.field.Inv(s))
+			bits[i] = p.field.Div(p.field.Add(sign, big.NewInt(1)), two)
+		}
+		pending = retry
+	}
+	if len(pending) > 0 {
+		return nil, fmt.Errorf("random value was zero in %d attempts", maxAttempts)
+	}
+
+	return bits, nil
+}
+
+// randomNonZero returns this party's shares of a uniformly random non-zero value s. The parties generate random values
+// s and t, and open st, which is uniformly random and reveals nothing about s as long as it is non-zero, in which case
+// s is non-zero too. Otherwise, they try again.
+func (p *Party) randomNonZero(ctx context.Context) (*big.Int, error) {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			// The retried value needs a triple which was not counted by TriplesNeeded.
+			if err := p.multiplier.preprocess(ctx, 1); err != nil {
+				return nil, err
+			}
+		}
+		rs, err := p.randomShares(ctx, p.nextRound(), 2)
+		if err != nil {
+			return nil, err
+		}
+		products, err := p.multiplier.mul(ctx, p.nextRound(), rs[:1], rs[1:])
+		if err != nil {
+			return nil, err
+		}
+		opened, err := p.open(ctx, p.nextRound(), p.field, products)
+		if err != nil {
+			return nil, err
+		}
+		if opened[0].Sign() != 0 {
+			return rs[0], nil
+		}
+	}
+	return nil, fmt.Errorf("random value was zero in %d attempts", maxAttempts)
+}
+
+// randomShares returns this party's shares of n values which are uniformly random as long as any party is honest, in a
+// single round of communication identified by id. Each party shares n random values, and the shares are summed.
+func (p *Party) randomShares(ctx context.Context, id int, n int) ([]*big.Int, error) {
+	nParties := p.circuit.NParties
+
+	polys := make([]*poly.Poly, n, n)
+	for k := range polys {
+		polys[k] = poly.Random(p.field.Rand(), p.degree, p.field)
+	}
+	for party := 0; party < nParties; party++ {
+		shares := make([]*big.Int, n, n)
+		for k, po := range polys {
+			shares[k] = po.Eval(point(party))
+		}
+		if err := p.SendShares(ctx, party, id, shares...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.awaitShares(ctx, id, p.allParties(), nParties); err != nil {
+		return nil, err
+	}
+	received, err := p.receivedShares(id, n)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*big.Int, n, n)
+	for k := range results {
+		terms := make([]*big.Int, nParties, nParties)
+		for party := 0; party < nParties; party++ {
+			terms[party] = received[party][k]
+		}
+		results[k] = p.field.Summation(terms)
+	}
+	return results, nil
+}
+
+// open reveals the values that shares are shares of in fld to every party, in a single round of communication
+// identified by id. The values must be shared with degree less than N.
+func (p *Party) open(ctx context.Context, id int, fld field.Finite, shares []*big.Int) ([]*big.Int, error) {
+	nParties := p.circuit.NParties
+	for party := 0; party < nParties; party++ {
+		if err := p.SendShares(ctx, party, id, shares...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.awaitShares(ctx, id, p.allParties(), nParties); err != nil {
+		return nil, err
+	}
+	received, err := p.receivedShares(id, len(shares))
+	if err != nil {
+		return nil, err
+	}
+
+	recombination := p.recombinationVector(p.allParties(), fld)
+	values := make([]*big.Int, len(shares), len(shares))
+	for k := range values {
+		terms := make([]*big.Int, nParties, nParties)
+		for party := 0; party < nParties; party++ {
+			terms[party] = fld.Mul(received[party][k], recombination[party])
+		}
+		values[k] = fld.Summation(terms)
+	}
+	return values, nil
+}
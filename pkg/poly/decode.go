@@ -0,0 +1,155 @@
+package poly
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sonjoonho/bgw/pkg/field"
+	"math/big"
+)
+
+// ErrTooManyErrors is returned by Decode when the points contain more errors than can be corrected.
+var ErrTooManyErrors = errors.New("too many errors to decode")
+
+// Decode finds the polynomial of degree at most degree which passes through the points (xs[i], ys[i]), treating the
+// points as a Reed-Solomon codeword. Up to (len(xs) - degree - 1) / 2 of the points may be wrong; the indexes of the
+// points which do not lie on the decoded polynomial are returned. The x-coordinates must be distinct.
+// This uses the Berlekamp-Welch algorithm. See https://en.wikipedia.org/wiki/Berlekamp%E2%80%93Welch_algorithm.
+func Decode(xs, ys []*big.Int, degree int, field field.Finite) (*Poly, []int, error) {
+	n := len(xs)
+	if n < degree+1 {
+		return nil, nil, fmt.Errorf("%d points are not enough to decode a polynomial of degree %d", n, degree)
+	}
+	// e is the maximum number of errors that can be corrected.
+	e := (n - degree - 1) / 2
+
+	// We look for a monic error locator polynomial E of degree e, whose roots are the x-coordinates of the errors,
+	// and a polynomial Q = P * E of degree at most e + degree, such that Q(x_i) = y_i * E(x_i) for all i. The
+	// unknowns are the coefficients E_0, ..., E_{e-1} followed by Q_0, ..., Q_{e+degree}, which gives the linear
+	// equations Q(x_i) - y_i * (E_0 + ... + E_{e-1} x_i^{e-1}) = y_i * x_i^e.
+	nUnknowns := 2*e + degree + 1
+	rows := make([][]*big.Int, n, n)
+	for i, x := range xs {
+		row := make([]*big.Int, nUnknowns+1, nUnknowns+1)
+		pow := big.NewInt(1)
+		for k := 0; k <= e+degree; k++ {
+			if k < e {
+				row[k] = field.Sub(new(big.Int), field.Mul(ys[i], pow))
+			}
+			row[e+k] = pow
+			if k == e {
+				row[nUnknowns] = field.Mul(ys[i], pow)
+			}
+			pow = field.Mul(pow, x)
+		}
+		rows[i] = row
+	}
+
+	solution, err := solve(rows, nUnknowns, field)
+	if err != nil {
+		return nil, nil, ErrTooManyErrors
+	}
+
+	locator := append(append([]*big.Int{}, solution[:e]...), big.NewInt(1))
+	q, r := divide(solution[e:], locator, field)
+	for _, c := range r {
+		if c.Sign() != 0 {
+			return nil, nil, ErrTooManyErrors
+		}
+	}
+	// Pad q so that it always has degree+1 coefficients, even when its leading coefficients are zero.
+	for len(q) < degree+1 {
+		q = append(q, new(big.Int))
+	}
+	po := New(q[:degree+1], field)
+
+	var errs []int
+	for i, x := range xs {
+		if po.Eval(x).Cmp(field.Mod(ys[i])) != 0 {
+			errs = append(errs, i)
+		}
+	}
+	if len(errs) > e {
+		return nil, nil, ErrTooManyErrors
+	}
+
+	return po, errs, nil
+}
+
+// solve solves the system of linear equations represented by the augmented matrix rows, which has nUnknowns unknowns,
+// using Gaussian elimination. Free variables are set to zero. It returns an error if the system is inconsistent. The
+// rows are modified.
+func solve(rows [][]*big.Int, nUnknowns int, field field.Finite) ([]*big.Int, error) {
+	// pivots[c] is the row containing the pivot for column c, or -1 if c is a free variable.
+	pivots := make([]int, nUnknowns, nUnknowns)
+	r := 0
+	for c := 0; c < nUnknowns; c++ {
+		pivots[c] = -1
+
+		pivot := -1
+		for i := r; i < len(rows); i++ {
+			if rows[i][c].Sign() != 0 {
+				pivot = i
+				break
+			}
+		}
+		if pivot == -1 {
+			continue
+		}
+		rows[r], rows[pivot] = rows[pivot], rows[r]
+
+		// Normalise the pivot row, then eliminate this column from every other row.
+		inv := field.Inv(rows[r][c])
+		for k := c; k <= nUnknowns; k++ {
+			rows[r][k] = field.Mul(rows[r][k], inv)
+		}
+		for i := range rows {
+			if i == r || rows[i][c].Sign() == 0 {
+				continue
+			}
+			factor := rows[i][c]
+			for k := c; k <= nUnknowns; k++ {
+				rows[i][k] = field.Sub(rows[i][k], field.Mul(factor, rows[r][k]))
+			}
+		}
+
+		pivots[c] = r
+		r++
+	}
+
+	// Any remaining rows have no unknowns, so they must be 0 = 0.
+	for i := r; i < len(rows); i++ {
+		if rows[i][nUnknowns].Sign() != 0 {
+			return nil, errors.New("inconsistent system of equations")
+		}
+	}
+
+	solution := make([]*big.Int, nUnknowns, nUnknowns)
+	for c, row := range pivots {
+		if row == -1 {
+			solution[c] = new(big.Int)
+		} else {
+			solution[c] = rows[row][nUnknowns]
+		}
+	}
+	return solution, nil
+}
+
+// divide performs polynomial long division of num by den, which must have a non-zero leading coefficient, and returns
+// the coefficients of the quotient and remainder.
+func divide(num, den []*big.Int, field field.Finite) ([]*big.Int, []*big.Int) {
+	r := append([]*big.Int{}, num...)
+	if len(num) < len(den) {
+		return nil, r
+	}
+
+	q := make([]*big.Int, len(num)-len(den)+1, len(num)-len(den)+1)
+	lead := field.Inv(den[len(den)-1])
+	for k := len(q) - 1; k >= 0; k-- {
+		q[k] = field.Mul(r[k+len(den)-1], lead)
+		for j, d := range den {
+			r[k+j] = field.Sub(r[k+j], field.Mul(q[k], d))
+		}
+	}
+
+	return q, r[:len(den)-1]
+}
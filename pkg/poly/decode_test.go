@@ -0,0 +1,62 @@
+package poly
+
+import (
+	"github.com/sonjoonho/bgw/pkg/field"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	fld := field.New(field.Int(1000003))
+	po := New(field.Ints(20, 57, 68), fld)
+
+	tests := []struct {
+		name    string
+		corrupt []int
+		wantErr bool
+	}{{
+		name: "No errors",
+	}, {
+		name:    "One error",
+		corrupt: []int{4},
+	}, {
+		name:    "Two errors",
+		corrupt: []int{0, 5},
+	}, {
+		name:    "Too many errors",
+		corrupt: []int{1, 2, 6},
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// With 7 points and degree 2, up to 2 errors can be corrected.
+			xs := field.Ints(1, 2, 3, 4, 5, 6, 7)
+			ys := make([]*big.Int, len(xs), len(xs))
+			for i, x := range xs {
+				ys[i] = po.Eval(x)
+			}
+			for _, i := range tc.corrupt {
+				ys[i] = fld.Add(ys[i], field.Int(i+1))
+			}
+
+			got, errs, err := Decode(xs, ys, 2, fld)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Decode(%v, %v, 2, %v) = %s, %v, want error", xs, ys, fld, got, errs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode(%v, %v, 2, %v) failed with %v", xs, ys, fld, err)
+			}
+			if got.String() != po.String() {
+				t.Errorf("Decode(%v, %v, 2, %v) = %s, want %s", xs, ys, fld, got, po)
+			}
+			if !reflect.DeepEqual(errs, tc.corrupt) {
+				t.Errorf("Decode(%v, %v, 2, %v) found errors at %v, want %v", xs, ys, fld, errs, tc.corrupt)
+			}
+		})
+	}
+}
@@ -4,24 +4,24 @@ package poly
 import (
 	"fmt"
 	"github.com/sonjoonho/bgw/pkg/field"
-	"math"
+	"math/big"
 	"strings"
 )
 
 // Poly is a polynomial.
 type Poly struct {
-	Coeffs []int
-	field  field.Field
+	Coeffs []*big.Int
+	field  field.Finite
 }
 
 // New returns a new polynomial with the specified coefficients.
-func New(coeffs []int, field field.Field) *Poly {
+func New(coeffs []*big.Int, field field.Finite) *Poly {
 	return &Poly{Coeffs: coeffs, field: field}
 }
 
 // Random returns a polynomial with constant c, and random coefficient for all other terms.
-func Random(c int, deg int, field field.Field) *Poly {
-	coeffs := make([]int, deg+1, deg+1)
+func Random(c *big.Int, deg int, field field.Finite) *Poly {
+	coeffs := make([]*big.Int, deg+1, deg+1)
 	coeffs[0] = c
 	for d := 1; d <= deg; d++ {
 		coeffs[d] = field.Rand()
@@ -30,13 +30,13 @@ func Random(c int, deg int, field field.Field) *Poly {
 	return New(coeffs, field)
 }
 
-// Eval evaluates this polynomial at this value of x in the field.
-func (p *Poly) Eval(x int) int {
-	r := 0
-	for i, c := range p.Coeffs {
-		r += c * p.field.Pow(x, i)
+// Eval evaluates this polynomial at this value of x in the field using Horner's method.
+func (p *Poly) Eval(x *big.Int) *big.Int {
+	r := new(big.Int)
+	for i := len(p.Coeffs) - 1; i >= 0; i-- {
+		r = p.field.Add(p.field.Mul(r, x), p.Coeffs[i])
 	}
-	return p.field.Mod(r)
+	return r
 }
 
 // String returns the string representation of this polynomial.
@@ -51,25 +51,82 @@ func (p *Poly) String() string {
 	return strings.Join(ss, " + ")
 }
 
-// Recombination returns an element, r_i (or delta_i(0)), of the recombination vector of the specified length.
-func Recombination(party, length int) int {
-	i := party + 1
-	terms := make([]float64, length, length)
-	for j := 1; j <= length; j++ {
-		if j == i {
-			terms[j-1] = 1
-		} else {
-			terms[j-1] = float64(j) / float64(j-i)
+// Recombination returns the recombination vector for shares evaluated at the specified points. The ith element is
+// delta_i(0), the ith Lagrange basis polynomial evaluated at 0, so that the secret is the sum of delta_i(0) * share_i.
+// All arithmetic is performed exactly in the field. The points must be distinct and non-zero.
+func Recombination(points []*big.Int, field field.Finite) []*big.Int {
+	return lagrange(points, new(big.Int), field)
+}
+
+// Interpolate returns the unique polynomial of degree at most len(xs) - 1 which passes through every point (xs[i],
+// ys[i]). The x-coordinates must be distinct.
+// See https://en.wikipedia.org/wiki/Lagrange_polynomial.
+func Interpolate(xs, ys []*big.Int, field field.Finite) *Poly {
+	coeffs := make([]*big.Int, len(xs), len(xs))
+	for k := range coeffs {
+		coeffs[k] = new(big.Int)
+	}
+
+	for i, xi := range xs {
+		// basis is the numerator of the ith Lagrange basis polynomial, prod_{j != i} (x - x_j), and den is its value
+		// at xi.
+		basis := []*big.Int{big.NewInt(1)}
+		den := big.NewInt(1)
+		for j, xj := range xs {
+			if j == i {
+				continue
+			}
+			basis = mulLinear(basis, xj, field)
+			den = field.Mul(den, field.Sub(xi, xj))
+		}
+
+		scale := field.Div(ys[i], den)
+		for k, c := range basis {
+			coeffs[k] = field.Add(coeffs[k], field.Mul(c, scale))
 		}
 	}
-	return product(terms)
+
+	return New(coeffs, field)
 }
 
-// product returns the product of the elements of a slice, rounded to the nearest integer.
-func product(s []float64) int {
-	prod := 1.0
-	for _, n := range s {
-		prod *= n
+// InterpolateAt evaluates the unique polynomial of degree at most len(xs) - 1 which passes through every point (xs[i],
+// ys[i]) at x, without computing its coefficients. The x-coordinates must be distinct.
+func InterpolateAt(xs, ys []*big.Int, x *big.Int, field field.Finite) *big.Int {
+	terms := make([]*big.Int, len(xs), len(xs))
+	for i, l := range lagrange(xs, x, field) {
+		terms[i] = field.Mul(l, ys[i])
+	}
+	return field.Summation(terms)
+}
+
+// lagrange returns the Lagrange basis polynomials for points, each evaluated at x.
+func lagrange(points []*big.Int, x *big.Int, field field.Finite) []*big.Int {
+	r := make([]*big.Int, len(points), len(points))
+	for i, xi := range points {
+		num := big.NewInt(1)
+		den := big.NewInt(1)
+		for j, xj := range points {
+			if j == i {
+				continue
+			}
+			// delta_i(x) = prod_{j != i} (x - x_j) / (x_i - x_j).
+			num = field.Mul(num, field.Sub(x, xj))
+			den = field.Mul(den, field.Sub(xi, xj))
+		}
+		r[i] = field.Div(num, den)
+	}
+	return r
+}
+
+// mulLinear returns the coefficients of the polynomial with coefficients coeffs multiplied by (x - a).
+func mulLinear(coeffs []*big.Int, a *big.Int, field field.Finite) []*big.Int {
+	r := make([]*big.Int, len(coeffs)+1, len(coeffs)+1)
+	for k := range r {
+		r[k] = new(big.Int)
+	}
+	for k, c := range coeffs {
+		r[k+1] = field.Add(r[k+1], c)
+		r[k] = field.Sub(r[k], field.Mul(a, c))
 	}
-	return int(math.Round(prod))
+	return r
 }
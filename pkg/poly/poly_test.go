@@ -2,16 +2,123 @@ package poly
 
 import (
 	"github.com/sonjoonho/bgw/pkg/field"
+	"math/big"
 	"testing"
 )
 
 func TestPoly_Eval(t *testing.T) {
-	fld := field.New(101)
-	po := New([]int{20, 57, 68}, fld)
-	wants := []int{20, 44, 2, 96, 23, 86, 83}
+	fld := field.New(field.Int(101))
+	po := New(field.Ints(20, 57, 68), fld)
+	wants := field.Ints(20, 44, 2, 96, 23, 86, 83)
 	for j, want := range wants {
-		if got := po.Eval(j); got != want {
+		if got := po.Eval(field.Int(j)); got.Cmp(want) != 0 {
 			t.Errorf("po.Eval = %d, want %d", got, want)
 		}
 	}
 }
+
+func TestRecombination(t *testing.T) {
+	fld := field.New(field.Int(101))
+	points := field.Ints(1, 2, 3)
+	// delta_1(0) = 3, delta_2(0) = -3 and delta_3(0) = 1.
+	wants := field.Ints(3, 98, 1)
+
+	got := Recombination(points, fld)
+	for i, want := range wants {
+		if got[i].Cmp(want) != 0 {
+			t.Errorf("Recombination(%v, %v) = %v, want %v", points, fld, got, wants)
+			break
+		}
+	}
+}
+
+func TestRecombination_ManyParties(t *testing.T) {
+	fld, err := field.Parse("0x7fffffffffffffffffffffffffffffff")
+	if err != nil {
+		t.Fatalf("field.Parse() failed with %v", err)
+	}
+
+	for _, nParties := range []int{20, 50, 100} {
+		secret := fld.Rand()
+		po := Random(secret, nParties-1, fld)
+
+		points := make([]*big.Int, nParties, nParties)
+		shares := make([]*big.Int, nParties, nParties)
+		for i := 0; i < nParties; i++ {
+			points[i] = field.Int(i + 1)
+			shares[i] = po.Eval(points[i])
+		}
+
+		terms := make([]*big.Int, nParties, nParties)
+		for i, r := range Recombination(points, fld) {
+			terms[i] = fld.Mul(r, shares[i])
+		}
+
+		if got := fld.Summation(terms); got.Cmp(secret) != 0 {
+			t.Errorf("recombining %d shares of %s = %d, want %d", nParties, po, got, secret)
+		}
+	}
+}
+
+func TestRecombination_Binary(t *testing.T) {
+	fld := field.GF256()
+
+	// Shares over GF(2^8) can be recombined from any T+1 of them, just as over a prime field.
+	for _, nParties := range []int{3, 10, 255} {
+		secret := fld.Rand()
+		po := Random(secret, nParties/2, fld)
+
+		points := make([]*big.Int, nParties/2+1, nParties/2+1)
+		shares := make([]*big.Int, len(points), len(points))
+		for i := range points {
+			points[i] = field.Int(nParties - i)
+			shares[i] = po.Eval(points[i])
+		}
+
+		terms := make([]*big.Int, len(points), len(points))
+		for i, r := range Recombination(points, fld) {
+			terms[i] = fld.Mul(r, shares[i])
+		}
+
+		if got := fld.Summation(terms); got.Cmp(secret) != 0 {
+			t.Errorf("recombining %d shares of %s = %d, want %d", len(points), po, got, secret)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	fld := field.New(field.Int(101))
+	po := New(field.Ints(20, 57, 68), fld)
+
+	// Any three points determine po, regardless of which parties they came from.
+	xs := field.Ints(7, 2, 5)
+	ys := make([]*big.Int, len(xs), len(xs))
+	for i, x := range xs {
+		ys[i] = po.Eval(x)
+	}
+
+	got := Interpolate(xs, ys, fld)
+	for i, want := range po.Coeffs {
+		if got.Coeffs[i].Cmp(want) != 0 {
+			t.Errorf("Interpolate(%v, %v, %v) = %s, want %s", xs, ys, fld, got, po)
+			break
+		}
+	}
+}
+
+func TestInterpolateAt(t *testing.T) {
+	fld := field.New(field.Int(101))
+	po := New(field.Ints(20, 57, 68), fld)
+
+	xs := field.Ints(3, 6, 1)
+	ys := make([]*big.Int, len(xs), len(xs))
+	for i, x := range xs {
+		ys[i] = po.Eval(x)
+	}
+
+	for x := 0; x < 10; x++ {
+		if got, want := InterpolateAt(xs, ys, field.Int(x), fld), po.Eval(field.Int(x)); got.Cmp(want) != 0 {
+			t.Errorf("InterpolateAt(%v, %v, %d, %v) = %d, want %d", xs, ys, x, fld, got, want)
+		}
+	}
+}
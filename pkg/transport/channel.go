@@ -0,0 +1,53 @@
+package transport
+
+import "context"
+
+// Channel is a Transport for parties running in the same process, which communicate using Go channels.
+type Channel struct {
+	// ch is a channel through which this party receives messages.
+	ch chan *Message
+	// subs is a slice of send-only channels that this party uses to send messages to other parties, indexed by party
+	// id.
+	subs []chan<- *Message
+}
+
+// NewChannels returns a Channel for each of nParties parties, connected to each other. The ith Channel should be used
+// by the party with id i.
+func NewChannels(nParties int) []*Channel {
+	chans := make([]*Channel, nParties, nParties)
+	for i := range chans {
+		// Buffer enough messages that parties never block on sending.
+		chans[i] = &Channel{ch: make(chan *Message, nParties*nParties)}
+	}
+
+	for _, c := range chans {
+		c.subs = make([]chan<- *Message, nParties, nParties)
+		for j, sub := range chans {
+			c.subs[j] = sub.ch
+		}
+	}
+
+	return chans
+}
+
+func (c *Channel) Send(ctx context.Context, to int, msg *Message) error {
+	select {
+	case c.subs[to] <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Channel) Recv(ctx context.Context) (*Message, error) {
+	select {
+	case msg := <-c.ch:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Channel) Close() error {
+	return nil
+}
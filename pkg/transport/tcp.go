@@ -0,0 +1,461 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// dialTimeout is how long to keep retrying to connect to a peer, which may not have started listening yet.
+	dialTimeout = 30 * time.Second
+	// dialRetryInterval is how long to wait between attempts to connect to a peer.
+	dialRetryInterval = 100 * time.Millisecond
+	// lingerTimeout is how long Close waits for peers to finish sending before closing incoming connections.
+	lingerTimeout = 10 * time.Second
+	// maxMessageSize is the largest encoded message that will be accepted, in bytes.
+	maxMessageSize = 1 << 20
+	// inboxSize is the number of received messages that are buffered before reading from connections blocks.
+	inboxSize = 1024
+)
+
+// TCP is a Transport for parties which communicate over TCP, so that each party can run in its own process. Each party
+// dials every other party and uses that connection to send messages, and receives messages on the connections that
+// every other party dials to it. Messages are length-prefixed.
+type TCP struct {
+	// id is the id of the party using this Transport.
+	id int
+	// listener accepts connections from other parties.
+	listener net.Listener
+	// dial connects to the party with the specified id at an address.
+	dial func(party int, addr string) (net.Conn, error)
+	// authenticate returns the id of the party which dialled conn. If it is nil, connections are not authenticated
+	// and the source party of each message is trusted.
+	authenticate func(conn net.Conn) (int, error)
+	// peers are the addresses of every party, indexed by party id.
+	peers []string
+	// conns are the outgoing connections to other parties, indexed by party id. The entry for this party is nil, since
+	// messages sent to itself are delivered directly.
+	conns []net.Conn
+	// mu guards writes to conns.
+	mu sync.Mutex
+	// incoming are the accepted connections from other parties, and connected are the authenticated parties which have
+	// connected, indexed by party id. They are guarded by incomingMu.
+	incoming   []net.Conn
+	connected  []bool
+	nConnected int
+	incomingMu sync.Mutex
+	// inbox is a buffer of received messages.
+	inbox chan *Message
+	// errs receives errors encountered while receiving messages.
+	errs chan error
+	// readers tracks the goroutines which accept connections and read messages from them.
+	readers sync.WaitGroup
+	// done is closed when the Transport is closed.
+	done chan struct{}
+}
+
+// NewTCP returns a TCP Transport for the party with the specified id. It accepts connections from other parties on
+// listener, and connects to every other party using its address in peers, which is indexed by party id. Peers which
+// are not yet listening are retried for up to 30 seconds.
+func NewTCP(id int, listener net.Listener, peers []string) (*TCP, error) {
+	dial := func(party int, addr string) (net.Conn, error) {
+		return net.Dial("tcp", addr)
+	}
+	return newTCP(id, listener, peers, dial, nil)
+}
+
+func newTCP(id int, listener net.Listener, peers []string, dial func(party int, addr string) (net.Conn, error), authenticate func(conn net.Conn) (int, error)) (*TCP, error) {
+	if id < 0 || id >= len(peers) {
+		return nil, fmt.Errorf("id=%d is out of range for %d peers", id, len(peers))
+	}
+
+	t := &TCP{
+		id:           id,
+		listener:     listener,
+		dial:         dial,
+		authenticate: authenticate,
+		peers:        peers,
+		conns:        make([]net.Conn, len(peers), len(peers)),
+		connected:    make([]bool, len(peers), len(peers)),
+		inbox:        make(chan *Message, inboxSize),
+		errs:         make(chan error, len(peers)),
+		done:         make(chan struct{}),
+	}
+
+	// Start accepting before dialling, since every other party is dialling us at the same time.
+	t.readers.Add(1)
+	go t.accept()
+
+	for party, addr := range peers {
+		if party == id {
+			continue
+		}
+		conn, err := t.dialWithRetry(party, addr)
+		if err != nil {
+			// Nothing has been sent, so there is no need to wait for other parties.
+			t.close(0)
+			return nil, fmt.Errorf("failed to connect to party %d at %s: %v", party, addr, err)
+		}
+		t.conns[party] = conn
+	}
+
+	return t, nil
+}
+
+// dialWithRetry connects to party at addr, retrying until dialTimeout has elapsed.
+func (t *TCP) dialWithRetry(party int, addr string) (net.Conn, error) {
+	deadline := time.Now().Add(dialTimeout)
+	for {
+		conn, err := t.dial(party, addr)
+		if err == nil {
+			return conn, nil
+		}
+		// Only network errors, such as the peer not listening yet, are worth retrying. Other errors, such as the peer
+		// failing authentication, will not be resolved by waiting.
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(dialRetryInterval)
+	}
+}
+
+// accept accepts connections from other parties, and starts reading messages from each of them. Unauthenticated
+// connections cannot be told apart, so one is accepted for each other party. Authenticated connections are accepted
+// until every other party has connected, which closes the listener, so a connection which fails authentication or
+// duplicates another party's cannot take the place of a party which has not connected yet.
+func (t *TCP) accept() {
+	defer t.readers.Done()
+	for i := 0; i < len(t.peers)-1 || (t.authenticate != nil && !t.allConnected()); i++ {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if !t.allConnected() {
+				t.fail(fmt.Errorf("failed to accept connection: %v", err))
+			}
+			return
+		}
+
+		t.incomingMu.Lock()
+		t.incoming = append(t.incoming, conn)
+		t.incomingMu.Unlock()
+
+		t.readers.Add(1)
+		go t.read(conn)
+	}
+}
+
+// read reads messages from conn and delivers them to the inbox until the peer closes the connection. Once this
+// Transport has been closed, messages are read and discarded so that peers are not blocked.
+func (t *TCP) read(conn net.Conn) {
+	defer t.readers.Done()
+
+	// peer is the authenticated id of the party which dialled conn, or -1 if connections are not authenticated.
+	peer := -1
+	if t.authenticate != nil {
+		var err error
+		if peer, err = t.authenticate(conn); err == nil {
+			err = t.register(peer)
+		}
+		if err != nil {
+			// The connection is rejected, but the legitimate parties may still connect.
+			conn.Close()
+			return
+		}
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := readMessage(r)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.fail(fmt.Errorf("failed to read from %s: %v", conn.RemoteAddr(), err))
+			return
+		}
+		if peer != -1 && msg.Party != peer {
+			t.fail(fmt.Errorf("party %d sent a message claiming to be from party %d", peer, msg.Party))
+			return
+		}
+
+		select {
+		case t.inbox <- msg:
+		case <-t.done:
+		}
+	}
+}
+
+// register records that the authenticated party has connected, and returns an error if it is not one of the other
+// parties or has already connected. Once every other party has connected, the listener is closed, since no more
+// connections are expected.
+func (t *TCP) register(party int) error {
+	t.incomingMu.Lock()
+	defer t.incomingMu.Unlock()
+	switch {
+	case party == t.id || party >= len(t.peers):
+		return fmt.Errorf("party %d is not a peer", party)
+	case t.connected[party]:
+		return fmt.Errorf("party %d is already connected", party)
+	}
+
+	t.connected[party] = true
+	t.nConnected++
+	if t.nConnected == len(t.peers)-1 {
+		t.listener.Close()
+	}
+	return nil
+}
+
+// allConnected returns whether every other party has connected and been authenticated.
+func (t *TCP) allConnected() bool {
+	t.incomingMu.Lock()
+	defer t.incomingMu.Unlock()
+	return t.authenticate != nil && t.nConnected == len(t.peers)-1
+}
+
+// fail reports err to the next call to Recv, unless this Transport has been closed.
+func (t *TCP) fail(err error) {
+	select {
+	case <-t.done:
+	case t.errs <- err:
+	}
+}
+
+func (t *TCP) Send(ctx context.Context, to int, msg *Message) error {
+	if to < 0 || to >= len(t.peers) {
+		return fmt.Errorf("party %d does not exist", to)
+	}
+
+	if to == t.id {
+		select {
+		case t.inbox <- msg:
+			return nil
+		case <-t.done:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Writing blocks if the peer is not reading, so the deadline of ctx must be applied to the connection, and
+	// cancelling ctx must interrupt the write.
+	conn := t.conns[to]
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	stop := interruptOnDone(ctx, conn)
+	err := writeMessage(conn, msg)
+	stop()
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			// Part of the message may have been written, so the connection cannot be used for any more messages.
+			conn.Close()
+			return ctxErr
+		}
+		return fmt.Errorf("failed to send to party %d: %v", to, err)
+	}
+	return nil
+}
+
+// interruptOnDone interrupts any write to conn once ctx is done, by moving its write deadline to the past. The returned
+// function stops this, and returns once conn will no longer be modified, so it must be called after writing.
+func interruptOnDone(ctx context.Context, conn net.Conn) func() {
+	if ctx.Done() == nil {
+		// ctx can never be cancelled.
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			conn.SetWriteDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+func (t *TCP) Recv(ctx context.Context) (*Message, error) {
+	select {
+	case msg := <-t.inbox:
+		return msg, nil
+	case err := <-t.errs:
+		return nil, err
+	case <-t.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the connections to other parties. Since other parties may still be waiting for messages from each other,
+// it then waits for every other party to close its connection before returning.
+func (t *TCP) Close() error {
+	return t.close(lingerTimeout)
+}
+
+// close closes the connections to other parties, and waits for up to linger for every other party to close its
+// connection.
+func (t *TCP) close(linger time.Duration) error {
+	select {
+	case <-t.done:
+		return ErrClosed
+	default:
+	}
+
+	t.mu.Lock()
+	for _, conn := range t.conns {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+	t.mu.Unlock()
+	close(t.done)
+
+	finished := make(chan struct{})
+	go func() {
+		t.readers.Wait()
+		close(finished)
+	}()
+
+	var err error
+	select {
+	case <-finished:
+	case <-time.After(linger):
+		err = errors.New("timed out waiting for other parties to finish")
+	}
+
+	// Closing the listener and incoming connections unblocks any goroutines which are still waiting.
+	t.listener.Close()
+	t.incomingMu.Lock()
+	for _, conn := range t.incoming {
+		conn.Close()
+	}
+	t.incomingMu.Unlock()
+
+	return err
+}
+
+// writeMessage writes msg to w, prefixed with its length as a 4-byte big-endian integer.
+func writeMessage(w io.Writer, msg *Message) error {
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err = w.Write(buf)
+	return err
+}
+
+// readMessage reads a length-prefixed message from r. It returns io.EOF if r has no more messages.
+func readMessage(r io.Reader) (*Message, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(prefix[:])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds maximum size", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	msg := &Message{}
+	if err := msg.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// MarshalBinary encodes the message as the party, the gate and the number of shares as unsigned varints, followed by
+// each share as its length in bytes as an unsigned varint then its big-endian bytes. Shares are field elements so they
+// are never negative.
+func (m *Message) MarshalBinary() ([]byte, error) {
+	if m.Party < 0 || m.Gate < 0 {
+		return nil, fmt.Errorf("cannot encode message with negative values: %+v", m)
+	}
+
+	buf := make([]byte, 3*binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(m.Party))
+	n += binary.PutUvarint(buf[n:], uint64(m.Gate))
+	n += binary.PutUvarint(buf[n:], uint64(len(m.Shares)))
+	buf = buf[:n]
+
+	var prefix [binary.MaxVarintLen64]byte
+	for _, share := range m.Shares {
+		if share.Sign() < 0 {
+			return nil, fmt.Errorf("cannot encode message with negative values: %+v", m)
+		}
+		b := share.Bytes()
+		buf = append(buf, prefix[:binary.PutUvarint(prefix[:], uint64(len(b)))]...)
+		buf = append(buf, b...)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a message encoded by MarshalBinary.
+func (m *Message) UnmarshalBinary(data []byte) error {
+	var header [3]uint64
+	for i, name := range []string{"party", "gate", "number of shares"} {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("malformed message: invalid %s", name)
+		}
+		header[i] = v
+		data = data[n:]
+	}
+
+	// Each share takes at least one byte, which bounds the number of shares we allocate space for.
+	if header[2] > uint64(len(data)) {
+		return errors.New("malformed message: too many shares")
+	}
+	shares := make([]*big.Int, header[2], header[2])
+	for i := range shares {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) {
+			return errors.New("malformed message: invalid share")
+		}
+		data = data[n:]
+		shares[i] = new(big.Int).SetBytes(data[:size])
+		data = data[size:]
+	}
+	if len(data) != 0 {
+		return errors.New("malformed message: trailing data")
+	}
+
+	m.Party = int(header[0])
+	m.Gate = int(header[1])
+	m.Shares = shares
+	return nil
+}
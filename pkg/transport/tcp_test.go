@@ -0,0 +1,176 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMessage_MarshalBinary(t *testing.T) {
+	share, _ := new(big.Int).SetString("170141183460469231731687303715884105727", 10)
+	tests := []*Message{
+		{Party: 0, Gate: 0, Shares: []*big.Int{big.NewInt(0)}},
+		{Party: 3, Gate: 1000, Shares: []*big.Int{big.NewInt(42)}},
+		{Party: 99, Gate: 7, Shares: []*big.Int{share}},
+		{Party: 5, Gate: 12, Shares: []*big.Int{big.NewInt(1), share, big.NewInt(0), big.NewInt(255)}},
+		{Party: 1, Gate: 2, Shares: []*big.Int{}},
+	}
+
+	for _, want := range tests {
+		var buf bytes.Buffer
+		if err := writeMessage(&buf, want); err != nil {
+			t.Fatalf("writeMessage(%+v) failed with %v", want, err)
+		}
+		got, err := readMessage(&buf)
+		if err != nil {
+			t.Fatalf("readMessage() failed with %v", err)
+		}
+		if !equalMessages(got, want) {
+			t.Errorf("readMessage() = %+v, want %+v", got, want)
+		}
+	}
+}
+
+// equalMessages returns whether a and b have the same party, gate and shares.
+func equalMessages(a, b *Message) bool {
+	if a.Party != b.Party || a.Gate != b.Gate || len(a.Shares) != len(b.Shares) {
+		return false
+	}
+	for i := range a.Shares {
+		if a.Shares[i].Cmp(b.Shares[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// listen returns a listener on a free port on localhost for each of n parties, and their addresses.
+func listen(t *testing.T, n int) ([]net.Listener, []string) {
+	listeners := make([]net.Listener, n, n)
+	addrs := make([]string, n, n)
+	for i := range listeners {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("net.Listen() failed with %v", err)
+		}
+		listeners[i] = l
+		addrs[i] = l.Addr().String()
+	}
+	return listeners, addrs
+}
+
+// exchange connects nParties parties using newTransport. Every party then sends a message to every party, including
+// itself, and checks that it receives one from each party.
+func exchange(t *testing.T, nParties int, newTransport func(id int, listener net.Listener, peers []string) (*TCP, error)) {
+	listeners, addrs := listen(t, nParties)
+
+	var wg sync.WaitGroup
+	received := make([][]int, nParties, nParties)
+	errs := make([]error, nParties, nParties)
+	for i := 0; i < nParties; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tr, err := newTransport(i, listeners[i], addrs)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			for to := 0; to < nParties; to++ {
+				if err := tr.Send(context.Background(), to, &Message{Party: i, Gate: to, Shares: []*big.Int{big.NewInt(int64(10*i + to))}}); err != nil {
+					errs[i] = err
+					return
+				}
+			}
+			for j := 0; j < nParties; j++ {
+				msg, err := tr.Recv(context.Background())
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				if msg.Gate != i || msg.Shares[0].Int64() != int64(10*msg.Party+i) {
+					t.Errorf("party %d received unexpected message %+v", i, msg)
+				}
+				received[i] = append(received[i], msg.Party)
+			}
+			errs[i] = tr.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < nParties; i++ {
+		if errs[i] != nil {
+			t.Errorf("party %d failed with %v", i, errs[i])
+			continue
+		}
+		sort.Ints(received[i])
+		want := make([]int, nParties, nParties)
+		for j := range want {
+			want[j] = j
+		}
+		if !reflect.DeepEqual(received[i], want) {
+			t.Errorf("party %d received messages from %v, want %v", i, received[i], want)
+		}
+	}
+}
+
+func TestTCP(t *testing.T) {
+	exchange(t, 3, NewTCP)
+}
+
+func TestTCP_SendCancelled(t *testing.T) {
+	listeners, addrs := listen(t, 2)
+	// Party 1 accepts the connection from party 0, but never reads from it, so party 0's writes eventually block.
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listeners[1].Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	defer listeners[1].Close()
+
+	tr, err := NewTCP(0, listeners[0], addrs)
+	if err != nil {
+		t.Fatalf("NewTCP() failed with %v", err)
+	}
+	defer tr.close(0)
+	defer func() {
+		if conn := <-accepted; conn != nil {
+			conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	// Each message is large, so that the connection's buffers are soon full.
+	share := new(big.Int).Lsh(big.NewInt(1), 8*(maxMessageSize/2))
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			if err := tr.Send(ctx, 1, &Message{Party: 0, Gate: 0, Shares: []*big.Int{share}}); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Send() failed with %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Send() is still blocked after its context was cancelled")
+	}
+}
@@ -0,0 +1,189 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// partyNamePrefix prefixes the id of a party to form the name in its certificate.
+	partyNamePrefix = "party-"
+	// certificateValidity is how long generated certificates are valid for.
+	certificateValidity = 365 * 24 * time.Hour
+)
+
+// PartyName returns the name which identifies the party with the specified id in its certificate, e.g. party-3.
+func PartyName(id int) string {
+	return partyNamePrefix + strconv.Itoa(id)
+}
+
+// NewTLS returns a TCP Transport for the party with the specified id, where connections between parties are mutually
+// authenticated using TLS. config must contain this party's certificate, and the pool of CAs used to verify both the
+// certificates of the parties it dials (RootCAs) and of those that dial it (ClientCAs). The source party of each
+// received message is checked against the certificate of the party which sent it, rather than being trusted.
+func NewTLS(id int, listener net.Listener, peers []string, config *tls.Config) (*TCP, error) {
+	serverConfig := config.Clone()
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	dial := func(party int, addr string) (net.Conn, error) {
+		// Verifying the server name ensures that we are connected to the party that we think we are.
+		clientConfig := config.Clone()
+		clientConfig.ServerName = PartyName(party)
+		return tls.Dial("tcp", addr, clientConfig)
+	}
+
+	return newTCP(id, tls.NewListener(listener, serverConfig), peers, dial, authenticateTLS)
+}
+
+// authenticateTLS completes the TLS handshake on conn, and returns the id of the party identified by the verified
+// client certificate.
+func authenticateTLS(conn net.Conn) (int, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return 0, errors.New("connection does not use TLS")
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return 0, err
+	}
+
+	chains := tlsConn.ConnectionState().VerifiedChains
+	if len(chains) == 0 {
+		return 0, errors.New("no verified client certificate")
+	}
+	return partyFromCertificate(chains[0][0])
+}
+
+// partyFromCertificate returns the id of the party identified by cert.
+func partyFromCertificate(cert *x509.Certificate) (int, error) {
+	for _, name := range cert.DNSNames {
+		if !strings.HasPrefix(name, partyNamePrefix) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(name, partyNamePrefix))
+		if err != nil || id < 0 {
+			continue
+		}
+		return id, nil
+	}
+	return 0, fmt.Errorf("certificate for %q does not identify a party", cert.Subject.CommonName)
+}
+
+// TLSConfig returns a TLS configuration for a party with the specified PEM-encoded certificate and private key, which
+// trusts certificates signed by the PEM-encoded CA certificate.
+func TLSConfig(caCertPEM, certPEM, keyPEM []byte) (*tls.Config, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCertPEM) {
+		return nil, errors.New("failed to load CA certificate")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// GenerateCA generates a self-signed certificate authority for issuing party certificates, and returns its
+// PEM-encoded certificate and private key. It is intended for testing.
+func GenerateCA() ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template, err := certificateTemplate("BGW test CA")
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodeCertificate(der, key)
+}
+
+// GenerateCertificate generates a certificate for the party with the specified id, signed by the CA with the
+// PEM-encoded certificate and private key. It returns the PEM-encoded certificate and private key of the party. The
+// certificate is valid for both ends of a connection.
+func GenerateCertificate(id int, caCertPEM, caKeyPEM []byte) ([]byte, []byte, error) {
+	ca, err := tls.X509KeyPair(caCertPEM, caKeyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load CA: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := PartyName(id)
+	template, err := certificateTemplate(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.DNSNames = []string{name}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, ca.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodeCertificate(der, key)
+}
+
+// certificateTemplate returns a template for a certificate with the specified common name and a random serial number.
+func certificateTemplate(commonName string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certificateValidity),
+	}, nil
+}
+
+// encodeCertificate returns the PEM encodings of a DER-encoded certificate and its private key.
+func encodeCertificate(der []byte, key *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
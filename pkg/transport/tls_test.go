@@ -0,0 +1,142 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+)
+
+// tlsConfigs returns a TLS configuration for each of nParties parties, with certificates signed by a new CA.
+func tlsConfigs(t *testing.T, nParties int) []*tls.Config {
+	caCert, caKey, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() failed with %v", err)
+	}
+
+	configs := make([]*tls.Config, nParties, nParties)
+	for i := range configs {
+		cert, key, err := GenerateCertificate(i, caCert, caKey)
+		if err != nil {
+			t.Fatalf("GenerateCertificate(%d) failed with %v", i, err)
+		}
+		if configs[i], err = TLSConfig(caCert, cert, key); err != nil {
+			t.Fatalf("TLSConfig() failed with %v", err)
+		}
+	}
+	return configs
+}
+
+func TestTLS(t *testing.T) {
+	nParties := 3
+	configs := tlsConfigs(t, nParties)
+	exchange(t, nParties, func(id int, listener net.Listener, peers []string) (*TCP, error) {
+		return NewTLS(id, listener, peers, configs[id])
+	})
+}
+
+func TestTLS_BogusConnections(t *testing.T) {
+	nParties := 3
+	// Parties 3 and 4 have certificates signed by the same CA, but are not part of the protocol.
+	configs := tlsConfigs(t, nParties+2)
+	exchange(t, nParties, func(id int, listener net.Listener, peers []string) (*TCP, error) {
+		if id == 0 {
+			// Before the other parties connect, party 0 is sent a connection which is not TLS, a connection from a
+			// party which does not exist, and a connection claiming to be from party 0 itself. None of them should
+			// take the place of a legitimate party.
+			addr := listener.Addr().String()
+			if conn, err := net.Dial("tcp", addr); err == nil {
+				conn.Write([]byte("not a TLS handshake"))
+				defer conn.Close()
+			}
+			for _, bogus := range []int{4, 0} {
+				go func(bogus int) {
+					clientConfig := configs[bogus].Clone()
+					clientConfig.ServerName = PartyName(0)
+					if conn, err := tls.Dial("tcp", addr, clientConfig); err == nil {
+						// Wait for the connection to be rejected.
+						conn.Read(make([]byte, 1))
+						conn.Close()
+					}
+				}(bogus)
+			}
+		}
+		return NewTLS(id, listener, peers, configs[id])
+	})
+}
+
+func TestTLS_Impersonation(t *testing.T) {
+	nParties := 3
+	configs := tlsConfigs(t, nParties)
+	listeners, addrs := listen(t, nParties)
+
+	transports := make([]*TCP, nParties, nParties)
+	var wg sync.WaitGroup
+	for i := 0; i < nParties; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tr, err := NewTLS(i, listeners[i], addrs, configs[i])
+			if err != nil {
+				t.Errorf("party %d: NewTLS() failed with %v", i, err)
+				return
+			}
+			transports[i] = tr
+		}(i)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	// Party 0 claims to be party 2, but its certificate says otherwise.
+	if err := transports[0].Send(context.Background(), 1, &Message{Party: 2, Gate: 0, Shares: []*big.Int{big.NewInt(1)}}); err != nil {
+		t.Fatalf("Send() failed with %v", err)
+	}
+	if msg, err := transports[1].Recv(context.Background()); err == nil {
+		t.Errorf("Recv() = %+v, want error", msg)
+	}
+
+	for _, tr := range transports {
+		wg.Add(1)
+		go func(tr *TCP) {
+			defer wg.Done()
+			tr.Close()
+		}(tr)
+	}
+	wg.Wait()
+}
+
+func TestTLS_UntrustedCertificate(t *testing.T) {
+	trusted := tlsConfigs(t, 1)[0]
+	// untrusted has a certificate for party 1, but it is signed by a different CA.
+	untrusted := tlsConfigs(t, 2)[1]
+	untrusted.RootCAs = trusted.RootCAs
+
+	serverConfig := trusted.Clone()
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	listeners, _ := listen(t, 1)
+	listener := tls.NewListener(listeners[0], serverConfig)
+	defer listener.Close()
+
+	go func() {
+		clientConfig := untrusted.Clone()
+		clientConfig.ServerName = PartyName(0)
+		if conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig); err == nil {
+			// The server only rejects the certificate after the client has finished its side of the handshake.
+			conn.Read(make([]byte, 1))
+			conn.Close()
+		}
+	}()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept() failed with %v", err)
+	}
+	defer conn.Close()
+	if id, err := authenticateTLS(conn); err == nil {
+		t.Errorf("authenticateTLS() = %d, want error", id)
+	}
+}
@@ -0,0 +1,34 @@
+// Package transport provides the means by which parties communicate with each other.
+package transport
+
+import (
+	"context"
+	"errors"
+	"math/big"
+)
+
+// ErrClosed is returned when sending or receiving using a Transport that has been closed.
+var ErrClosed = errors.New("transport closed")
+
+// Message represents a message used for inter-party communication.
+type Message struct {
+	// Party is the *source* party.
+	Party int
+	// Gate identifies what the shares are for, typically the index of a gate.
+	Gate int
+	// Shares are the shares being sent. A message may carry several shares, for example when opening several values
+	// at once.
+	Shares []*big.Int
+}
+
+// Transport sends and receives messages on behalf of a single party. Parties are identified by their id, starting from
+// 0. A party may send messages to itself.
+type Transport interface {
+	// Send sends msg to the party with id to. It returns ctx.Err() if ctx is done before the message can be sent.
+	Send(ctx context.Context, to int, msg *Message) error
+	// Recv blocks until a message is received from any party, and returns it. It returns ctx.Err() if ctx is done
+	// before a message is received.
+	Recv(ctx context.Context) (*Message, error)
+	// Close releases any resources held by the Transport. It should be called once the party has finished.
+	Close() error
+}